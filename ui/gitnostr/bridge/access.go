@@ -0,0 +1,224 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+)
+
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+	AccessAdmin
+)
+
+// Sources of a RepositoryPermission row. Rows synced from a NIP-34 maintainers tag
+// are revoked when the tag drops the pubkey; rows granted by a permission event are
+// never touched by that sync.
+const (
+	PermissionSourceEvent       = "event"
+	PermissionSourceMaintainers = "maintainers"
+)
+
+// ErrRepositoryNotFound is returned by ResolveAccess when the repository has no Repository row.
+var ErrRepositoryNotFound = errors.New("repository not found")
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	case AccessAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// ParseAccess maps a stored permission (READ, WRITE or ADMIN) to an Access.
+func ParseAccess(permission string) Access {
+	switch permission {
+	case protocol.PermissionAdmin:
+		return AccessAdmin
+	case protocol.PermissionWrite:
+		return AccessWrite
+	case protocol.PermissionRead:
+		return AccessRead
+	}
+	return AccessNone
+}
+
+// UnknownRepoAccess applies an unknownRepoPolicy to a repository that exists on disk
+// but has no Repository row yet. The owner is let in under every policy, so the first
+// push to a just announced repository works before its row is written. allow-owner
+// also honors the direct and group grants the owner has published for the repository.
+func UnknownRepoAccess(db *sql.DB, policy string, ownerPubKey, repoName, targetPubKey string) (Access, error) {
+	ownerPubKey = strings.ToLower(ownerPubKey)
+	targetPubKey = strings.ToLower(targetPubKey)
+	if ownerPubKey == targetPubKey {
+		return AccessAdmin, nil
+	}
+
+	switch policy {
+	case UnknownRepoPolicyPublicRead:
+		return AccessRead, nil
+	case UnknownRepoPolicyAllowOwner:
+		var permission string
+		err := db.QueryRow("SELECT Permission FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=? AND TargetPubKey=?", ownerPubKey, repoName, targetPubKey).Scan(&permission)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return AccessNone, fmt.Errorf("query repository permission : %w", err)
+		}
+		return groupAccess(db, ownerPubKey, repoName, targetPubKey, ParseAccess(permission))
+	}
+	return AccessNone, nil
+}
+
+// ResolveAccess returns what targetPubKey may do on the owner's repository.
+// It combines the repository's public flags, direct RepositoryPermission rows,
+// group grants and the rule that owners always have ADMIN.
+// git-nostr-ssh and the bridge API both use it so they can't disagree; callers
+// that get ErrRepositoryNotFound for a repository present on disk should fall
+// back to UnknownRepoAccess.
+func ResolveAccess(db *sql.DB, ownerPubKey, repoName, targetPubKey string) (Access, error) {
+	ownerPubKey = strings.ToLower(ownerPubKey)
+	targetPubKey = strings.ToLower(targetPubKey)
+
+	var publicRead bool
+	var publicWrite bool
+	var publicWriteRefs string
+	var permission sql.NullString
+	row := db.QueryRow("SELECT Repository.PublicRead,Repository.PublicWrite,Repository.PublicWriteRefs,RepositoryPermission.Permission FROM Repository LEFT OUTER JOIN RepositoryPermission ON Repository.OwnerPubKey=RepositoryPermission.OwnerPubKey AND Repository.RepositoryName=RepositoryPermission.RepositoryName AND TargetPubKey=? WHERE Repository.OwnerPubKey=? AND Repository.RepositoryName=?", targetPubKey, ownerPubKey, repoName)
+	err := row.Scan(&publicRead, &publicWrite, &publicWriteRefs, &permission)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AccessNone, ErrRepositoryNotFound
+		}
+		return AccessNone, fmt.Errorf("query repository permission : %w", err)
+	}
+
+	if targetPubKey == ownerPubKey {
+		return AccessAdmin, nil
+	}
+
+	// Ref-scoped public write only lets anyone push to matching refs; that
+	// is enforced by the pre-receive hook, see PublicWriteRefs.
+	access := AccessNone
+	if publicWrite && publicWriteRefs == "" {
+		access = AccessWrite
+	} else if publicRead {
+		access = AccessRead
+	}
+	if direct := ParseAccess(permission.String); direct > access {
+		access = direct
+	}
+
+	return groupAccess(db, ownerPubKey, repoName, targetPubKey, access)
+}
+
+// groupAccess raises access to the highest grant targetPubKey holds through the
+// owner's groups on the repository.
+func groupAccess(db *sql.DB, ownerPubKey, repoName, targetPubKey string, access Access) (Access, error) {
+	rows, err := db.Query("SELECT RepositoryGroupPermission.Permission FROM RepositoryGroupPermission JOIN GroupMember ON RepositoryGroupPermission.OwnerPubKey=GroupMember.OwnerPubKey AND RepositoryGroupPermission.GroupName=GroupMember.GroupName WHERE RepositoryGroupPermission.OwnerPubKey=? AND RepositoryGroupPermission.RepositoryName=? AND GroupMember.MemberPubKey=?", ownerPubKey, repoName, targetPubKey)
+	if err != nil {
+		return AccessNone, fmt.Errorf("query group permission : %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupPermission string
+		if err := rows.Scan(&groupPermission); err != nil {
+			return AccessNone, fmt.Errorf("scan group permission : %w", err)
+		}
+		if group := ParseAccess(groupPermission); group > access {
+			access = group
+		}
+	}
+
+	return access, rows.Err()
+}
+
+// RepoAccess is a repository and what a pubkey may do on it.
+type RepoAccess struct {
+	OwnerPubKey    string
+	RepositoryName string
+	PublicRead     bool
+	SizeBytes      int64
+	Access         Access
+}
+
+// ListAccessibleRepos returns the repositories targetPubKey owns or holds a direct or
+// group grant on, with the access ResolveAccess gives it there. Repositories it can
+// only reach through public flags are not listed.
+func ListAccessibleRepos(db *sql.DB, targetPubKey string) ([]RepoAccess, error) {
+	targetPubKey = strings.ToLower(targetPubKey)
+
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName,PublicRead,SizeBytes FROM Repository WHERE OwnerPubKey=? UNION SELECT Repository.OwnerPubKey,Repository.RepositoryName,Repository.PublicRead,Repository.SizeBytes FROM Repository JOIN RepositoryPermission ON Repository.OwnerPubKey=RepositoryPermission.OwnerPubKey AND Repository.RepositoryName=RepositoryPermission.RepositoryName WHERE RepositoryPermission.TargetPubKey=? UNION SELECT Repository.OwnerPubKey,Repository.RepositoryName,Repository.PublicRead,Repository.SizeBytes FROM Repository JOIN RepositoryGroupPermission ON Repository.OwnerPubKey=RepositoryGroupPermission.OwnerPubKey AND Repository.RepositoryName=RepositoryGroupPermission.RepositoryName JOIN GroupMember ON RepositoryGroupPermission.OwnerPubKey=GroupMember.OwnerPubKey AND RepositoryGroupPermission.GroupName=GroupMember.GroupName WHERE GroupMember.MemberPubKey=? ORDER BY 1,2", targetPubKey, targetPubKey, targetPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("query accessible repositories : %w", err)
+	}
+
+	var repos []RepoAccess
+	for rows.Next() {
+		var repo RepoAccess
+		if err := rows.Scan(&repo.OwnerPubKey, &repo.RepositoryName, &repo.PublicRead, &repo.SizeBytes); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan accessible repository : %w", err)
+		}
+		repos = append(repos, repo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query accessible repositories : %w", err)
+	}
+
+	for i := range repos {
+		repos[i].Access, err = ResolveAccess(db, repos[i].OwnerPubKey, repos[i].RepositoryName, targetPubKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repos, nil
+}
+
+// PublicWriteRefs returns the ref patterns anyone may push to when the repository's
+// public write is scoped, or nil when public write is off or unscoped.
+func PublicWriteRefs(db *sql.DB, ownerPubKey, repoName string) ([]string, error) {
+	var publicWrite bool
+	var publicWriteRefs string
+	err := db.QueryRow("SELECT PublicWrite,PublicWriteRefs FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", strings.ToLower(ownerPubKey), repoName).Scan(&publicWrite, &publicWriteRefs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRepositoryNotFound
+		}
+		return nil, fmt.Errorf("query public write refs : %w", err)
+	}
+	if !publicWrite {
+		return nil, nil
+	}
+	return strings.Fields(publicWriteRefs), nil
+}
+
+// IsValidRefPattern accepts a full ref name ("refs/heads/main") or a prefix
+// followed by a single trailing "*" ("refs/heads/contrib/*").
+func IsValidRefPattern(pattern string) bool {
+	if !strings.HasPrefix(pattern, "refs/") || strings.ContainsAny(pattern, " \t") {
+		return false
+	}
+	star := strings.Index(pattern, "*")
+	return star == -1 || star == len(pattern)-1
+}
+
+// RefMatchesPattern reports whether ref is matched by a pattern accepted by IsValidRefPattern.
+// A trailing "*" matches any remainder, including further "/" separated components.
+func RefMatchesPattern(ref, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(ref, prefix)
+	}
+	return ref == pattern
+}
@@ -0,0 +1,175 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestDb returns a migrated database in a temporary directory.
+func openTestDb(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := OpenDb(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// execTest runs statements that set up a test, failing it on the first error.
+func execTest(t *testing.T, db *sql.DB, statements ...string) {
+	t.Helper()
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s : %v", statement, err)
+		}
+	}
+}
+
+const (
+	testOwner    = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testReader   = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	testWriter   = "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+	testAdmin    = "dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd"
+	testMember   = "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"
+	testStranger = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+)
+
+func TestResolveAccess(t *testing.T) {
+	db := openTestDb(t)
+	execTest(t, db,
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,PublicWriteRefs,UpdatedAt) VALUES ('"+testOwner+"','private',0,0,'',1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,PublicWriteRefs,UpdatedAt) VALUES ('"+testOwner+"','public',1,0,'',1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,PublicWriteRefs,UpdatedAt) VALUES ('"+testOwner+"','open',1,1,'',1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,PublicWriteRefs,UpdatedAt) VALUES ('"+testOwner+"','scoped',1,1,'refs/heads/contrib/*',1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,PublicWriteRefs,UpdatedAt) VALUES ('"+testOwner+"','scoped-private',0,1,'refs/heads/contrib/*',1)",
+		"INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES ('"+testOwner+"','private','"+testReader+"','READ',1)",
+		"INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES ('"+testOwner+"','private','"+testWriter+"','WRITE',1)",
+		"INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES ('"+testOwner+"','public','"+testAdmin+"','ADMIN',1)",
+		"INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES ('"+testOwner+"','open','"+testReader+"','READ',1)",
+		"INSERT INTO GroupMember (OwnerPubKey,GroupName,MemberPubKey,UpdatedAt) VALUES ('"+testOwner+"','team','"+testMember+"',1)",
+		"INSERT INTO RepositoryGroupPermission (OwnerPubKey,RepositoryName,GroupName,Permission,UpdatedAt) VALUES ('"+testOwner+"','private','team','WRITE',1)",
+		"INSERT INTO RepositoryGroupPermission (OwnerPubKey,RepositoryName,GroupName,Permission,UpdatedAt) VALUES ('"+testOwner+"','public','team','READ',1)",
+	)
+
+	tests := []struct {
+		name   string
+		owner  string
+		repo   string
+		target string
+		want   Access
+	}{
+		{"owner of private repo", testOwner, "private", testOwner, AccessAdmin},
+		{"owner in uppercase", strings.ToUpper(testOwner), "private", strings.ToUpper(testOwner), AccessAdmin},
+		{"owner of public repo", testOwner, "public", testOwner, AccessAdmin},
+		{"stranger on private repo", testOwner, "private", testStranger, AccessNone},
+		{"stranger on public read repo", testOwner, "public", testStranger, AccessRead},
+		{"stranger on public write repo", testOwner, "open", testStranger, AccessWrite},
+		{"stranger on ref-scoped public write repo", testOwner, "scoped", testStranger, AccessRead},
+		{"stranger on ref-scoped private repo", testOwner, "scoped-private", testStranger, AccessNone},
+		{"direct read grant", testOwner, "private", testReader, AccessRead},
+		{"direct write grant", testOwner, "private", testWriter, AccessWrite},
+		{"direct grant in uppercase", testOwner, "private", strings.ToUpper(testWriter), AccessWrite},
+		{"direct admin grant", testOwner, "public", testAdmin, AccessAdmin},
+		{"direct read grant below public write", testOwner, "open", testReader, AccessWrite},
+		{"grant on another repo", testOwner, "public", testWriter, AccessRead},
+		{"group write grant", testOwner, "private", testMember, AccessWrite},
+		{"group read grant", testOwner, "public", testMember, AccessRead},
+		{"group without grant on repo", testOwner, "scoped-private", testMember, AccessNone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveAccess(db, test.owner, test.repo, test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("ResolveAccess(%s) = %v, want %v", test.repo, got, test.want)
+			}
+		})
+	}
+
+	t.Run("unknown repo", func(t *testing.T) {
+		got, err := ResolveAccess(db, testOwner, "missing", testOwner)
+		if !errors.Is(err, ErrRepositoryNotFound) || got != AccessNone {
+			t.Errorf("ResolveAccess(missing) = %v, %v, want none and ErrRepositoryNotFound", got, err)
+		}
+	})
+}
+
+func TestRefMatchesPattern(t *testing.T) {
+	tests := []struct {
+		ref     string
+		pattern string
+		want    bool
+	}{
+		{"refs/heads/main", "refs/heads/main", true},
+		{"refs/heads/main2", "refs/heads/main", false},
+		{"refs/heads/contrib/a", "refs/heads/contrib/*", true},
+		{"refs/heads/contrib/a/b", "refs/heads/contrib/*", true},
+		{"refs/heads/contrib", "refs/heads/contrib/*", false},
+		{"refs/tags/v1", "refs/heads/*", false},
+	}
+	for _, test := range tests {
+		if got := RefMatchesPattern(test.ref, test.pattern); got != test.want {
+			t.Errorf("RefMatchesPattern(%q, %q) = %v, want %v", test.ref, test.pattern, got, test.want)
+		}
+	}
+
+	for pattern, want := range map[string]bool{
+		"refs/heads/main":      true,
+		"refs/heads/contrib/*": true,
+		"refs/heads/*/x":       false,
+		"heads/main":           false,
+		"refs/heads/a b":       false,
+	} {
+		if got := IsValidRefPattern(pattern); got != want {
+			t.Errorf("IsValidRefPattern(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestUnknownRepoAccess(t *testing.T) {
+	db := openTestDb(t)
+	execTest(t, db,
+		"INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES ('"+testOwner+"','repo','"+testWriter+"','WRITE',1)",
+		"INSERT INTO GroupMember (OwnerPubKey,GroupName,MemberPubKey,UpdatedAt) VALUES ('"+testOwner+"','team','"+testMember+"',1)",
+		"INSERT INTO RepositoryGroupPermission (OwnerPubKey,RepositoryName,GroupName,Permission,UpdatedAt) VALUES ('"+testOwner+"','repo','team','READ',1)",
+	)
+
+	tests := []struct {
+		policy string
+		target string
+		want   Access
+	}{
+		{UnknownRepoPolicyAllowOwner, strings.ToUpper(testOwner), AccessAdmin},
+		{UnknownRepoPolicyDeny, testOwner, AccessAdmin},
+		{UnknownRepoPolicyDeny, testWriter, AccessNone},
+		{UnknownRepoPolicyDeny, testMember, AccessNone},
+		{UnknownRepoPolicyDeny, testStranger, AccessNone},
+		{UnknownRepoPolicyPublicRead, testOwner, AccessAdmin},
+		{UnknownRepoPolicyPublicRead, testStranger, AccessRead},
+		{UnknownRepoPolicyAllowOwner, testOwner, AccessAdmin},
+		{UnknownRepoPolicyAllowOwner, testWriter, AccessWrite},
+		{UnknownRepoPolicyAllowOwner, testMember, AccessRead},
+		{UnknownRepoPolicyAllowOwner, testStranger, AccessNone},
+	}
+	for _, test := range tests {
+		got, err := UnknownRepoAccess(db, test.policy, testOwner, "repo", test.target)
+		if err != nil || got != test.want {
+			t.Errorf("UnknownRepoAccess(%s, %s) = %v, %v, want %v", test.policy, test.target[:8], got, err, test.want)
+		}
+	}
+
+	cfg := Config{RepositoryDir: "repos", DbFile: "db.sqlite", Relays: []RelayConfig{{URL: "wss://relay.example.com", Read: true}}, UnknownRepoPolicy: UnknownRepoPolicyDeny}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want unknownRepoPolicy deny accepted", err)
+	}
+	cfg.UnknownRepoPolicy = "nobody"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unknownRepoPolicy") {
+		t.Errorf("Validate() = %v, want unknown unknownRepoPolicy rejected", err)
+	}
+}
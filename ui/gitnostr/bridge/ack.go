@@ -0,0 +1,47 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// NewRepositoryAck builds and signs a kind 56 acknowledgement that the bridge hosts
+// the repository announced by announcement as of the ack's created_at. It references
+// the announcement ("e"), its author ("p") and, for NIP-34 announcements, the
+// repository address ("a").
+func NewRepositoryAck(privateKey string, announcement nostr.Event, repoName string) (nostr.Event, error) {
+	secretKey, err := gitnostr.DecodePrivateKey(privateKey)
+	if err != nil {
+		return nostr.Event{}, fmt.Errorf("bridge privateKey : %w", err)
+	}
+	pubKey, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return nostr.Event{}, fmt.Errorf("bridge privateKey : %w", err)
+	}
+
+	tags := nostr.Tags{
+		nostr.Tag{"e", announcement.ID},
+		nostr.Tag{"p", announcement.PubKey},
+	}
+	if announcement.Kind == protocol.KindRepositoryNIP34 {
+		address := protocol.Address{Kind: protocol.KindRepositoryNIP34, PubKey: announcement.PubKey, Identifier: repoName}
+		tags = append(tags, nostr.Tag{"a", address.String()})
+	}
+	tags = append(tags, nostr.Tag{"repository", repoName})
+
+	ack := nostr.Event{
+		PubKey:    pubKey,
+		CreatedAt: time.Now(),
+		Kind:      protocol.KindRepositoryAck,
+		Tags:      tags,
+		Content:   "",
+	}
+	if err := ack.Sign(secretKey); err != nil {
+		return nostr.Event{}, fmt.Errorf("sign repository ack : %w", err)
+	}
+	return ack, nil
+}
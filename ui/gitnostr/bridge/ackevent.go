@@ -0,0 +1,138 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ackTimeout bounds how long POST /api/event?ack=1 waits for the announcement to be
+// processed, which includes cloning the repository.
+const ackTimeout = 2 * time.Minute
+
+// processedWaiters are the channels requests wait on until an event is processed, by event id.
+type processedWaiters struct {
+	sync.Mutex
+	m map[string][]chan struct{}
+}
+
+func newProcessedWaiters() *processedWaiters {
+	return &processedWaiters{m: make(map[string][]chan struct{})}
+}
+
+// wait returns a channel that is closed once the event has been processed.
+// It must be called before the event is queued.
+func (w *processedWaiters) wait(eventID string) chan struct{} {
+	done := make(chan struct{})
+	w.Lock()
+	w.m[eventID] = append(w.m[eventID], done)
+	w.Unlock()
+	return done
+}
+
+// stop drops a waiter that won't be notified, e.g. because queueing failed.
+func (w *processedWaiters) stop(eventID string, done chan struct{}) {
+	w.Lock()
+	defer w.Unlock()
+	waiters := w.m[eventID]
+	for i, waiter := range waiters {
+		if waiter == done {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(w.m, eventID)
+	} else {
+		w.m[eventID] = waiters
+	}
+}
+
+func (w *processedWaiters) notify(eventID string) {
+	w.Lock()
+	waiters := w.m[eventID]
+	delete(w.m, eventID)
+	w.Unlock()
+	for _, done := range waiters {
+		close(done)
+	}
+}
+
+// repositoryAck signs an acknowledgement that the bridge hosts the repository of the
+// announcement and publishes it to the write relays. It fails unless the announcement
+// is validly signed and is the one the stored repository was last updated from, so a
+// rejected or superseded announcement gets no acknowledgement, and unless the
+// repository is on disk.
+func repositoryAck(event nostr.Event, repoName string, db *sql.DB, cfg Config) (nostr.Event, error) {
+	if event.GetID() != event.ID {
+		return nostr.Event{}, fmt.Errorf("event id doesn't match its content")
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok {
+		return nostr.Event{}, fmt.Errorf("event signature is invalid")
+	}
+	// processEvent stored the repository under the lowercase pubkey
+	ownerPubKey := strings.ToLower(event.PubKey)
+	event.PubKey = ownerPubKey
+
+	var updatedAt int64
+	err := db.QueryRow("SELECT UpdatedAt FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nostr.Event{}, fmt.Errorf("repository %s is not hosted by this bridge", repoName)
+		}
+		return nostr.Event{}, fmt.Errorf("query repository failed: %w", err)
+	}
+	if updatedAt != event.CreatedAt.Unix() {
+		return nostr.Event{}, fmt.Errorf("repository %s was not updated from this announcement", repoName)
+	}
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		return nostr.Event{}, err
+	}
+	if _, err := os.Stat(repoPath); err != nil {
+		return nostr.Event{}, fmt.Errorf("repository %s is not hosted by this bridge", repoName)
+	}
+
+	ack, err := NewRepositoryAck(cfg.PrivateKey, event, repoName)
+	if err != nil {
+		return nostr.Event{}, err
+	}
+	log.Printf("🧾 [Bridge] Signed acknowledgement %s for %s/%s\n", ack.ID, ownerPubKey, repoName)
+
+	go publishToWriteRelays(ack, cfg)
+	return ack, nil
+}
+
+// publishToWriteRelays sends event to every write relay, each over its own short-lived
+// connection so it doesn't depend on the subscription pool.
+func publishToWriteRelays(event nostr.Event, cfg Config) {
+	for _, url := range cfg.WriteRelayURLs() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.GetRelayConnectTimeout())
+		relay, err := nostr.RelayConnectContext(ctx, url)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ [Bridge] Failed to connect to write relay %s: %v\n", url, err)
+			continue
+		}
+		published := false
+		for status := range relay.Publish(event) {
+			if status == nostr.PublishStatusSucceeded {
+				published = true
+			}
+		}
+		relay.Close()
+		if published {
+			log.Printf("📤 [Bridge] Published event %s to %s\n", event.ID, url)
+		} else {
+			log.Printf("⚠️ [Bridge] Relay %s did not confirm event %s\n", url, event.ID)
+		}
+	}
+}
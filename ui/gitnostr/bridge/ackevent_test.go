@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRepositoryAck(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDb(t)
+	cfg := Config{RepositoryDir: filepath.Join(dir, "repos"), PrivateKey: nostr.GeneratePrivateKey()}
+
+	ownerKey := nostr.GeneratePrivateKey()
+	ownerPubKey, _ := nostr.GetPublicKey(ownerKey)
+	announce := func(createdAt time.Time) nostr.Event {
+		event := nostr.Event{PubKey: ownerPubKey, CreatedAt: createdAt, Kind: protocol.KindRepositoryNIP34, Tags: nostr.Tags{{"d", "repo"}}}
+		if err := event.Sign(ownerKey); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	applied := announce(time.Unix(1700000000, 0))
+	older := announce(time.Unix(1600000000, 0))
+
+	if _, err := repositoryAck(applied, "repo", db, cfg); err == nil {
+		t.Error("acknowledged a repository without a Repository row")
+	}
+
+	if _, err := db.Exec("INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES (?,?,?,?,?)", ownerPubKey, "repo", true, false, applied.CreatedAt.Unix()); err != nil {
+		t.Fatal(err)
+	}
+	repoPath, err := cfg.RepoPath(ownerPubKey, "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(repoPath, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repositoryAck(older, "repo", db, cfg); err == nil {
+		t.Error("acknowledged an announcement the repository was not updated from")
+	}
+
+	forged := applied
+	forged.Sig = strings.Repeat("0", 128)
+	if _, err := repositoryAck(forged, "repo", db, cfg); err == nil {
+		t.Error("acknowledged an announcement with an invalid signature")
+	}
+
+	ack, err := repositoryAck(applied, "repo", db, cfg)
+	if err != nil {
+		t.Fatalf("acknowledging the applied announcement: %v", err)
+	}
+	if ack.Kind != protocol.KindRepositoryAck || ack.Tags.GetFirst([]string{"e", applied.ID}) == nil {
+		t.Errorf("ack %v doesn't reference the announcement", ack)
+	}
+}
@@ -0,0 +1,861 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("⚠️ [Bridge API] Failed to write response: %v\n", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// handleRepoAPI routes /api/repos/{owner}/{repo}/{action}. The owner may be given as hex or npub.
+func handleRepoAPI(db *sql.DB, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/repos/"), "/"), "/")
+		if len(parts) != 3 {
+			writeJSONError(w, http.StatusNotFound, "expected /api/repos/{owner}/{repo}/{action}")
+			return
+		}
+
+		ownerPubKey, err := gitnostr.DecodePubKey(parts[0])
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		repoName := strings.TrimSuffix(parts[1], ".git")
+		if !IsValidRepoName(repoName) {
+			writeJSONError(w, http.StatusBadRequest, "invalid repository name")
+			return
+		}
+
+		switch parts[2] {
+		case "access":
+			handleRepoAccess(w, r, db, cfg, ownerPubKey, repoName)
+		case "info":
+			handleRepoInfo(w, r, db, ownerPubKey, repoName)
+		case "meta":
+			handleRepoMeta(w, r, db, ownerPubKey, repoName)
+		case "status":
+			handleRepoStatus(w, r, db, ownerPubKey, repoName)
+		case "comments":
+			handleRepoComments(w, r, db, ownerPubKey, repoName)
+		case "reactions":
+			handleRepoReactions(w, r, db, ownerPubKey, repoName)
+		case "deliveries":
+			handleRepoDeliveries(w, r, db, cfg, ownerPubKey, repoName)
+		case "commits":
+			handleRepoCommits(w, r, db, cfg, ownerPubKey, repoName)
+		case "refs":
+			handleRepoRefs(w, r, db, cfg, ownerPubKey, repoName)
+		default:
+			writeJSONError(w, http.StatusNotFound, "unknown action "+parts[2])
+		}
+	}
+}
+
+// handleAccessAPI serves /api/access?pubkey=, the repositories the pubkey owns or has
+// been granted access to. Only publicly readable repositories are listed, as the
+// endpoint is unauthenticated and must not reveal private ones.
+func handleAccessAPI(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		targetPubKey, err := gitnostr.DecodePubKey(r.URL.Query().Get("pubkey"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "pubkey query parameter must be a hex or npub public key")
+			return
+		}
+
+		repos, err := ListAccessibleRepos(db, targetPubKey)
+		if err != nil {
+			log.Printf("❌ [Bridge API] Failed to list repositories accessible to %s: %v\n", targetPubKey, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+			return
+		}
+
+		entries := []map[string]any{}
+		for _, repo := range repos {
+			if !repo.PublicRead || repo.Access == AccessNone {
+				continue
+			}
+			entries = append(entries, map[string]any{
+				"owner":     repo.OwnerPubKey,
+				"repo":      repo.RepositoryName,
+				"access":    repo.Access.String(),
+				"sizeBytes": repo.SizeBytes,
+			})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"pubkey": targetPubKey,
+			"repos":  entries,
+		})
+	}
+}
+
+// handleOwnerAPI serves /api/owners/{owner}, the owner's publicly readable
+// repositories with their sizes and the total. Private repositories are neither
+// listed nor counted.
+func handleOwnerAPI(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		ownerPubKey, err := gitnostr.DecodePubKey(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/owners/"), "/"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		rows, err := db.Query("SELECT RepositoryName,UpdatedAt,SizeBytes FROM Repository WHERE OwnerPubKey=? AND PublicRead ORDER BY RepositoryName", ownerPubKey)
+		if err != nil {
+			log.Printf("❌ [Bridge API] Failed to list repositories of %s: %v\n", ownerPubKey, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+			return
+		}
+		defer rows.Close()
+
+		entries := []map[string]any{}
+		var totalSizeBytes int64
+		for rows.Next() {
+			var repoName string
+			var updatedAt int64
+			var sizeBytes int64
+			if err := rows.Scan(&repoName, &updatedAt, &sizeBytes); err != nil {
+				log.Printf("❌ [Bridge API] Failed to scan repository of %s: %v\n", ownerPubKey, err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+				return
+			}
+			entries = append(entries, map[string]any{
+				"repo":      repoName,
+				"updatedAt": updatedAt,
+				"sizeBytes": sizeBytes,
+			})
+			totalSizeBytes += sizeBytes
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("❌ [Bridge API] Failed to list repositories of %s: %v\n", ownerPubKey, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"owner":          ownerPubKey,
+			"repos":          entries,
+			"totalSizeBytes": totalSizeBytes,
+		})
+	}
+}
+
+// handleCatalogAPI serves /api/catalog, every publicly readable repository the bridge
+// hosts ordered by owner and name, for aggregators indexing the bridge. Pages hold
+// ?limit= entries (default 100, at most 500); ?after=<owner>/<repo> continues after
+// the given entry, the next value of the previous page.
+func handleCatalogAPI(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		limit := 100
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			parsed, err := strconv.Atoi(limitParam)
+			if err != nil || parsed < 1 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+				return
+			}
+			limit = min(parsed, 500)
+		}
+		afterOwner, afterRepo := "", ""
+		if after := r.URL.Query().Get("after"); after != "" {
+			var found bool
+			afterOwner, afterRepo, found = strings.Cut(after, "/")
+			if !found {
+				writeJSONError(w, http.StatusBadRequest, "after must be <owner>/<repo>")
+				return
+			}
+		}
+
+		rows, err := db.Query("SELECT OwnerPubKey,RepositoryName,Description,Topics,CloneUrl,DefaultBranch,UpdatedAt FROM Repository WHERE PublicRead AND (OwnerPubKey>? OR (OwnerPubKey=? AND RepositoryName>?)) ORDER BY OwnerPubKey,RepositoryName LIMIT ?", afterOwner, afterOwner, afterRepo, limit)
+		if err != nil {
+			log.Printf("❌ [Bridge API] Failed to list the catalog: %v\n", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+			return
+		}
+		defer rows.Close()
+
+		entries := []map[string]any{}
+		var ownerPubKey, repoName string
+		for rows.Next() {
+			var description, topics, cloneUrl, defaultBranch string
+			var updatedAt int64
+			if err := rows.Scan(&ownerPubKey, &repoName, &description, &topics, &cloneUrl, &defaultBranch, &updatedAt); err != nil {
+				log.Printf("❌ [Bridge API] Failed to scan the catalog: %v\n", err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+				return
+			}
+			ownerNpub, err := nip19.EncodePublicKey(ownerPubKey, "")
+			if err != nil {
+				continue
+			}
+			entries = append(entries, map[string]any{
+				"owner":         ownerPubKey,
+				"ownerNpub":     ownerNpub,
+				"name":          repoName,
+				"description":   description,
+				"topics":        strings.Fields(topics),
+				"cloneUrl":      cloneUrl,
+				"defaultBranch": defaultBranch,
+				"updatedAt":     updatedAt,
+			})
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("❌ [Bridge API] Failed to list the catalog: %v\n", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to list repositories")
+			return
+		}
+
+		response := map[string]any{"repos": entries}
+		if len(entries) == limit {
+			response["next"] = ownerPubKey + "/" + repoName
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// handleAuditAPI serves /api/audit, the audit log newest first. It covers private
+// repositories too, so it is an admin endpoint. Filters: owner, repo, pubkey, verb,
+// since (as --since), before (entry id) and limit (default 50, at most 500).
+func handleAuditAPI(db *sql.DB, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		query := r.URL.Query()
+		filter := AuditFilter{Repo: query.Get("repo"), Verb: query.Get("verb"), Limit: 50}
+		for name, target := range map[string]*string{"owner": &filter.Owner, "pubkey": &filter.PubKey} {
+			if query.Get(name) == "" {
+				continue
+			}
+			pubKey, err := gitnostr.DecodePubKey(query.Get(name))
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, name+" must be a hex or npub public key")
+				return
+			}
+			*target = pubKey
+		}
+		if query.Get("since") != "" {
+			since, err := ParseSince(query.Get("since"), time.Now())
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			filter.Since = since.Unix()
+		}
+		if query.Get("before") != "" {
+			before, err := strconv.ParseInt(query.Get("before"), 10, 64)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "before must be an entry id")
+				return
+			}
+			filter.Before = before
+		}
+		if query.Get("limit") != "" {
+			limit, err := strconv.Atoi(query.Get("limit"))
+			if err != nil || limit <= 0 || limit > 500 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := QueryAudit(db, filter)
+		if err != nil {
+			log.Printf("❌ [Bridge API] Failed to query audit log: %v\n", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to query audit log")
+			return
+		}
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+
+		response := map[string]any{"entries": entries}
+		if len(entries) == filter.Limit {
+			response["next"] = entries[len(entries)-1].Id
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// handleValidateAPI serves POST /api/validate. It runs an event through the checks and
+// parsing of processEvent and returns what the bridge would do with it, without any
+// side effects. Client authors use it to try events before publishing them.
+func handleValidateAPI(db *sql.DB, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var event nostr.Event
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&event); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"valid": false, "problems": []string{"invalid event JSON: " + err.Error()}})
+			return
+		}
+		event.PubKey = strings.ToLower(event.PubKey)
+
+		plan := &eventPlan{}
+		idValid := event.GetID() == event.ID
+		if !idValid {
+			plan.problem("id %s doesn't match the event, expected %s", event.ID, event.GetID())
+		}
+		signatureValid, err := event.CheckSignature()
+		if err != nil {
+			plan.problem("signature check failed: %v", err)
+		} else if !signatureValid {
+			plan.problem("invalid signature")
+		}
+		if cfg.MaxEventAge > 0 && time.Since(event.CreatedAt) > cfg.MaxEventAge.Duration() {
+			plan.problem("created_at is older than maxEventAge (%s)", cfg.MaxEventAge.Duration())
+		}
+		if skew := time.Until(event.CreatedAt); skew > cfg.GetMaxFutureSkew() {
+			plan.problem("created_at is %s in the future, more than maxFutureSkew (%s)", skew.Round(time.Second), cfg.GetMaxFutureSkew())
+		}
+
+		parsed := planEvent(event, db, cfg)
+		plan.Actions = append(plan.Actions, parsed.Actions...)
+		plan.Problems = append(plan.Problems, parsed.Problems...)
+		if plan.Actions == nil {
+			plan.Actions = []string{}
+		}
+		if plan.Problems == nil {
+			plan.Problems = []string{}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"valid":          len(plan.Problems) == 0,
+			"id":             event.ID,
+			"kind":           event.Kind,
+			"idValid":        idValid,
+			"signatureValid": err == nil && signatureValid,
+			"actions":        plan.Actions,
+			"problems":       plan.Problems,
+		})
+	}
+}
+
+// requirePublicRead writes a 404 and returns false unless the repository exists and
+// is publicly readable, so private repositories can't be told apart from missing ones.
+func requirePublicRead(w http.ResponseWriter, db *sql.DB, ownerPubKey, repoName string) bool {
+	var publicRead bool
+	err := db.QueryRow("SELECT PublicRead FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&publicRead)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("❌ [Bridge API] Failed to query repository %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query repository")
+		return false
+	}
+	if err != nil || !publicRead {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return false
+	}
+	return true
+}
+
+// handleRepoAccess reports the effective permission of ?pubkey= on the repository,
+// resolved exactly as git-nostr-ssh resolves it. Like the other repository endpoints
+// it reports repositories that aren't publicly readable as not found, unless the
+// request carries the admin token.
+func handleRepoAccess(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg Config, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	targetPubKey, err := gitnostr.DecodePubKey(r.URL.Query().Get("pubkey"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "pubkey query parameter must be a hex or npub public key")
+		return
+	}
+
+	if !isAdminRequest(r, cfg) && !requirePublicRead(w, db, ownerPubKey, repoName) {
+		return
+	}
+
+	access, err := ResolveAccess(db, ownerPubKey, repoName, targetPubKey)
+	if err != nil {
+		if !errors.Is(err, ErrRepositoryNotFound) {
+			log.Printf("❌ [Bridge API] Failed to resolve access for %s on %s/%s: %v\n", targetPubKey, ownerPubKey, repoName, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve access")
+			return
+		}
+
+		repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve repository path")
+			return
+		}
+		if _, err := os.Stat(repoPath); err != nil {
+			writeJSONError(w, http.StatusNotFound, "repository not found")
+			return
+		}
+		access, err = UnknownRepoAccess(db, cfg.GetUnknownRepoPolicy(), ownerPubKey, repoName, targetPubKey)
+		if err != nil {
+			log.Printf("❌ [Bridge API] Failed to resolve access for %s on %s/%s: %v\n", targetPubKey, ownerPubKey, repoName, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve access")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"owner":  ownerPubKey,
+		"repo":   repoName,
+		"pubkey": targetPubKey,
+		"access": access.String(),
+	})
+}
+
+// handleRepoInfo returns the repository's settings and push statistics.
+// Repositories that aren't publicly readable are reported as not found.
+func handleRepoInfo(w http.ResponseWriter, r *http.Request, db *sql.DB, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var publicRead bool
+	var publicWrite bool
+	var updatedAt int64
+	var sizeBytes int64
+	err := db.QueryRow("SELECT PublicRead,PublicWrite,UpdatedAt,SizeBytes FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&publicRead, &publicWrite, &updatedAt, &sizeBytes)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("❌ [Bridge API] Failed to query repository %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query repository")
+		return
+	}
+	if err != nil || !publicRead {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	stats, err := GetRepositoryStats(db, ownerPubKey, repoName)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to query stats for %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query repository stats")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"owner":       ownerPubKey,
+		"repo":        repoName,
+		"publicRead":  publicRead,
+		"publicWrite": publicWrite,
+		"updatedAt":   updatedAt,
+		"sizeBytes":   sizeBytes,
+		"stats":       stats,
+	})
+}
+
+// handleRepoMeta returns the compact metadata link previews and indexers need. It
+// is a single database read and never runs git, so crawlers can hit it freely.
+// Repositories that aren't publicly readable are reported as not found.
+func handleRepoMeta(w http.ResponseWriter, r *http.Request, db *sql.DB, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var publicRead bool
+	var description, topics, cloneUrl, defaultBranch string
+	var updatedAt int64
+	err := db.QueryRow("SELECT PublicRead,Description,Topics,CloneUrl,DefaultBranch,UpdatedAt FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&publicRead, &description, &topics, &cloneUrl, &defaultBranch, &updatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("❌ [Bridge API] Failed to query repository %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query repository")
+		return
+	}
+	if err != nil || !publicRead {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	ownerNpub, err := nip19.EncodePublicKey(ownerPubKey, "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to encode owner")
+		return
+	}
+
+	if notModified(w, r, etagOf(description, topics, cloneUrl, defaultBranch, strconv.FormatInt(updatedAt, 10))) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":          repoName,
+		"description":   description,
+		"owner":         ownerPubKey,
+		"ownerNpub":     ownerNpub,
+		"defaultBranch": defaultBranch,
+		"topics":        strings.Fields(topics),
+		"cloneUrl":      cloneUrl,
+		"updatedAt":     updatedAt,
+	})
+}
+
+// handleRepoStatus returns the latest NIP-34 status of the repository's issues and
+// patches, optionally limited to one issue or patch with ?event=<id>, with the number
+// of stored comments on each.
+func handleRepoStatus(w http.ResponseWriter, r *http.Request, db *sql.DB, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !requirePublicRead(w, db, ownerPubKey, repoName) {
+		return
+	}
+
+	query := "SELECT TargetEventId,Status,StatusEventId,AuthorPubKey,UpdatedAt,(SELECT COUNT(*) FROM Comment c WHERE c.OwnerPubKey=s.OwnerPubKey AND c.RepositoryName=s.RepositoryName AND c.RootEventId=s.TargetEventId) FROM RepositoryEventStatus s WHERE OwnerPubKey=? AND RepositoryName=?"
+	args := []any{ownerPubKey, repoName}
+	if eventID := r.URL.Query().Get("event"); eventID != "" {
+		query += " AND TargetEventId=?"
+		args = append(args, eventID)
+	}
+
+	rows, err := db.Query(query+" ORDER BY UpdatedAt DESC", args...)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to query statuses for %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query statuses")
+		return
+	}
+	defer rows.Close()
+
+	type eventStatus struct {
+		EventID       string `json:"eventId"`
+		Status        string `json:"status"`
+		StatusEventID string `json:"statusEventId"`
+		Author        string `json:"author"`
+		UpdatedAt     int64  `json:"updatedAt"`
+		Comments      int    `json:"comments"`
+	}
+	statuses := []eventStatus{}
+	for rows.Next() {
+		var status eventStatus
+		if err := rows.Scan(&status.EventID, &status.Status, &status.StatusEventID, &status.Author, &status.UpdatedAt, &status.Comments); err != nil {
+			log.Printf("❌ [Bridge API] Failed to scan status for %s/%s: %v\n", ownerPubKey, repoName, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to query statuses")
+			return
+		}
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleRepoComments returns the discussion of the issue or patch ?event=<id> as a
+// thread: the comments replying to it directly, oldest first, each with its replies.
+// Replies whose parent isn't stored are shown at the top level.
+func handleRepoComments(w http.ResponseWriter, r *http.Request, db *sql.DB, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	eventID := r.URL.Query().Get("event")
+	if eventID == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing event parameter")
+		return
+	}
+
+	if !requirePublicRead(w, db, ownerPubKey, repoName) {
+		return
+	}
+
+	rows, err := db.Query("SELECT EventId,ParentEventId,AuthorPubKey,Content,CreatedAt FROM Comment WHERE OwnerPubKey=? AND RepositoryName=? AND RootEventId=? ORDER BY CreatedAt,EventId", ownerPubKey, repoName, eventID)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to query comments for %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query comments")
+		return
+	}
+	defer rows.Close()
+
+	type comment struct {
+		ID        string     `json:"id"`
+		ParentID  string     `json:"parentId"`
+		Author    string     `json:"author"`
+		Content   string     `json:"content"`
+		CreatedAt int64      `json:"createdAt"`
+		Replies   []*comment `json:"replies"`
+	}
+	var ordered []*comment
+	byID := make(map[string]*comment)
+	for rows.Next() {
+		c := &comment{Replies: []*comment{}}
+		if err := rows.Scan(&c.ID, &c.ParentID, &c.Author, &c.Content, &c.CreatedAt); err != nil {
+			log.Printf("❌ [Bridge API] Failed to scan comment for %s/%s: %v\n", ownerPubKey, repoName, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to query comments")
+			return
+		}
+		ordered = append(ordered, c)
+		byID[c.ID] = c
+	}
+
+	thread := []*comment{}
+	for _, c := range ordered {
+		if parent, found := byID[c.ParentID]; found && c.ParentID != c.ID {
+			parent.Replies = append(parent.Replies, c)
+		} else {
+			thread = append(thread, c)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"event":    eventID,
+		"count":    len(ordered),
+		"comments": thread,
+	})
+}
+
+// handleRepoReactions counts the reactions to the repository, or with ?event=<id> to
+// one of its issues or patches, by reaction content. Every reactor counts once.
+func handleRepoReactions(w http.ResponseWriter, r *http.Request, db *sql.DB, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !requirePublicRead(w, db, ownerPubKey, repoName) {
+		return
+	}
+
+	eventID := r.URL.Query().Get("event")
+	rows, err := db.Query("SELECT Content,COUNT(*) FROM Reaction WHERE OwnerPubKey=? AND RepositoryName=? AND TargetEventId=? GROUP BY Content", ownerPubKey, repoName, eventID)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to query reactions for %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query reactions")
+		return
+	}
+	defer rows.Close()
+
+	total := 0
+	counts := make(map[string]int)
+	for rows.Next() {
+		var content string
+		var count int
+		if err := rows.Scan(&content, &count); err != nil {
+			log.Printf("❌ [Bridge API] Failed to scan reactions for %s/%s: %v\n", ownerPubKey, repoName, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to query reactions")
+			return
+		}
+		counts[content] = count
+		total += count
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"event":  eventID,
+		"total":  total,
+		"counts": counts,
+	})
+}
+
+// handleRepoDeliveries lists the webhook deliveries of the repository newest first,
+// at most ?limit= (default 50, max 500). Hook URLs may carry secrets, so it is an
+// admin endpoint.
+func handleRepoDeliveries(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg Config, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireAdmin(w, r, cfg) {
+		return
+	}
+
+	limit := 50
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(parsed, 500)
+	}
+
+	deliveries, err := ListDeliveries(db, ownerPubKey, repoName, limit)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to list webhook deliveries for %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list webhook deliveries")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": deliveries})
+}
+
+// handleRepoCommits lists the commits of ?branch= (default HEAD), at most ?limit= (default 100, max 500).
+// An unborn HEAD has no commits.
+// Authors with a known git identity carry their pubkey, and with verifyCommitSignatures
+// enabled each commit carries its signature status.
+func handleRepoCommits(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg Config, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !requirePublicRead(w, db, ownerPubKey, repoName) {
+		return
+	}
+
+	rev := "HEAD"
+	if branch := r.URL.Query().Get("branch"); branch != "" {
+		if strings.HasPrefix(branch, "-") {
+			writeJSONError(w, http.StatusBadRequest, "invalid branch")
+			return
+		}
+		rev = "refs/heads/" + branch
+	}
+
+	limit := 100
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(parsed, 500)
+	}
+
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to resolve repository path")
+		return
+	}
+
+	// The commit the history starts at is its ETag, so unchanged history costs one git call
+	commit, err := ResolveCommit(repoPath, rev)
+	if err != nil {
+		// A repository created empty has no commits yet, that's not a missing branch
+		if unborn, _, unbornErr := UnbornHead(repoPath); rev == "HEAD" && unbornErr == nil && unborn != "" {
+			writeJSON(w, http.StatusOK, []Commit{})
+			return
+		}
+		writeJSONError(w, http.StatusNotFound, "branch not found")
+		return
+	}
+	if notModified(w, r, commit) {
+		return
+	}
+
+	commits, err := ListCommits(repoPath, commit, limit)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to list commits of %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list commits")
+		return
+	}
+
+	err = ResolveCommitAuthors(db, commits)
+	if err != nil {
+		log.Printf("⚠️ [Bridge API] Failed to resolve commit authors for %s/%s: %v\n", ownerPubKey, repoName, err)
+	}
+
+	if cfg.VerifyCommitSignatures {
+		err = VerifyCommitSignatures(db, repoPath, commits)
+		if err != nil {
+			log.Printf("⚠️ [Bridge API] Failed to verify signatures for %s/%s: %v\n", ownerPubKey, repoName, err)
+		}
+	}
+
+	if commits == nil {
+		commits = []Commit{}
+	}
+	writeJSON(w, http.StatusOK, commits)
+}
+
+// handleRepoRefs returns all refs mapped to their object ids and the ref HEAD points to,
+// which is unborn in a repository created empty.
+func handleRepoRefs(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg Config, ownerPubKey, repoName string) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !requirePublicRead(w, db, ownerPubKey, repoName) {
+		return
+	}
+
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to resolve repository path")
+		return
+	}
+	if _, err := os.Stat(repoPath); err != nil {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	refs, err := ListRefs(repoPath)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to list refs of %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list refs")
+		return
+	}
+
+	head, err := SymbolicHead(repoPath)
+	if err != nil {
+		log.Printf("❌ [Bridge API] Failed to resolve HEAD of %s/%s: %v\n", ownerPubKey, repoName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to resolve HEAD")
+		return
+	}
+
+	// The refs and HEAD are the whole response, so they make up its ETag
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := []string{head}
+	for _, name := range names {
+		parts = append(parts, name, refs[name])
+	}
+	if notModified(w, r, etagOf(parts...)) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"head":   head,
+		"refs":   refs,
+		"unborn": head != "" && refs[head] == "", // HEAD's branch has no commits yet
+	})
+}
@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The access endpoint is unauthenticated, so like the other repository endpoints it
+// must not confirm that a private or unlisted repository exists, unless asked by an admin.
+func TestRepoAccessHidesPrivateRepos(t *testing.T) {
+	db := openTestDb(t)
+	cfg := Config{RepositoryDir: filepath.Join(t.TempDir(), "repos"), AdminToken: "secret"}
+	execTest(t, db,
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+testOwner+"','public',1,0,1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+testOwner+"','private',0,0,1)",
+	)
+	unlisted, err := cfg.RepoPath(testOwner, "unlisted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(unlisted, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		repo  string
+		token string
+		want  int
+	}{
+		{"public", "", http.StatusOK},
+		{"private", "", http.StatusNotFound},
+		{"private", "wrong", http.StatusNotFound},
+		{"private", "secret", http.StatusOK},
+		{"unlisted", "", http.StatusNotFound},
+		{"unlisted", "secret", http.StatusOK},
+		{"missing", "secret", http.StatusNotFound},
+	}
+	handler := handleRepoAPI(db, cfg)
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/repos/"+testOwner+"/"+test.repo+"/access?pubkey="+testStranger, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.want {
+			t.Errorf("access of %s with token %q = %d, want %d", test.repo, test.token, w.Code, test.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AuditEntry is a SinkEvent recorded in the AuditLog table.
+type AuditEntry struct {
+	Id int64 `json:"id"`
+	SinkEvent
+}
+
+// AuditFilter selects audit entries. Zero fields don't filter. Entries are returned
+// newest first; Before pages through them by only returning entries with a smaller Id.
+type AuditFilter struct {
+	Owner  string
+	Repo   string
+	PubKey string
+	Verb   string // a SinkEvent type, e.g. "push.received"
+	Since  int64
+	Before int64
+	Limit  int
+}
+
+// auditSink records every SinkEvent in the AuditLog table.
+type auditSink struct {
+	db *sql.DB
+}
+
+// NewAuditSink returns a sink that writes to the AuditLog table of db.
+func NewAuditSink(db *sql.DB) EventSink {
+	return auditSink{db: db}
+}
+
+func (s auditSink) Emit(event SinkEvent) error {
+	data := ""
+	if len(event.Data) > 0 {
+		encoded, err := json.Marshal(event.Data)
+		if err != nil {
+			return fmt.Errorf("encode audit data : %w", err)
+		}
+		data = string(encoded)
+	}
+	_, err := s.db.Exec("INSERT INTO AuditLog (Time,Verb,OwnerPubKey,RepositoryName,PubKey,EventId,Data) VALUES (?,?,?,?,?,?,?)", event.Time, event.Type, strings.ToLower(event.Owner), event.Repo, strings.ToLower(event.PubKey), event.EventID, data)
+	if err != nil {
+		return fmt.Errorf("insert audit entry : %w", err)
+	}
+	return nil
+}
+
+func (auditSink) Close() error { return nil }
+
+type multiSink []EventSink
+
+// MultiSink emits every event to all sinks. Emit returns the first error but still
+// tries every sink.
+func MultiSink(sinks ...EventSink) EventSink {
+	return multiSink(sinks)
+}
+
+func (s multiSink) Emit(event SinkEvent) error {
+	var firstErr error
+	for _, sink := range s {
+		if err := sink.Emit(event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s multiSink) Close() error {
+	var firstErr error
+	for _, sink := range s {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// QueryAudit returns the audit entries matching filter, newest first.
+func QueryAudit(db *sql.DB, filter AuditFilter) ([]AuditEntry, error) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if filter.Owner != "" {
+		add("OwnerPubKey=?", strings.ToLower(filter.Owner))
+	}
+	if filter.Repo != "" {
+		add("RepositoryName=?", filter.Repo)
+	}
+	if filter.PubKey != "" {
+		add("PubKey=?", strings.ToLower(filter.PubKey))
+	}
+	if filter.Verb != "" {
+		add("Verb=?", filter.Verb)
+	}
+	if filter.Since > 0 {
+		add("Time>=?", filter.Since)
+	}
+	if filter.Before > 0 {
+		add("Id<?", filter.Before)
+	}
+
+	query := "SELECT Id,Time,Verb,OwnerPubKey,RepositoryName,PubKey,EventId,Data FROM AuditLog"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY Id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log : %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var data string
+		if err := rows.Scan(&entry.Id, &entry.Time, &entry.Type, &entry.Owner, &entry.Repo, &entry.PubKey, &entry.EventID, &data); err != nil {
+			return nil, fmt.Errorf("scan audit entry : %w", err)
+		}
+		if data != "" {
+			if err := json.Unmarshal([]byte(data), &entry.Data); err != nil {
+				return nil, fmt.Errorf("decode audit data of entry %d : %w", entry.Id, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultMaxBundleSize is the largest bundle download unless maxBundleSize is configured.
+const DefaultMaxBundleSize = 1 << 30
+
+// BundleSource is a git bundle a 30617 announcement distributes the repository as:
+// ["bundle", "<url>", "<sha256>"]. Blossom URLs name the blob by its hash, so the
+// hash may be left out for them.
+type BundleSource struct {
+	URL    string
+	Sha256 string // lowercase hex, "" if neither the tag nor the URL gives one
+}
+
+// ParseBundleTags returns the bundle sources of an announcement in tag order.
+// Tags without an http(s) URL are skipped.
+func ParseBundleTags(tags nostr.Tags) []BundleSource {
+	var bundles []BundleSource
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "bundle" {
+			continue
+		}
+		parsed, err := url.Parse(tag[1])
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			continue
+		}
+		bundle := BundleSource{URL: tag[1]}
+		if len(tag) >= 3 && isSha256Hex(tag[2]) {
+			bundle.Sha256 = strings.ToLower(tag[2])
+		} else {
+			// Blossom: https://server/<sha256>[.ext]
+			name := path.Base(parsed.Path)
+			name = strings.TrimSuffix(name, path.Ext(name))
+			if isSha256Hex(name) {
+				bundle.Sha256 = strings.ToLower(name)
+			}
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundles
+}
+
+func isSha256Hex(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// cloneBundle creates the bare repository at repoPath from a git bundle. The download
+// must match the bundle's sha256 and pass git bundle verify before any ref is
+// imported. HEAD points at defaultBranch if the bundle has it, else at any branch.
+func (s *Server) cloneBundle(bundle BundleSource, repoPath, defaultBranch string, cfg Config) error {
+	if bundle.Sha256 == "" {
+		return fmt.Errorf("bundle %s has no sha256 to verify it against", bundle.URL)
+	}
+	if IsOnionURL(bundle.URL) && cfg.Proxy == "" {
+		return fmt.Errorf("cannot download %s without a proxy", bundle.URL)
+	}
+
+	err := os.MkdirAll(filepath.Dir(repoPath), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	release := s.acquireCloneSlot()
+	defer release()
+
+	bundlePath, err := downloadBundle(bundle, filepath.Dir(repoPath), cfg)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(bundlePath)
+
+	err = importBundle(bundlePath, repoPath, defaultBranch, cfg)
+	if err == nil {
+		err = pruneMirrorRefs(repoPath, cfg)
+	}
+	if err != nil {
+		os.RemoveAll(repoPath) // like a failed git clone, leave nothing behind
+		return err
+	}
+	return nil
+}
+
+// downloadBundle saves the bundle to a temporary file in dir and checks its sha256.
+func downloadBundle(bundle BundleSource, dir string, cfg Config) (string, error) {
+	proxyURL, err := cfg.ProxyURL()
+	if err != nil {
+		return "", err
+	}
+	client := http.Client{Timeout: cfg.GetGitTimeout()}
+	if proxyURL != nil {
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	}
+
+	log.Printf("🔍 [Bridge] Downloading bundle: %s\n", bundle.URL)
+	resp, err := client.Get(bundle.URL)
+	if err != nil {
+		return "", fmt.Errorf("download bundle : %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download bundle %s : %v", bundle.URL, resp.Status)
+	}
+	maxSize := cfg.GetMaxBundleSize()
+	if resp.ContentLength > maxSize {
+		return "", fmt.Errorf("bundle %s has %d bytes, more than maxBundleSize %d", bundle.URL, resp.ContentLength, maxSize)
+	}
+
+	file, err := os.CreateTemp(dir, ".bundle-*")
+	if err != nil {
+		return "", fmt.Errorf("create bundle file : %w", err)
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, maxSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxSize {
+		err = fmt.Errorf("bundle %s is larger than maxBundleSize %d", bundle.URL, maxSize)
+	}
+	if err == nil {
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != bundle.Sha256 {
+			err = fmt.Errorf("bundle %s has sha256 %s, expected %s", bundle.URL, sum, bundle.Sha256)
+		}
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// importBundle fetches the branches and tags of a verified bundle into a new bare
+// repository, or only the ones matching cloneRefspecs or mirrorRefs if configured.
+func importBundle(bundlePath, repoPath, defaultBranch string, cfg Config) error {
+	output, err := cfg.Git("init", "--bare", repoPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git init --bare failed: %w: %s", err, output)
+	}
+
+	// Verified inside the new, empty repository, so bundles with prerequisites fail
+	output, err = cfg.Git("--git-dir", repoPath, "bundle", "verify", bundlePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git bundle verify failed: %w: %s", err, output)
+	}
+
+	refspecs := cfg.ImportRefspecs()
+	if len(refspecs) == 0 {
+		refspecs = []string{"refs/heads/*", "refs/tags/*"}
+	}
+	args := []string{"--git-dir", repoPath, "fetch", bundlePath}
+	for _, pattern := range refspecs {
+		args = append(args, "+"+pattern+":"+pattern)
+	}
+	log.Printf("🔍 [Bridge] Executing: git %s\n", strings.Join(args, " "))
+	output, err = cfg.Git(args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git fetch failed: %w: %s", err, output)
+	}
+
+	if resolved := pickRecoverableHeadRef(repoPath, "refs/heads/"+defaultBranch, nil); resolved != "" {
+		output, err := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", resolved).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git symbolic-ref HEAD failed: %w: %s", err, output)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// handleCommentEvent stores a reply to an issue or patch for each hosted repository
+// it references. Anyone may comment; comments on unknown repositories are dropped.
+func handleCommentEvent(event nostr.Event, db *sql.DB, cfg Config) error {
+
+	comment, err := protocol.ParseComment(event)
+	if err != nil {
+		return fmt.Errorf("malformed comment: %w", err)
+	}
+
+	for _, repo := range comment.Repositories {
+		var exists int
+		err := db.QueryRow("SELECT 1 FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", repo.PubKey, repo.Identifier).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("query repository failed: %w", err)
+		}
+
+		res, err := db.Exec("INSERT INTO Comment (OwnerPubKey,RepositoryName,EventId,RootEventId,ParentEventId,AuthorPubKey,Content,CreatedAt) VALUES (?,?,?,?,?,?,?,?) ON CONFLICT DO NOTHING;", repo.PubKey, repo.Identifier, event.ID, comment.RootEventID, comment.ParentEventID, event.PubKey, event.Content, event.CreatedAt.Unix())
+		if err != nil {
+			return fmt.Errorf("insert comment failed: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("rows affected failed: %w", err)
+		}
+
+		if affected == 1 {
+			log.Printf("💬 [Bridge] Comment stored: %s/%s root=%s parent=%s id=%s\n", repo.PubKey, repo.Identifier, comment.RootEventID, comment.ParentEventID, event.ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CommitSignature struct {
+	Status string `json:"status"`           // see signatureStatuses
+	Signer string `json:"signer,omitempty"` // signer as reported by gpg/ssh-keygen
+	Key    string `json:"key,omitempty"`    // key id or fingerprint
+}
+
+type Commit struct {
+	ID           string           `json:"id"`
+	ParentIDs    []string         `json:"parentIds,omitempty"`
+	Author       string           `json:"author"`
+	AuthorEmail  string           `json:"authorEmail"`
+	AuthorPubKey string           `json:"authorPubKey,omitempty"` // nostr identity of the author, see ResolveCommitAuthors
+	Timestamp    int64            `json:"timestamp"`
+	Message      string           `json:"message"`
+	Signature    *CommitSignature `json:"signature,omitempty"`
+}
+
+// signatureStatuses maps git's %G? placeholder to the status reported by the api.
+var signatureStatuses = map[string]string{
+	"G": "good",
+	"U": "good-untrusted",
+	"B": "bad",
+	"X": "expired-signature",
+	"Y": "expired-key",
+	"R": "revoked-key",
+	"E": "unverifiable",
+	"N": "unsigned",
+}
+
+// ListCommits returns up to limit commits reachable from rev, newest first.
+func ListCommits(repoPath, rev string, limit int) ([]Commit, error) {
+	output, err := Git("--git-dir", repoPath, "log", "--format=%H%x00%P%x00%an%x00%ae%x00%at%x00%s", "--max-count="+strconv.Itoa(limit), rev, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log %v failed: %w", rev, err)
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 6 {
+			continue
+		}
+		timestamp, _ := strconv.ParseInt(fields[4], 10, 64)
+		commits = append(commits, Commit{
+			ID:          fields[0],
+			ParentIDs:   strings.Fields(fields[1]),
+			Author:      fields[2],
+			AuthorEmail: fields[3],
+			Timestamp:   timestamp,
+			Message:     fields[5],
+		})
+	}
+	return commits, nil
+}
+
+// VerifyCommitSignatures fills in the Signature of each commit. Results are cached
+// per commit hash; "unverifiable" results are not cached because they usually mean
+// the signer's key isn't in the keyring yet.
+func VerifyCommitSignatures(db *sql.DB, repoPath string, commits []Commit) error {
+	var uncached []string
+	index := make(map[string]int, len(commits))
+	for i := range commits {
+		index[commits[i].ID] = i
+
+		var signature CommitSignature
+		err := db.QueryRow("SELECT Status,Signer,SigningKey FROM CommitSignature WHERE CommitHash=?", commits[i].ID).Scan(&signature.Status, &signature.Signer, &signature.Key)
+		if errors.Is(err, sql.ErrNoRows) {
+			uncached = append(uncached, commits[i].ID)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("query commit signature : %w", err)
+		}
+		commits[i].Signature = &signature
+	}
+
+	if len(uncached) == 0 {
+		return nil
+	}
+
+	args := append([]string{"--git-dir", repoPath, "show", "-s", "--no-walk=unsorted", "--format=%H%x00%G?%x00%GS%x00%GK"}, uncached...)
+	output, err := Git(args...).Output()
+	if err != nil {
+		return fmt.Errorf("git show signatures failed: %w", err)
+	}
+
+	verifiedAt := time.Now().Unix()
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		i, found := index[fields[0]]
+		if !found {
+			continue
+		}
+
+		status, found := signatureStatuses[fields[1]]
+		if !found {
+			status = signatureStatuses["E"]
+		}
+		signature := CommitSignature{Status: status, Signer: fields[2], Key: fields[3]}
+		commits[i].Signature = &signature
+
+		if fields[1] == "E" {
+			continue
+		}
+		_, err = db.Exec("INSERT INTO CommitSignature (CommitHash,Status,Signer,SigningKey,VerifiedAt) VALUES (?,?,?,?,?) ON CONFLICT DO NOTHING;", fields[0], signature.Status, signature.Signer, signature.Key, verifiedAt)
+		if err != nil {
+			return fmt.Errorf("cache commit signature : %w", err)
+		}
+	}
+
+	return nil
+}
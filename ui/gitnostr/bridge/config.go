@@ -1,28 +1,299 @@
 package bridge
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"time"
 
 	"github.com/arbadacarbaYK/gitnostr"
 )
 
+// Policies git-nostr-ssh applies to a repository that exists on disk but has no Repository row yet.
+const (
+	UnknownRepoPolicyDeny       = "deny"        // only the owner may access it
+	UnknownRepoPolicyPublicRead = "public-read" // anyone may read, only the owner may write
+	UnknownRepoPolicyAllowOwner = "allow-owner" // the owner and the pubkeys it granted access may access it
+)
+
+// What the bridge does with events of kinds it has no handler for, see Config.UnknownKinds.
+const (
+	UnknownKindsIgnore = "ignore" // drop them silently
+	UnknownKindsLog    = "log"    // log each one
+	UnknownKindsStore  = "store"  // keep them in FailedEvent, for gn failed
+)
+
 type Config struct {
-	ConfigDir     string   `json:"-"`
-	RepositoryDir string   `json:"repositoryDir"`
-	DbFile        string   `json:"DbFile"`
-	Relays        []string `json:"relays"`
-	GitRepoOwners []string `json:"gitRepoOwners"`
+	ConfigDir              string        `json:"-"`
+	RepositoryDir          string        `json:"repositoryDir"`
+	PathLayout             string        `json:"pathLayout,omitempty"` // nested (default), flat or sharded, see PathLayout
+	DbFile                 string        `json:"DbFile"`
+	Relays                 []RelayConfig `json:"relays"`
+	GitRepoOwners          []string      `json:"gitRepoOwners"`
+	UnknownRepoPolicy      string        `json:"unknownRepoPolicy,omitempty"`
+	GcInterval             Duration      `json:"gcInterval,omitempty"`             // how often pushed-to repos are gc'd, 0 disables
+	GcConcurrency          int           `json:"gcConcurrency,omitempty"`          // repos gc'd at the same time, default 1
+	BitmapMinSize          int64         `json:"bitmapMinSize,omitempty"`          // bytes from which gc also writes commit-graph and bitmaps, 0 disables
+	VerifyCommitSignatures bool          `json:"verifyCommitSignatures,omitempty"` // needs the signers' keys in the bridge user's keyring
+	Proxy                  string        `json:"proxy,omitempty"`                  // socks5://host:port for relay connections and clones
+	RelayConnectTimeout    Duration      `json:"relayConnectTimeout,omitempty"`    // per relay, default 10s
+	RelayListPubKey        string        `json:"relayListPubKey,omitempty"`        // hex or npub whose NIP-65 relay list adds relays to read from
+	RelayListRefresh       Duration      `json:"relayListRefresh,omitempty"`       // how often that relay list is fetched again, default 1h
+	AuthorizedKeysMode     string        `json:"authorizedKeysMode,omitempty"`     // file (default) or command
+	EventSink              string        `json:"eventSink,omitempty"`              // e.g. file:~/git-nostr-events.jsonl
+	MaxConcurrentClones    int           `json:"maxConcurrentClones,omitempty"`    // git clones running at the same time, default 2
+	DumbHttp               bool          `json:"dumbHttp,omitempty"`               // serve public repos over the dumb HTTP protocol under /git/
+	AllowFilter            *bool         `json:"allowFilter,omitempty"`            // serve partial clones (uploadpack.allowFilter), default true
+	WatchKinds             []int         `json:"watchKinds,omitempty"`             // kinds of the repository subscription, see DefaultWatchKinds
+	StrictSignatureKinds   []int         `json:"strictSignatureKinds,omitempty"`   // kinds POST /api/event rejects with a bad id or signature, see DefaultStrictSignatureKinds
+	ClientSideSinceFilter  bool          `json:"clientSideSinceFilter,omitempty"`  // drop relay events older than the subscription's since
+	MaxEventAge            Duration      `json:"maxEventAge,omitempty"`            // events created longer ago are skipped, 0 disables
+	MaxFutureSkew          Duration      `json:"maxFutureSkew,omitempty"`          // how far in the future created_at may be, default 15m
+	RepoNamePattern        string        `json:"repoNamePattern,omitempty"`        // regexp names of announced repositories must also match, see Config.IsValidRepoName
+	ReadOnly               bool          `json:"readOnly,omitempty"`               // mirror mode: no pushes, no publishing, no POST /api/event
+	SizeSweepInterval      Duration      `json:"sizeSweepInterval,omitempty"`      // how often stale repository sizes are recomputed, default 6h
+	CloneRefspecs          []string      `json:"cloneRefspecs,omitempty"`          // refs imported from clone/source URLs, e.g. "refs/heads/release/*"; empty clones all
+	MirrorRefs             []string      `json:"mirrorRefs,omitempty"`             // refs kept after an import, the others are pruned; also fetched if cloneRefspecs is empty
+	DeleteGracePeriod      Duration      `json:"deleteGracePeriod,omitempty"`      // deleted repositories wait this long in repositoryDir/.deleted, 0 removes them at once
+	PrivateKey             string        `json:"privateKey,omitempty"`             // hex or nsec key the bridge signs repository acknowledgements with
+	MinGitVersion          string        `json:"minGitVersion,omitempty"`          // oldest git the bridge starts with, e.g. "2.39", default MinGitVersion
+	AllowOldGit            bool          `json:"allowOldGit,omitempty"`            // only warn when git is older than minGitVersion
+	GitTimeout             Duration      `json:"gitTimeout,omitempty"`             // git subprocesses are killed after this, default 15m
+	GitProtocol            string        `json:"gitProtocol,omitempty"`            // newest git protocol git-nostr-ssh negotiates: v2 (default), v1 or v0
+	AdminToken             string        `json:"adminToken,omitempty"`             // bearer token of the admin endpoints, unset disables them
+	MaxFilterAuthors       int           `json:"maxFilterAuthors,omitempty"`       // authors per relay subscription, longer lists are split, default 250
+	StaleAfter             Duration      `json:"staleAfter,omitempty"`             // /readyz fails when no relay event arrived for this long, 0 disables
+	LeaderElection         bool          `json:"leaderElection,omitempty"`         // only the instance holding the database lease processes events
+	LeaseTtl               Duration      `json:"leaseTtl,omitempty"`               // how long the leader's lease lasts without renewal, default 30s
+	InstanceName           string        `json:"instanceName,omitempty"`           // lease holder name of this instance, default <hostname>:<pid>
+	MaxBundleSize          int64         `json:"maxBundleSize,omitempty"`          // bytes a bundle download may have, default 1 GiB
+	HttpReadHeaderTimeout  Duration      `json:"httpReadHeaderTimeout,omitempty"`  // time to read a request's headers, default 10s
+	HttpReadTimeout        Duration      `json:"httpReadTimeout,omitempty"`        // time to read a whole request, default 1m
+	HttpWriteTimeout       Duration      `json:"httpWriteTimeout,omitempty"`       // time to write a response, default 5m
+	HttpIdleTimeout        Duration      `json:"httpIdleTimeout,omitempty"`        // how long keep-alive connections idle, default 2m
+	HttpMaxConnections     int           `json:"httpMaxConnections,omitempty"`     // open HTTP connections at once, default 1000
+	DebounceWindow         Duration      `json:"debounceWindow,omitempty"`         // key and permission changes collected into one rebuild, default 2s
+	FailedEventRetention   Duration      `json:"failedEventRetention,omitempty"`   // how long events that failed processing are kept, default 720h
+	UnknownKinds           string        `json:"unknownKinds,omitempty"`           // ignore (default), log or store events of unhandled kinds
+	MtlsAddr               string        `json:"mtlsAddr,omitempty"`               // e.g. ":8443", serves the API with client certificates, see MtlsConfig
+	MtlsCertFile           string        `json:"mtlsCertFile,omitempty"`           // server certificate of the mtlsAddr listener
+	MtlsKeyFile            string        `json:"mtlsKeyFile,omitempty"`            // its private key
+	MtlsClientCaFile       string        `json:"mtlsClientCaFile,omitempty"`       // CA client certificates must be issued by
+}
+
+// GetUnknownRepoPolicy returns the configured unknown repository policy, defaulting to allow-owner.
+func (cfg Config) GetUnknownRepoPolicy() string {
+	if cfg.UnknownRepoPolicy == "" {
+		return UnknownRepoPolicyAllowOwner
+	}
+	return cfg.UnknownRepoPolicy
+}
+
+// GetAllowFilter reports whether repositories serve partial clones like
+// --filter=blob:none, defaulting to true.
+func (cfg Config) GetAllowFilter() bool {
+	return cfg.AllowFilter == nil || *cfg.AllowFilter
+}
+
+// GetPathLayout returns the layout of repositoryDir, defaulting to nested.
+func (cfg Config) GetPathLayout() string {
+	if cfg.PathLayout == "" {
+		return PathLayoutNested
+	}
+	return cfg.PathLayout
+}
+
+// GetUnknownKinds returns what to do with events of unhandled kinds, defaulting to ignore.
+func (cfg Config) GetUnknownKinds() string {
+	if cfg.UnknownKinds == "" {
+		return UnknownKindsIgnore
+	}
+	return cfg.UnknownKinds
+}
+
+// GetRelayConnectTimeout returns how long to wait for a single relay to connect, defaulting to 10s.
+func (cfg Config) GetRelayConnectTimeout() time.Duration {
+	if cfg.RelayConnectTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return cfg.RelayConnectTimeout.Duration()
+}
+
+// GetGitTimeout returns how long a git subprocess may run, defaulting to DefaultGitTimeout.
+func (cfg Config) GetGitTimeout() time.Duration {
+	if cfg.GitTimeout <= 0 {
+		return DefaultGitTimeout
+	}
+	return cfg.GitTimeout.Duration()
+}
+
+// GetMaxConcurrentClones returns how many git clones may run at once, defaulting to 2.
+func (cfg Config) GetMaxConcurrentClones() int {
+	if cfg.MaxConcurrentClones <= 0 {
+		return 2
+	}
+	return cfg.MaxConcurrentClones
+}
+
+// GetMaxBundleSize returns the largest bundle the bridge downloads, defaulting to 1 GiB.
+func (cfg Config) GetMaxBundleSize() int64 {
+	if cfg.MaxBundleSize <= 0 {
+		return DefaultMaxBundleSize
+	}
+	return cfg.MaxBundleSize
+}
+
+// GetHttpReadHeaderTimeout returns how long the HTTP server waits for a request's headers, defaulting to 10s.
+func (cfg Config) GetHttpReadHeaderTimeout() time.Duration {
+	if cfg.HttpReadHeaderTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return cfg.HttpReadHeaderTimeout.Duration()
+}
+
+// GetHttpReadTimeout returns how long the HTTP server waits for a whole request, defaulting to 1m.
+func (cfg Config) GetHttpReadTimeout() time.Duration {
+	if cfg.HttpReadTimeout <= 0 {
+		return time.Minute
+	}
+	return cfg.HttpReadTimeout.Duration()
+}
+
+// GetHttpWriteTimeout returns how long the HTTP server may take to write a response,
+// defaulting to 5m, which leaves room for ?ack=1 and dumb HTTP pack downloads.
+func (cfg Config) GetHttpWriteTimeout() time.Duration {
+	if cfg.HttpWriteTimeout <= 0 {
+		return 5 * time.Minute
+	}
+	return cfg.HttpWriteTimeout.Duration()
+}
+
+// GetHttpIdleTimeout returns how long idle keep-alive connections stay open, defaulting to 2m.
+func (cfg Config) GetHttpIdleTimeout() time.Duration {
+	if cfg.HttpIdleTimeout <= 0 {
+		return 2 * time.Minute
+	}
+	return cfg.HttpIdleTimeout.Duration()
+}
+
+// GetHttpMaxConnections returns how many HTTP connections may be open at once, defaulting to 1000.
+func (cfg Config) GetHttpMaxConnections() int {
+	if cfg.HttpMaxConnections <= 0 {
+		return 1000
+	}
+	return cfg.HttpMaxConnections
+}
+
+// GetDebounceWindow returns how long ssh key and permission changes are collected
+// before authorized_keys is rebuilt or the subscription renewed, defaulting to 2s.
+func (cfg Config) GetDebounceWindow() time.Duration {
+	if cfg.DebounceWindow <= 0 {
+		return 2 * time.Second
+	}
+	return cfg.DebounceWindow.Duration()
+}
+
+// GetFailedEventRetention returns how long an event that failed processing is kept
+// after its last failure, defaulting to 30 days.
+func (cfg Config) GetFailedEventRetention() time.Duration {
+	if cfg.FailedEventRetention <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return cfg.FailedEventRetention.Duration()
+}
+
+// GetMaxFilterAuthors returns how many authors a single relay subscription may list, defaulting to 250.
+func (cfg Config) GetMaxFilterAuthors() int {
+	if cfg.MaxFilterAuthors <= 0 {
+		return 250
+	}
+	return cfg.MaxFilterAuthors
+}
+
+// GetLeaseTtl returns how long a leader lease lasts without renewal, defaulting to 30s.
+func (cfg Config) GetLeaseTtl() time.Duration {
+	if cfg.LeaseTtl <= 0 {
+		return 30 * time.Second
+	}
+	return cfg.LeaseTtl.Duration()
+}
+
+// GetInstanceName returns the name this instance holds the leader lease under,
+// defaulting to <hostname>:<pid>.
+func (cfg Config) GetInstanceName() string {
+	if cfg.InstanceName != "" {
+		return cfg.InstanceName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// ValidateCloneRefspecs checks that every cloneRefspecs and mirrorRefs entry is a
+// full ref or a prefix ending in "*", see IsValidRefPattern.
+func (cfg Config) ValidateCloneRefspecs() error {
+	for _, pattern := range cfg.CloneRefspecs {
+		if !IsValidRefPattern(pattern) {
+			return fmt.Errorf("cloneRefspecs entry must be a ref like refs/heads/main or refs/heads/release/*: %q", pattern)
+		}
+	}
+	for _, pattern := range cfg.MirrorRefs {
+		if !IsValidRefPattern(pattern) {
+			return fmt.Errorf("mirrorRefs entry must be a ref like refs/heads/main or refs/heads/release/*: %q", pattern)
+		}
+	}
+	return nil
+}
+
+// ImportRefspecs returns the refs fetched when importing a repository: cloneRefspecs,
+// or mirrorRefs since the others would be pruned anyway, or nil for all of them.
+func (cfg Config) ImportRefspecs() []string {
+	if len(cfg.CloneRefspecs) > 0 {
+		return cfg.CloneRefspecs
+	}
+	return cfg.MirrorRefs
+}
+
+// GetSizeSweepInterval returns how often repository sizes not refreshed by a push or
+// gc are recomputed, defaulting to 6h.
+func (cfg Config) GetSizeSweepInterval() time.Duration {
+	if cfg.SizeSweepInterval <= 0 {
+		return 6 * time.Hour
+	}
+	return cfg.SizeSweepInterval.Duration()
+}
+
+// GetMaxFutureSkew returns how far in the future an event's created_at may lie, defaulting to 15m.
+func (cfg Config) GetMaxFutureSkew() time.Duration {
+	if cfg.MaxFutureSkew <= 0 {
+		return 15 * time.Minute
+	}
+	return cfg.MaxFutureSkew.Duration()
 }
 
 func getConfigFilePath(resolvedConfigDir string) string {
 	return filepath.Join(resolvedConfigDir, "git-nostr-bridge.json")
 }
 
+// DefaultConfig returns the settings used for anything the config file leaves out.
+func DefaultConfig() Config {
+	return Config{
+		RepositoryDir: "~/git-nostr-repositories",
+		DbFile:        "~/.config/git-nostr/git-nostr-db.sqlite",
+		Relays:        []RelayConfig{},
+		GitRepoOwners: []string{},
+	}
+}
+
+// LoadConfig reads the config file on top of DefaultConfig. A missing file is
+// created with the defaults.
 func LoadConfig(configDir string) (Config, error) {
 
 	resolvedConfigDir, err := gitnostr.ResolvePath(configDir)
@@ -35,13 +306,8 @@ func LoadConfig(configDir string) (Config, error) {
 	configFile, err := os.Open(configPath)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			cfg := Config{
-				ConfigDir:     configDir,
-				RepositoryDir: "~/git-nostr-repositories",
-				DbFile:        "~/.config/git-nostr/git-nostr-db.sqlite",
-				Relays:        []string{},
-				GitRepoOwners: []string{},
-			}
+			cfg := DefaultConfig()
+			cfg.ConfigDir = configDir
 			err = SaveConfig(cfg)
 			if err != nil {
 				return Config{}, fmt.Errorf("load config initialize : %w", err)
@@ -53,12 +319,137 @@ func LoadConfig(configDir string) (Config, error) {
 	}
 	defer configFile.Close()
 
-	cfg := Config{
-		ConfigDir: resolvedConfigDir,
-	}
+	cfg := DefaultConfig()
 	err = json.NewDecoder(configFile).Decode(&cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("load config %v : %w", configPath, err)
+	}
+	cfg.ConfigDir = resolvedConfigDir
+
+	// Explicitly empty values are treated like missing ones
+	defaults := DefaultConfig()
+	if cfg.RepositoryDir == "" {
+		cfg.RepositoryDir = defaults.RepositoryDir
+	}
+	if cfg.DbFile == "" {
+		cfg.DbFile = defaults.DbFile
+	}
+	if cfg.Relays == nil {
+		cfg.Relays = defaults.Relays
+	}
+	if cfg.GitRepoOwners == nil {
+		cfg.GitRepoOwners = defaults.GitRepoOwners
+	}
+
+	return cfg, nil
+}
+
+// RepoPath returns the on-disk path of the owner's bare repository in the configured
+// pathLayout. owner is a hex pubkey or npub.
+func (cfg Config) RepoPath(owner, repoName string) (string, error) {
+	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	if err != nil {
+		return "", fmt.Errorf("resolve repos path : %w", err)
+	}
+	ownerPubKey, err := gitnostr.DecodePubKey(owner)
+	if err != nil {
+		return "", err
+	}
+	layout, err := LookupPathLayout(cfg.GetPathLayout())
+	if err != nil {
+		return "", err
+	}
+	return layout.RepoPath(reposDir, ownerPubKey, repoName)
+}
+
+// OwnerDirs reports whether the pathLayout keeps each owner's repositories in one
+// directory below repositoryDir, which the npub symlinks and HTTPS git rely on.
+func (cfg Config) OwnerDirs() bool {
+	return cfg.GetPathLayout() == PathLayoutNested
+}
 
-	return cfg, err
+// Validate reports the first setting that would keep the bridge from running.
+func (cfg Config) Validate() error {
+	if cfg.RepositoryDir == "" {
+		return fmt.Errorf("repositoryDir is not set")
+	}
+	if cfg.DbFile == "" {
+		return fmt.Errorf("DbFile is not set")
+	}
+	if len(cfg.Relays) == 0 {
+		return fmt.Errorf("no relays configured")
+	}
+	readRelays := 0
+	for _, relay := range cfg.Relays {
+		if relay.URL == "" {
+			return fmt.Errorf("relay without url configured")
+		}
+		if relay.Read {
+			readRelays++
+		}
+	}
+	if readRelays == 0 {
+		return fmt.Errorf("no relay is configured for reading")
+	}
+	if _, err := cfg.ProxyURL(); err != nil {
+		return err
+	}
+	if cfg.RelayListPubKey != "" {
+		if _, err := gitnostr.DecodePubKey(cfg.RelayListPubKey); err != nil {
+			return fmt.Errorf("relayListPubKey must be a hex or npub public key: %w", err)
+		}
+	}
+	for _, relay := range cfg.Relays {
+		if cfg.Proxy == "" && IsOnionURL(relay.URL) {
+			return fmt.Errorf("relay %v is a .onion address, set proxy to a Tor SOCKS5 proxy", relay.URL)
+		}
+	}
+	switch cfg.GetUnknownRepoPolicy() {
+	case UnknownRepoPolicyDeny, UnknownRepoPolicyPublicRead, UnknownRepoPolicyAllowOwner:
+	default:
+		return fmt.Errorf("unknownRepoPolicy must be %v, %v or %v: %v", UnknownRepoPolicyDeny, UnknownRepoPolicyPublicRead, UnknownRepoPolicyAllowOwner, cfg.UnknownRepoPolicy)
+	}
+	if cfg.MtlsEnabled() {
+		if _, err := cfg.MtlsConfig(); err != nil {
+			return err
+		}
+	}
+	if _, err := LookupPathLayout(cfg.GetPathLayout()); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(cfg.RepoNamePattern); err != nil {
+		return fmt.Errorf("invalid repoNamePattern : %w", err)
+	}
+	switch cfg.GetUnknownKinds() {
+	case UnknownKindsIgnore, UnknownKindsLog, UnknownKindsStore:
+	default:
+		return fmt.Errorf("unknownKinds must be one of %v, %v or %v: %v", UnknownKindsIgnore, UnknownKindsLog, UnknownKindsStore, cfg.UnknownKinds)
+	}
+	switch cfg.GetAuthorizedKeysMode() {
+	case AuthorizedKeysModeFile, AuthorizedKeysModeCommand:
+	default:
+		return fmt.Errorf("authorizedKeysMode must be %v or %v: %v", AuthorizedKeysModeFile, AuthorizedKeysModeCommand, cfg.AuthorizedKeysMode)
+	}
+	switch cfg.GetGitProtocol() {
+	case GitProtocolV2, GitProtocolV1, GitProtocolV0:
+	default:
+		return fmt.Errorf("gitProtocol must be %v, %v or %v: %v", GitProtocolV2, GitProtocolV1, GitProtocolV0, cfg.GitProtocol)
+	}
+	if err := cfg.ValidateWatchKinds(); err != nil {
+		return err
+	}
+	if err := cfg.ValidateStrictSignatureKinds(); err != nil {
+		return err
+	}
+	if err := cfg.ValidateCloneRefspecs(); err != nil {
+		return err
+	}
+	for _, owner := range cfg.GitRepoOwners {
+		if _, err := hex.DecodeString(owner); err != nil || len(owner) != 64 {
+			return fmt.Errorf("gitRepoOwners entry is not a hex pubkey: %v", owner)
+		}
+	}
+	return nil
 }
 
 func SaveConfig(cfg Config) error {
@@ -2,10 +2,12 @@ package bridge
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/arbadacarbaYK/gitnostr"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 func OpenDb(dbFilePath string) (*sql.DB, error) {
@@ -15,16 +17,13 @@ func OpenDb(dbFilePath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("open db resolve %v : %w", dbFilePath, err)
 	}
 
-	db, err := sql.Open("sqlite", resolvedDbFilePath)
+	// The busy timeout is set in the DSN so every pooled connection gets it, not
+	// just the one that happens to run a PRAGMA statement.
+	db, err := sql.Open("sqlite", resolvedDbFilePath+"?_pragma=busy_timeout(500)")
 	if err != nil {
 		return nil, fmt.Errorf("open db %v : %w", resolvedDbFilePath, err)
 	}
 
-	_, err = db.Exec("PRAGMA busy_timeout = 500;")
-	if err != nil {
-		return nil, fmt.Errorf("open db set timeout %v : %w", resolvedDbFilePath, err)
-	}
-
 	err = applyMigrations(db)
 	if err != nil {
 		return nil, err
@@ -32,3 +31,30 @@ func OpenDb(dbFilePath string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// IsTransientDbError reports whether err is SQLite being busy or locked by another
+// connection, which goes away once that connection is done, unlike a full disk or a
+// broken schema.
+func IsTransientDbError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// Extended result codes like SQLITE_BUSY_SNAPSHOT keep the primary code in the low byte
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+// BackupDb writes a consistent copy of the database to destPath, which must not
+// exist yet. VACUUM INTO reads inside a single transaction, so it is safe while the
+// bridge and git-nostr-ssh keep writing.
+func BackupDb(db *sql.DB, destPath string) error {
+	_, err := db.Exec("VACUUM INTO ?", destPath)
+	if err != nil {
+		return fmt.Errorf("backup db to %v : %w", destPath, err)
+	}
+	return nil
+}
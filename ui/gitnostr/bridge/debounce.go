@@ -0,0 +1,36 @@
+package bridge
+
+import (
+	"sync"
+	"time"
+)
+
+// debouncer runs fn once per window no matter how often it is triggered within it:
+// the first trigger starts the window, fn runs when it ends and sees every change
+// made until then.
+type debouncer struct {
+	window time.Duration
+	fn     func()
+
+	mu      sync.Mutex
+	pending bool
+}
+
+func newDebouncer(window time.Duration, fn func()) *debouncer {
+	return &debouncer{window: window, fn: fn}
+}
+
+func (d *debouncer) trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending {
+		return
+	}
+	d.pending = true
+	time.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		d.pending = false
+		d.mu.Unlock()
+		d.fn()
+	})
+}
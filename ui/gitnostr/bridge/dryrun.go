@@ -0,0 +1,272 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// dryRunPlan collects the actions of a dry run for its summary.
+type dryRunPlan struct {
+	mutex   sync.Mutex
+	actions []string
+}
+
+func (p *dryRunPlan) add(format string, args ...any) {
+	action := fmt.Sprintf(format, args...)
+	log.Printf("🧪 [Bridge] dry-run: would %s\n", action)
+
+	p.mutex.Lock()
+	p.actions = append(p.actions, action)
+	p.mutex.Unlock()
+}
+
+// printSummary lists every action planned so far.
+func (p *dryRunPlan) printSummary() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	fmt.Printf("dry-run summary: %d actions\n", len(p.actions))
+	for _, action := range p.actions {
+		fmt.Printf("  - %s\n", action)
+	}
+}
+
+// eventPlan is what processEvent would do with an event: the actions it would take
+// and the problems that would make it skip the event or parts of it.
+type eventPlan struct {
+	Actions  []string `json:"actions"`
+	Problems []string `json:"problems"`
+}
+
+func (p *eventPlan) action(format string, args ...any) {
+	p.Actions = append(p.Actions, fmt.Sprintf(format, args...))
+}
+
+func (p *eventPlan) problem(format string, args ...any) {
+	p.Problems = append(p.Problems, fmt.Sprintf(format, args...))
+}
+
+// recordPlan logs a plan made in dry-run mode and adds its actions to the summary.
+func (s *Server) recordPlan(event nostr.Event, plan *eventPlan) {
+	for _, problem := range plan.Problems {
+		log.Printf("🧪 [Bridge] dry-run: would skip event %s: %s\n", event.ID, problem)
+	}
+	for _, action := range plan.Actions {
+		s.dryRun.add("%s", action)
+	}
+}
+
+// planEvent is the dry-run counterpart of processEvent. It only reads the database
+// and the repository directory.
+func planEvent(event nostr.Event, db *sql.DB, cfg Config) *eventPlan {
+	plan := &eventPlan{}
+	switch event.Kind {
+	case protocol.KindRepository, protocol.KindRepositoryNIP34:
+		planRepositoryEvent(plan, event, db, cfg)
+
+	case protocol.KindRepositoryPermission:
+		var perm protocol.RepositoryPermission
+		if err := json.Unmarshal([]byte(event.Content), &perm); err != nil {
+			plan.problem("malformed permission: %v", err)
+			break
+		}
+		if !IsValidRepoName(perm.RepositoryName) {
+			plan.problem("invalid repository name %q", perm.RepositoryName)
+			break
+		}
+		if err := protocol.ValidatePermission(perm.Permission); err != nil {
+			plan.problem("%v", err)
+			break
+		}
+		target := strings.ToLower(perm.TargetPubKey)
+		if perm.TargetGroup != "" {
+			if !IsValidGroupName(perm.TargetGroup) {
+				plan.problem("invalid group name %q", perm.TargetGroup)
+				break
+			}
+			target = "group " + perm.TargetGroup
+		}
+		plan.action("grant %s on %s/%s to %s", perm.Permission, event.PubKey, perm.RepositoryName, target)
+
+	case protocol.KindRepositoryHook:
+		var hook protocol.RepositoryHook
+		if err := json.Unmarshal([]byte(event.Content), &hook); err != nil {
+			plan.problem("malformed repository hook: %v", err)
+			break
+		}
+		if !IsValidRepoName(hook.RepositoryName) {
+			plan.problem("invalid repository name %q", hook.RepositoryName)
+			break
+		}
+		if hook.Url != "" {
+			if err := ValidateHookURL(hook.Url); err != nil {
+				plan.problem("invalid hook url: %v", err)
+				break
+			}
+		}
+		plan.action("set post-receive hook of %s/%s to %q", event.PubKey, hook.RepositoryName, hook.Url)
+
+	case protocol.KindGroup:
+		var group protocol.Group
+		if err := json.Unmarshal([]byte(event.Content), &group); err != nil {
+			plan.problem("malformed group: %v", err)
+			break
+		}
+		if !IsValidGroupName(group.GroupName) {
+			plan.problem("invalid group name %q", group.GroupName)
+			break
+		}
+		plan.action("set %d members of group %s/%s", len(group.Members), event.PubKey, group.GroupName)
+
+	case protocol.KindSshKey:
+		plan.action("store ssh key of %s and rewrite authorized_keys", event.PubKey)
+
+	case protocol.KindGitIdentity:
+		plan.action("replace git identity emails of %s", event.PubKey)
+
+	case protocol.KindRepositoryState:
+		repoName := ""
+		refs := 0
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "d" && repoName == "" {
+				repoName = tag[1]
+			} else if len(tag) >= 2 && (strings.HasPrefix(tag[0], "refs/") || tag[0] == "HEAD") {
+				refs++
+			}
+		}
+		if !IsValidRepoName(repoName) {
+			plan.problem("invalid repository name %q in the d tag", repoName)
+			break
+		}
+		if refs == 0 {
+			plan.problem("state event without refs or HEAD")
+			break
+		}
+		plan.action("update refs of %s/%s from state event %s", event.PubKey, repoName, event.ID)
+
+	case protocol.KindStatusOpen, protocol.KindStatusApplied, protocol.KindStatusClosed, protocol.KindStatusDraft:
+		status, err := protocol.ParseStatus(event)
+		if err != nil {
+			plan.problem("malformed status: %v", err)
+			break
+		}
+		for _, repo := range status.Repositories {
+			plan.action("record status %s of %s on %s/%s", status.Status, status.TargetEventID, repo.PubKey, repo.Identifier)
+		}
+
+	case protocol.KindComment, protocol.KindTextNote:
+		comment, err := protocol.ParseComment(event)
+		if err != nil {
+			plan.problem("malformed comment: %v", err)
+			break
+		}
+		for _, repo := range comment.Repositories {
+			plan.action("store comment %s on %s in %s/%s", event.ID, comment.RootEventID, repo.PubKey, repo.Identifier)
+		}
+
+	case protocol.KindReaction:
+		reaction, err := protocol.ParseReaction(event)
+		if err != nil {
+			plan.problem("malformed reaction: %v", err)
+			break
+		}
+		target := reaction.TargetEventID
+		if target == "" {
+			target = "the repository"
+		}
+		repos := reaction.Repositories
+		if len(repos) == 0 {
+			if repos, err = repositoriesOfEvent(db, reaction.TargetEventID); err != nil {
+				plan.problem("%v", err)
+				break
+			}
+		}
+		if len(repos) == 0 {
+			plan.problem("no known repository has issue or patch %s", reaction.TargetEventID)
+		}
+		for _, repo := range repos {
+			plan.action("record reaction %q of %s to %s in %s/%s", reaction.Content, event.PubKey, target, repo.PubKey, repo.Identifier)
+		}
+
+	default:
+		plan.problem("kind %d is not handled by the bridge", event.Kind)
+	}
+	return plan
+}
+
+func planRepositoryEvent(plan *eventPlan, event nostr.Event, db *sql.DB, cfg Config) {
+	announcement, err := parseRepositoryEvent(event)
+	if err != nil {
+		plan.problem("repository event: %v", err)
+		return
+	}
+	repoName := announcement.repoName
+	if !IsValidRepoName(repoName) {
+		plan.problem("invalid repository name %q", repoName)
+		return
+	}
+
+	var updatedAt int64
+	err = db.QueryRow("SELECT UpdatedAt FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", event.PubKey, repoName).Scan(&updatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		plan.problem("failed to query repository %s/%s: %v", event.PubKey, repoName, err)
+		return
+	}
+	known := err == nil
+	if !known && !cfg.IsValidRepoName(repoName) {
+		plan.problem("repository name %q doesn't match repoNamePattern", repoName)
+		return
+	}
+
+	repoPath, err := cfg.RepoPath(event.PubKey, repoName)
+	if err != nil {
+		plan.problem("%v", err)
+		return
+	}
+
+	if announcement.repo.Deleted {
+		if grace := cfg.DeleteGracePeriod.Duration(); grace > 0 {
+			plan.action("delete repository %s/%s and move %s to %s for %v", event.PubKey, repoName, repoPath, TrashDirName, grace)
+		} else {
+			plan.action("delete repository %s/%s and remove %s", event.PubKey, repoName, repoPath)
+		}
+		return
+	}
+
+	if known && updatedAt >= event.CreatedAt.Unix() {
+		plan.problem("stale announcement, the stored one of %s/%s is newer", event.PubKey, repoName)
+	} else if known {
+		plan.action("update repository %s/%s (publicRead=%v publicWrite=%v)", event.PubKey, repoName, announcement.repo.PublicRead, announcement.repo.PublicWrite)
+	} else {
+		plan.action("add repository %s/%s (publicRead=%v publicWrite=%v)", event.PubKey, repoName, announcement.repo.PublicRead, announcement.repo.PublicWrite)
+	}
+
+	for _, maintainer := range announcement.maintainers {
+		if !strings.EqualFold(maintainer, event.PubKey) {
+			plan.action("grant WRITE on %s/%s to maintainer %s", event.PubKey, repoName, maintainer)
+		}
+	}
+
+	if _, err := os.Stat(repoPath); err == nil {
+		return
+	}
+	switch {
+	case announcement.sourceUrl != "":
+		plan.action("clone %s into %s (falling back to clone urls, bundles or an empty repo)", announcement.sourceUrl, repoPath)
+	case len(announcement.cloneUrls) > 0:
+		plan.action("clone %s into %s (falling back to bundles or an empty repo)", announcement.cloneUrls[0], repoPath)
+	case len(announcement.bundles) > 0:
+		plan.action("import bundle %s into %s (falling back to an empty repo)", announcement.bundles[0].URL, repoPath)
+	default:
+		plan.action("create empty bare repository %s with HEAD on %s", repoPath, announcement.repo.GetDefaultBranch())
+	}
+}
@@ -0,0 +1,93 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+// dumbHttpFiles are the repository files a dumb HTTP client may fetch. Anything
+// else in the bare repo (config, hooks, lock files) is never served.
+var dumbHttpFiles = regexp.MustCompile(`^(HEAD|info/refs|objects/info/packs|objects/[0-9a-f]{2}/[0-9a-f]{38}|objects/pack/pack-[0-9a-f]{40}\.(pack|idx))$`)
+
+// handleDumbHttp serves /git/{owner}/{repo}.git/{file} for publicly readable
+// repositories using git's dumb HTTP protocol.
+func handleDumbHttp(db *sql.DB, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/git/"), "/", 3)
+		if len(parts) != 3 || !strings.HasSuffix(parts[1], ".git") || !dumbHttpFiles.MatchString(parts[2]) {
+			http.NotFound(w, r)
+			return
+		}
+
+		ownerPubKey, err := gitnostr.DecodePubKey(parts[0])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		repoName := strings.TrimSuffix(parts[1], ".git")
+		if !IsValidRepoName(repoName) {
+			http.NotFound(w, r)
+			return
+		}
+
+		var publicRead bool
+		err = db.QueryRow("SELECT PublicRead FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&publicRead)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("❌ [Bridge HTTP] Failed to query repository %s/%s: %v\n", ownerPubKey, repoName, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || !publicRead {
+			http.NotFound(w, r)
+			return
+		}
+
+		repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		file, err := os.Open(filepath.Join(repoPath, filepath.FromSlash(parts[2])))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil || stat.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(parts[2], "objects/") && parts[2] != "objects/info/packs":
+			// Objects and packs are immutable
+			w.Header().Set("Content-Type", "application/x-git-loose-object")
+			if strings.HasSuffix(parts[2], ".pack") {
+				w.Header().Set("Content-Type", "application/x-git-packed-objects")
+			} else if strings.HasSuffix(parts[2], ".idx") {
+				w.Header().Set("Content-Type", "application/x-git-packed-objects-toc")
+			}
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		http.ServeContent(w, r, "", stat.ModTime(), file)
+	}
+}
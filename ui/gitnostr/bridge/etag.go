@@ -0,0 +1,31 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagOf returns an entity tag derived from parts, for responses without a natural one.
+func etagOf(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(hash[:16])
+}
+
+// notModified sets a weak ETag of tag on the response and reports whether the
+// request's If-None-Match already names it. It then writes 304 Not Modified and the
+// handler is done. The tag is weak because compression changes the bytes sent.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	etag := `W/"` + tag + `"`
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MaxFailedEventRetries is how often a failed event can be retried before it is given up on.
+const MaxFailedEventRetries = 5
+
+// FailedEvent is an event processEvent failed on, kept for inspection and retries.
+type FailedEvent struct {
+	EventId        string      `json:"eventId"`
+	Kind           int         `json:"kind"`
+	PubKey         string      `json:"pubkey"`
+	Error          string      `json:"error"`
+	Retries        int         `json:"retries"`
+	RetryRequested bool        `json:"retryRequested"`
+	FirstFailedAt  int64       `json:"firstFailedAt"`
+	LastFailedAt   int64       `json:"lastFailedAt"`
+	Event          nostr.Event `json:"event"`
+}
+
+// RecordFailedEvent stores event and the error processing it failed with. An event
+// failing again keeps its retry count. Entries older than the failedEventRetention
+// are dropped on the way.
+func RecordFailedEvent(db *sql.DB, cfg Config, event nostr.Event, processErr error) error {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal failed event : %w", err)
+	}
+	now := time.Now()
+	_, err = db.Exec("INSERT INTO FailedEvent (EventId,Kind,PubKey,Event,Error,Retries,RetryRequested,FirstFailedAt,LastFailedAt) VALUES (?,?,?,?,?,0,0,?,?) ON CONFLICT DO UPDATE SET Error=?,RetryRequested=0,LastFailedAt=?", event.ID, event.Kind, event.PubKey, string(raw), processErr.Error(), now.Unix(), now.Unix(), processErr.Error(), now.Unix())
+	if err != nil {
+		return fmt.Errorf("record failed event : %w", err)
+	}
+	_, err = db.Exec("DELETE FROM FailedEvent WHERE LastFailedAt<?", now.Add(-cfg.GetFailedEventRetention()).Unix())
+	if err != nil {
+		return fmt.Errorf("age out failed events : %w", err)
+	}
+	return nil
+}
+
+// ListFailedEvents returns the most recently failed events first, at most limit.
+func ListFailedEvents(db *sql.DB, limit int) ([]FailedEvent, error) {
+	rows, err := db.Query("SELECT EventId,Kind,PubKey,Event,Error,Retries,RetryRequested,FirstFailedAt,LastFailedAt FROM FailedEvent ORDER BY LastFailedAt DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed events : %w", err)
+	}
+	defer rows.Close()
+
+	var events []FailedEvent
+	for rows.Next() {
+		var f FailedEvent
+		var raw string
+		if err := rows.Scan(&f.EventId, &f.Kind, &f.PubKey, &raw, &f.Error, &f.Retries, &f.RetryRequested, &f.FirstFailedAt, &f.LastFailedAt); err != nil {
+			return nil, fmt.Errorf("scan failed event : %w", err)
+		}
+		if err := json.Unmarshal([]byte(raw), &f.Event); err != nil {
+			return nil, fmt.Errorf("decode failed event %s : %w", f.EventId, err)
+		}
+		events = append(events, f)
+	}
+	return events, rows.Err()
+}
+
+// RequestFailedEventRetries asks the bridge to process the failed events again, all
+// of them or only eventId, except those already retried MaxFailedEventRetries times.
+// It returns how many retries were requested.
+func RequestFailedEventRetries(db *sql.DB, eventId string) (int64, error) {
+	query := "UPDATE FailedEvent SET RetryRequested=1 WHERE Retries<?"
+	args := []any{MaxFailedEventRetries}
+	if eventId != "" {
+		query += " AND EventId=?"
+		args = append(args, eventId)
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("request failed event retries : %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// quarantine records an event processEvent failed on, see RecordFailedEvent.
+func (s *Server) quarantine(event nostr.Event, processErr error) {
+	if err := RecordFailedEvent(s.db, s.cfg, event, processErr); err != nil {
+		log.Printf("⚠️ [Bridge] %v\n", err)
+	}
+}
+
+// runFailedEventRetrier hands the failed events a retry was requested for back to
+// the relay loop every 30 seconds.
+func (s *Server) runFailedEventRetrier(ctx context.Context) {
+	for {
+		s.retryFailedEvents()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+func (s *Server) retryFailedEvents() {
+	rows, err := s.db.Query("SELECT EventId,Event FROM FailedEvent WHERE RetryRequested=1")
+	if err != nil {
+		log.Printf("⚠️ [Bridge] failed event retry: failed to query events: %v\n", err)
+		return
+	}
+	var events []nostr.Event
+	for rows.Next() {
+		var eventId, raw string
+		var event nostr.Event
+		if err := rows.Scan(&eventId, &raw); err != nil {
+			log.Printf("⚠️ [Bridge] failed event retry: failed to scan event: %v\n", err)
+			rows.Close()
+			return
+		}
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			log.Printf("⚠️ [Bridge] failed event retry: failed to decode event %s: %v\n", eventId, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+
+	for _, event := range events {
+		_, err := s.db.Exec("UPDATE FailedEvent SET RetryRequested=0,Retries=Retries+1 WHERE EventId=?", event.ID)
+		if err != nil {
+			log.Printf("⚠️ [Bridge] failed event retry: failed to update event %s: %v\n", event.ID, err)
+			continue
+		}
+		s.retryMutex.Lock()
+		s.retrying[event.ID] = true
+		s.retryMutex.Unlock()
+		log.Printf("🔁 [Bridge] Retrying failed event: kind=%d id=%s\n", event.Kind, event.ID)
+		s.directEvents <- event
+	}
+}
+
+// finishRetry drops a retried event from the failed events unless it failed again.
+func (s *Server) finishRetry(eventId string, failed bool) {
+	s.retryMutex.Lock()
+	retrying := s.retrying[eventId]
+	delete(s.retrying, eventId)
+	s.retryMutex.Unlock()
+	if !retrying || failed {
+		return
+	}
+	if _, err := s.db.Exec("DELETE FROM FailedEvent WHERE EventId=?", eventId); err != nil {
+		log.Printf("⚠️ [Bridge] Failed to remove retried event %s: %v\n", eventId, err)
+		return
+	}
+	log.Printf("✅ [Bridge] Failed event %s processed on retry\n", eventId)
+}
@@ -0,0 +1,157 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// runGcScheduler periodically runs `git gc --auto` on every repository that was
+// pushed to since its last gc. Repositories that are being written to are skipped
+// and picked up again on the next round.
+func runGcScheduler(ctx context.Context, db *sql.DB, cfg Config) {
+	interval := cfg.GcInterval.Duration()
+	if interval <= 0 {
+		return
+	}
+	concurrency := cfg.GcConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	log.Printf("🧹 [Bridge] gc scheduler enabled: interval=%s concurrency=%d\n", interval, concurrency)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			gcPushedRepos(db, cfg, concurrency)
+		}
+	}
+}
+
+func gcPushedRepos(db *sql.DB, cfg Config, concurrency int) {
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName FROM RepositoryStats WHERE LastPushAt>LastGcAt")
+	if err != nil {
+		log.Printf("⚠️ [Bridge] gc: failed to query pushed repositories: %v\n", err)
+		return
+	}
+
+	type repoKey struct{ owner, name string }
+	var repos []repoKey
+	for rows.Next() {
+		var repo repoKey
+		if err := rows.Scan(&repo.owner, &repo.name); err != nil {
+			log.Printf("⚠️ [Bridge] gc: failed to scan repository: %v\n", err)
+			rows.Close()
+			return
+		}
+		repos = append(repos, repo)
+	}
+	rows.Close()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, repo := range repos {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(owner, name string) {
+			defer func() { <-sem; wg.Done() }()
+			gcRepo(db, cfg, owner, name)
+		}(repo.owner, repo.name)
+	}
+	wg.Wait()
+}
+
+func gcRepo(db *sql.DB, cfg Config, ownerPubKey, repoName string) {
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		log.Printf("⚠️ [Bridge] gc: %v\n", err)
+		return
+	}
+
+	unlock, err := TryLockRepoExclusive(repoPath)
+	if err != nil {
+		if !errors.Is(err, ErrRepoLocked) {
+			log.Printf("⚠️ [Bridge] gc: failed to lock %s/%s: %v\n", ownerPubKey, repoName, err)
+		}
+		return
+	}
+	defer unlock()
+
+	startedAt := time.Now().Unix()
+	before, _ := DirSize(repoPath)
+
+	output, err := cfg.Git("--git-dir", repoPath, "gc", "--auto", "--quiet").CombinedOutput()
+	if err != nil {
+		log.Printf("⚠️ [Bridge] gc failed for %s/%s: %v\n", ownerPubKey, repoName, err)
+		log.Printf("🔍 [Bridge] Git output: %s\n", string(output))
+		return
+	}
+
+	after, _ := DirSize(repoPath)
+	log.Printf("🧹 [Bridge] gc %s/%s: %d -> %d bytes (reclaimed %d)\n", ownerPubKey, repoName, before, after, before-after)
+
+	if cfg.BitmapMinSize > 0 && after >= cfg.BitmapMinSize {
+		repacked, err := writeFetchIndexes(repoPath, cfg)
+		if err != nil {
+			log.Printf("⚠️ [Bridge] gc: failed to write commit-graph and bitmaps for %s/%s: %v\n", ownerPubKey, repoName, err)
+		} else if repacked {
+			after, _ = DirSize(repoPath)
+			log.Printf("🧹 [Bridge] gc %s/%s: repacked with bitmaps, commit-graph written\n", ownerPubKey, repoName)
+		}
+	}
+
+	if err := StoreRepoSize(db, ownerPubKey, repoName, after); err != nil {
+		log.Printf("⚠️ [Bridge] gc: %v\n", err)
+	}
+
+	_, err = db.Exec("UPDATE RepositoryStats SET LastGcAt=? WHERE OwnerPubKey=? AND RepositoryName=?", startedAt, ownerPubKey, repoName)
+	if err != nil {
+		log.Printf("⚠️ [Bridge] gc: failed to record gc time for %s/%s: %v\n", ownerPubKey, repoName, err)
+	}
+}
+
+// writeFetchIndexes gives a large repository a reachability bitmap and a commit-graph,
+// which let upload-pack find the objects of a clone or fetch without walking the
+// history. The bitmap only covers one pack, so the repository is repacked into a
+// single bitmapped pack when it has none yet or a push added another pack; objects
+// of pushes small enough to be unpacked loose wait until gc --auto packs them. The
+// caller must hold the exclusive repository lock.
+func writeFetchIndexes(repoPath string, cfg Config) (repacked bool, err error) {
+	packs, err := filepath.Glob(filepath.Join(repoPath, "objects", "pack", "*.pack"))
+	if err != nil {
+		return false, err
+	}
+	bitmaps, err := filepath.Glob(filepath.Join(repoPath, "objects", "pack", "*.bitmap"))
+	if err != nil {
+		return false, err
+	}
+
+	// Also keeps the bitmap when git gc --auto repacks everything itself
+	output, err := cfg.Git("--git-dir", repoPath, "config", "repack.writeBitmaps", "true").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("git config repack.writeBitmaps failed: %w: %s", err, output)
+	}
+	if len(packs) != 1 || len(bitmaps) == 0 {
+		output, err := cfg.Git("--git-dir", repoPath, "repack", "-a", "-d", "-q", "--write-bitmap-index").CombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("git repack failed: %w: %s", err, output)
+		}
+		repacked = true
+	}
+
+	output, err = cfg.Git("--git-dir", repoPath, "commit-graph", "write", "--reachable").CombinedOutput()
+	if err != nil {
+		return repacked, fmt.Errorf("git commit-graph write failed: %w: %s", err, output)
+	}
+	return repacked, nil
+}
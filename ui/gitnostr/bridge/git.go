@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type GitVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// MinGitVersion is the oldest git release the bridge is tested against.
+var MinGitVersion = GitVersion{Major: 2, Minor: 34}
+
+func (v GitVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v GitVersion) AtLeast(other GitVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+// ParseGitVersion parses the output of `git --version`, e.g. "git version 2.39.2 (Apple Git-143)".
+func ParseGitVersion(output string) (GitVersion, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return GitVersion{}, fmt.Errorf("unrecognized git version output: %q", strings.TrimSpace(output))
+	}
+
+	var version GitVersion
+	parts := strings.Split(fields[2], ".")
+	targets := []*int{&version.Major, &version.Minor, &version.Patch}
+	for i := 0; i < len(parts) && i < len(targets); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			if i < 2 {
+				return GitVersion{}, fmt.Errorf("unrecognized git version %q: %w", fields[2], err)
+			}
+			break // e.g. "2.45.rc0"
+		}
+		*targets[i] = n
+	}
+
+	return version, nil
+}
+
+// GetMinGitVersion returns the configured minimum git version, defaulting to MinGitVersion.
+func (cfg Config) GetMinGitVersion() (GitVersion, error) {
+	if cfg.MinGitVersion == "" {
+		return MinGitVersion, nil
+	}
+	version, err := ParseGitVersion("git version " + cfg.MinGitVersion)
+	if err != nil {
+		return GitVersion{}, fmt.Errorf("minGitVersion : %w", err)
+	}
+	return version, nil
+}
+
+func DetectGitVersion() (GitVersion, error) {
+	output, err := Git("--version").Output()
+	if err != nil {
+		return GitVersion{}, fmt.Errorf("git --version : %w", err)
+	}
+	return ParseGitVersion(string(output))
+}
+
+// UpdateServerInfo refreshes the files the dumb HTTP protocol serves (info/refs,
+// objects/info/packs). It has to run after every change to the repository's refs.
+func UpdateServerInfo(repoPath string) error {
+	output, err := Git("--git-dir", repoPath, "update-server-info").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git update-server-info failed: %w: %s", err, output)
+	}
+	return nil
+}
+
+// ResolveCommit returns the id of the commit rev names.
+func ResolveCommit(repoPath, rev string) (string, error) {
+	output, err := Git("--git-dir", repoPath, "rev-parse", "--verify", "-q", rev+"^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse %v failed: %w", rev, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ListRefs returns every ref of the repository mapped to the object it points to.
+func ListRefs(repoPath string) (map[string]string, error) {
+	output, err := Git("--git-dir", repoPath, "for-each-ref", "--format=%(refname) %(objectname)").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed: %w", err)
+	}
+
+	refs := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		name, object, found := strings.Cut(line, " ")
+		if found {
+			refs[name] = object
+		}
+	}
+	return refs, nil
+}
+
+// SymbolicHead returns the ref HEAD points to, or "" if HEAD is detached.
+func SymbolicHead(repoPath string) (string, error) {
+	output, err := Git("--git-dir", repoPath, "symbolic-ref", "-q", "HEAD").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("git symbolic-ref failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// UnbornHead reports the branch HEAD points to if it has no commit yet, as in a
+// repository created empty, and "" otherwise. branches lists the branches the
+// repository does have; none means nothing was pushed yet.
+func UnbornHead(repoPath string) (head string, branches []string, err error) {
+	head, err = SymbolicHead(repoPath)
+	if err != nil || head == "" || headRefTargetExists(repoPath, head) {
+		return "", nil, err
+	}
+	output, err := Git("--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/heads").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("git for-each-ref failed: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			branches = append(branches, line)
+		}
+	}
+	return head, branches, nil
+}
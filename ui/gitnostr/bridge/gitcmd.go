@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultGitTimeout bounds git subprocesses unless gitTimeout is configured.
+const DefaultGitTimeout = 15 * time.Minute
+
+// ErrGitTimeout is wrapped by the error of a git subprocess killed for taking longer
+// than the git timeout.
+var ErrGitTimeout = errors.New("git timed out")
+
+// GitCmd is a git subprocess that is killed once the git timeout passes. Its fields
+// (Dir, Env, Stdin, Stdout, Stderr) are set like those of exec.Cmd.
+type GitCmd struct {
+	*exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+// Git is exec.Command("git", args...) bounded by DefaultGitTimeout, so a git waiting on
+// the network, a lock or a prompt can't block its caller forever.
+func Git(args ...string) *GitCmd {
+	return GitTimeout(context.Background(), DefaultGitTimeout, args...)
+}
+
+// GitTimeout is like Git but bounded by timeout and also stops git when ctx is done.
+func GitTimeout(ctx context.Context, timeout time.Duration, args ...string) *GitCmd {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return &GitCmd{Cmd: exec.CommandContext(ctx, "git", args...), ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// Git is like the package Git but bounded by the configured gitTimeout.
+func (cfg Config) Git(args ...string) *GitCmd {
+	return GitTimeout(context.Background(), cfg.GetGitTimeout(), args...)
+}
+
+func (c *GitCmd) Run() error {
+	defer c.cancel()
+	return c.wrap(c.Cmd.Run())
+}
+
+func (c *GitCmd) Output() ([]byte, error) {
+	defer c.cancel()
+	output, err := c.Cmd.Output()
+	return output, c.wrap(err)
+}
+
+func (c *GitCmd) CombinedOutput() ([]byte, error) {
+	defer c.cancel()
+	output, err := c.Cmd.CombinedOutput()
+	return output, c.wrap(err)
+}
+
+func (c *GitCmd) wrap(err error) error {
+	if err != nil && errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v: git %s", ErrGitTimeout, c.timeout, strings.Join(c.Args[1:], " "))
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package bridge
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Values of gitProtocol, the newest git wire protocol git-nostr-ssh lets clients use.
+const (
+	GitProtocolV2 = "v2" // what the client asks for, including v2
+	GitProtocolV1 = "v1" // v2 requests fall back to v1
+	GitProtocolV0 = "v0" // the original protocol for everyone
+)
+
+// GitProtocolEnv is the variable git clients name the protocol versions they speak
+// in. Over ssh it only arrives if sshd has "AcceptEnv GIT_PROTOCOL".
+const GitProtocolEnv = "GIT_PROTOCOL"
+
+// GetGitProtocol returns the configured git protocol cap, defaulting to v2.
+func (cfg Config) GetGitProtocol() string {
+	if cfg.GitProtocol == "" {
+		return GitProtocolV2
+	}
+	return cfg.GitProtocol
+}
+
+// NegotiateGitProtocol returns the GIT_PROTOCOL value to run git with for a client
+// that sent clientProtocol: the newest version the client offers, lowered to the
+// gitProtocol cap, or "" to speak v0. Clients understand every version below the one
+// they offer. Other parameters of the client are dropped.
+func (cfg Config) NegotiateGitProtocol(clientProtocol string) string {
+	limit, _ := strconv.Atoi(strings.TrimPrefix(cfg.GetGitProtocol(), "v"))
+	version := 0
+	for _, param := range strings.Split(clientProtocol, ":") {
+		value, found := strings.CutPrefix(param, "version=")
+		if !found {
+			continue
+		}
+		if offered, err := strconv.Atoi(value); err == nil && offered > version {
+			version = offered
+		}
+	}
+	if version > limit {
+		version = limit
+	}
+	if version <= 0 {
+		return ""
+	}
+	return "version=" + strconv.Itoa(version)
+}
@@ -0,0 +1,75 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// handleGroupEvent replaces the member list of one of the author's groups.
+// The newest event for a group wins, as recorded in its OwnerGroup row; older
+// events are ignored, even when the newest left the group empty.
+func handleGroupEvent(event nostr.Event, db *sql.DB, cfg Config) error {
+
+	var group protocol.Group
+	err := json.Unmarshal([]byte(event.Content), &group)
+	if err != nil {
+		return fmt.Errorf("malformed group: %w : %v", err, event.Content)
+	}
+
+	if !IsValidGroupName(group.GroupName) {
+		return fmt.Errorf("invalid group name: %v", group.GroupName)
+	}
+
+	updatedAt := event.CreatedAt.Unix()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin group update failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO OwnerGroup (OwnerPubKey,GroupName,UpdatedAt) VALUES (?,?,?) ON CONFLICT DO UPDATE SET UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, group.GroupName, updatedAt, updatedAt, updatedAt)
+	if err != nil {
+		return fmt.Errorf("update group failed: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update group failed: %w", err)
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec("DELETE FROM GroupMember WHERE OwnerPubKey=? AND GroupName=?", event.PubKey, group.GroupName)
+	if err != nil {
+		return fmt.Errorf("clear group members failed: %w", err)
+	}
+
+	for _, member := range group.Members {
+		member = strings.ToLower(strings.TrimSpace(member))
+		if _, err := hex.DecodeString(member); err != nil || len(member) != 64 {
+			log.Printf("⚠️ [Bridge] Skipping invalid member %q of group %s/%s\n", member, event.PubKey, group.GroupName)
+			continue
+		}
+		_, err = tx.Exec("INSERT INTO GroupMember (OwnerPubKey,GroupName,MemberPubKey,UpdatedAt) VALUES (?,?,?,?) ON CONFLICT DO NOTHING;", event.PubKey, group.GroupName, member, updatedAt)
+		if err != nil {
+			return fmt.Errorf("insert group member failed: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit group update failed: %w", err)
+	}
+
+	log.Printf("👥 [Bridge] Group updated: pubkey=%s group=%s members=%d\n", event.PubKey, group.GroupName, len(group.Members))
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// A membership event that empties a group, or lists only invalid members, leaves no
+// GroupMember row behind; an older event arriving afterwards must not restore the
+// members it removed.
+func TestGroupEventOrder(t *testing.T) {
+	db := openTestDb(t)
+	update := func(createdAt int64, members ...string) {
+		t.Helper()
+		content, err := json.Marshal(protocol.Group{GroupName: "team", Members: members})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := nostr.Event{PubKey: testOwner, CreatedAt: time.Unix(createdAt, 0), Kind: protocol.KindGroup, Content: string(content)}
+		if err := handleGroupEvent(event, db, Config{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	members := func() []string {
+		t.Helper()
+		rows, err := db.Query("SELECT MemberPubKey FROM GroupMember WHERE OwnerPubKey=? AND GroupName='team' ORDER BY MemberPubKey", testOwner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			var member string
+			if err := rows.Scan(&member); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, member)
+		}
+		return got
+	}
+
+	update(10, testMember, testWriter)
+	if got := members(); len(got) != 2 {
+		t.Fatalf("members = %v, want the writer and the member", got)
+	}
+
+	update(30)
+	update(20, testMember)
+	if got := members(); len(got) != 0 {
+		t.Errorf("members after an empty group and an older event = %v, want none", got)
+	}
+
+	update(40, "not-a-pubkey")
+	update(35, testWriter)
+	if got := members(); len(got) != 0 {
+		t.Errorf("members after only invalid members and an older event = %v, want none", got)
+	}
+
+	update(50, testReader)
+	if got := members(); len(got) != 1 || got[0] != testReader {
+		t.Errorf("members after a newer event = %v, want the reader", got)
+	}
+}
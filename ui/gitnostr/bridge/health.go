@@ -0,0 +1,132 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+)
+
+// subscriptionHealth tracks when the relay subscriptions last delivered an event of
+// each kind, so a silently broken subscription can be told apart from no activity.
+type subscriptionHealth struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	lastEvent map[int]time.Time
+	received  map[int]int64
+	unhandled map[int]int64 // events of kinds processEvent has no handler for
+}
+
+func newSubscriptionHealth(cfg Config) *subscriptionHealth {
+	h := &subscriptionHealth{startedAt: time.Now(), lastEvent: make(map[int]time.Time), received: make(map[int]int64), unhandled: make(map[int]int64)}
+	// Subscribed kinds are reported from the start, with 0 until their first event
+	for _, kind := range append(cfg.GetWatchKinds(), protocol.KindSshKey, protocol.KindGitIdentity) {
+		h.received[kind] = 0
+	}
+	return h
+}
+
+// record notes an event of kind received from a relay.
+func (h *subscriptionHealth) record(kind int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastEvent[kind] = time.Now()
+	h.received[kind]++
+}
+
+// recordUnhandled notes an event of a kind the bridge has no handler for.
+func (h *subscriptionHealth) recordUnhandled(kind int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unhandled[kind]++
+}
+
+// kinds returns the reported kinds in ascending order.
+func (h *subscriptionHealth) kinds() []int {
+	var kinds []int
+	for kind := range h.received {
+		kinds = append(kinds, kind)
+	}
+	sort.Ints(kinds)
+	return kinds
+}
+
+// lastEventUnix returns the time of the last event of every reported kind, 0 for none yet.
+func (h *subscriptionHealth) lastEventUnix() map[string]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	last := make(map[string]int64)
+	for _, kind := range h.kinds() {
+		last[fmt.Sprint(kind)] = 0
+		if t, found := h.lastEvent[kind]; found {
+			last[fmt.Sprint(kind)] = t.Unix()
+		}
+	}
+	return last
+}
+
+// idleFor returns how long ago the last event of any kind arrived, or how long the
+// bridge has been running when none has yet.
+func (h *subscriptionHealth) idleFor() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	latest := h.startedAt
+	for _, t := range h.lastEvent {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return time.Since(latest)
+}
+
+// handleMetrics serves /metrics in the Prometheus text format.
+func handleMetrics(health *subscriptionHealth, gate *pauseGate, elector *leaderElector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health.mu.Lock()
+		defer health.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP gitnostr_bridge_last_event_timestamp_seconds Time the relay subscriptions last delivered an event of the kind, 0 for none since start.")
+		fmt.Fprintln(w, "# TYPE gitnostr_bridge_last_event_timestamp_seconds gauge")
+		for _, kind := range health.kinds() {
+			var last int64
+			if t, found := health.lastEvent[kind]; found {
+				last = t.Unix()
+			}
+			fmt.Fprintf(w, "gitnostr_bridge_last_event_timestamp_seconds{kind=\"%d\"} %d\n", kind, last)
+		}
+		fmt.Fprintln(w, "# HELP gitnostr_bridge_events_received_total Events of the kind delivered by the relay subscriptions since start.")
+		fmt.Fprintln(w, "# TYPE gitnostr_bridge_events_received_total counter")
+		for _, kind := range health.kinds() {
+			fmt.Fprintf(w, "gitnostr_bridge_events_received_total{kind=\"%d\"} %d\n", kind, health.received[kind])
+		}
+		fmt.Fprintln(w, "# HELP gitnostr_bridge_events_unhandled_total Events of the kind the bridge has no handler for, see unknownKinds.")
+		fmt.Fprintln(w, "# TYPE gitnostr_bridge_events_unhandled_total counter")
+		var unhandledKinds []int
+		for kind := range health.unhandled {
+			unhandledKinds = append(unhandledKinds, kind)
+		}
+		sort.Ints(unhandledKinds)
+		for _, kind := range unhandledKinds {
+			fmt.Fprintf(w, "gitnostr_bridge_events_unhandled_total{kind=\"%d\"} %d\n", kind, health.unhandled[kind])
+		}
+		fmt.Fprintln(w, "# HELP gitnostr_bridge_leader Whether this instance processes events, see leaderElection.")
+		fmt.Fprintln(w, "# TYPE gitnostr_bridge_leader gauge")
+		if elector.isLeader() {
+			fmt.Fprintln(w, "gitnostr_bridge_leader 1")
+		} else {
+			fmt.Fprintln(w, "gitnostr_bridge_leader 0")
+		}
+		paused, _ := gate.status()
+		fmt.Fprintln(w, "# HELP gitnostr_bridge_paused Whether event processing is paused.")
+		fmt.Fprintln(w, "# TYPE gitnostr_bridge_paused gauge")
+		if paused {
+			fmt.Fprintln(w, "gitnostr_bridge_paused 1")
+		} else {
+			fmt.Fprintln(w, "gitnostr_bridge_paused 0")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PushedRef is one ref update of a push as git passes it to post-receive.
+type PushedRef struct {
+	Ref    string `json:"ref"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// PostReceivePayload is the JSON body POSTed to a repository hook after a push.
+type PostReceivePayload struct {
+	Owner  string      `json:"owner"`
+	Repo   string      `json:"repo"`
+	Pusher string      `json:"pusher"`
+	Time   int64       `json:"time"`
+	Refs   []PushedRef `json:"refs"`
+}
+
+// ValidateHookURL accepts absolute http and https URLs only, and none naming
+// localhost or an internal address: anyone announcing a repository picks the URL,
+// and the bridge host POSTs to it.
+func ValidateHookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid hook url : %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("hook url must be an absolute http or https url: %v", rawURL)
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("hook url must not point at localhost: %v", rawURL)
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("hook url must not point at an internal address: %v", rawURL)
+	}
+	return nil
+}
+
+// carrierGradeNAT is the shared address space of RFC 6598, internal like the private ranges.
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP reports whether ip is neither loopback, private, link-local (which
+// includes cloud metadata endpoints like 169.254.169.254), multicast nor unspecified.
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || carrierGradeNAT.Contains(ip))
+}
+
+// refuseInternalAddress is a net.Dialer Control that only lets connections to public
+// addresses through. It sees the resolved address, so a hostname resolving to an
+// internal one, also after a redirect or a DNS change, is refused as well.
+func refuseInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("refusing to connect to internal address %v", host)
+	}
+	return nil
+}
+
+// publicHTTPClient returns a client for URLs taken from events, which can only reach
+// public addresses. It ignores the proxy environment variables, which would hide the
+// target address from refuseInternalAddress.
+func publicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: refuseInternalAddress}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+	}
+}
+
+// RepositoryHookURL returns the post-receive hook URL of the repository, or "" if it has none.
+func RepositoryHookURL(db *sql.DB, ownerPubKey, repoName string) (string, error) {
+	var hookURL string
+	err := db.QueryRow("SELECT Url FROM RepositoryHook WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&hookURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query repository hook : %w", err)
+	}
+	return hookURL, nil
+}
+
+// DeliverPostReceive POSTs payload to hookURL. Any 2xx response counts as delivered.
+func DeliverPostReceive(hookURL string, payload PostReceivePayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal hook payload : %w", err)
+	}
+	_, err = postHook(hookURL, body, 0)
+	return err
+}
+
+// postHook POSTs body to hookURL and returns the response status code, 0 if there
+// was no response. A delivery id other than 0 is sent as X-Gitnostr-Delivery so
+// receivers can recognize retries.
+func postHook(hookURL string, body []byte, deliveryId int64) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("post hook : %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if deliveryId != 0 {
+		req.Header.Set("X-Gitnostr-Delivery", strconv.FormatInt(deliveryId, 10))
+	}
+
+	resp, err := publicHTTPClient(10 * time.Second).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post hook : %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("post hook : %v", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
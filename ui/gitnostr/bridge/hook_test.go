@@ -0,0 +1,57 @@
+package bridge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateHookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://ci.example.com/hooks/gittr", true},
+		{"http://93.184.216.34:8080/hook", true},
+		{"ftp://ci.example.com/hook", false},
+		{"/hooks/gittr", false},
+		{"http://localhost/hook", false},
+		{"http://api.localhost/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://192.168.0.10/hook", false},
+		{"http://172.16.5.4/hook", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://[fd00::1]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+	}
+	for _, test := range tests {
+		err := ValidateHookURL(test.url)
+		if test.valid && err != nil {
+			t.Errorf("ValidateHookURL(%q) = %v, want valid", test.url, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ValidateHookURL(%q) accepted", test.url)
+		}
+	}
+}
+
+// Hook rows stored before the URL check, and hostnames resolving to an internal
+// address, are refused when connecting.
+func TestPostHookRefusesInternalAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	_, err := postHook(server.URL, []byte("{}"), 0)
+	if err == nil || !strings.Contains(err.Error(), "internal address") || called {
+		t.Fatalf("postHook(%v) = %v, want the internal address refused", server.URL, err)
+	}
+}
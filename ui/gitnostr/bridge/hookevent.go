@@ -0,0 +1,52 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// handleRepositoryHookEvent stores the post-receive hook URL of one of the author's
+// repositories. git-nostr-ssh installs the hook on the next push. The newest event wins.
+func handleRepositoryHookEvent(event nostr.Event, db *sql.DB, cfg Config) error {
+
+	var hook protocol.RepositoryHook
+	err := json.Unmarshal([]byte(event.Content), &hook)
+	if err != nil {
+		return fmt.Errorf("malformed repository hook: %w : %v", err, event.Content)
+	}
+
+	if !IsValidRepoName(hook.RepositoryName) {
+		return fmt.Errorf("invalid repository name: %v", hook.RepositoryName)
+	}
+	if hook.Url != "" {
+		if err := ValidateHookURL(hook.Url); err != nil {
+			return err
+		}
+	}
+
+	updatedAt := event.CreatedAt.Unix()
+	res, err := db.Exec("INSERT INTO RepositoryHook (OwnerPubKey,RepositoryName,Url,UpdatedAt) VALUES (?,?,?,?) ON CONFLICT DO UPDATE SET Url=?,UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, hook.RepositoryName, hook.Url, updatedAt, hook.Url, updatedAt, updatedAt)
+	if err != nil {
+		return fmt.Errorf("insert repository hook failed: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected failed: %w", err)
+	}
+
+	if affected == 1 {
+		if hook.Url == "" {
+			log.Printf("🪝 [Bridge] Repository hook removed: pubkey=%s repo=%s\n", event.PubKey, hook.RepositoryName)
+		} else {
+			log.Printf("🪝 [Bridge] Repository hook set: pubkey=%s repo=%s\n", event.PubKey, hook.RepositoryName)
+		}
+	}
+
+	return nil
+}
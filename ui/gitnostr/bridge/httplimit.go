@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// NewHTTPServer returns the http.Server of the bridge's HTTP API with the configured
+// timeouts, so slow clients can't hold connections open forever.
+func (cfg Config) NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.GetHttpReadHeaderTimeout(),
+		ReadTimeout:       cfg.GetHttpReadTimeout(),
+		WriteTimeout:      cfg.GetHttpWriteTimeout(),
+		IdleTimeout:       cfg.GetHttpIdleTimeout(),
+	}
+}
+
+// ListenHTTP listens on addr and accepts at most httpMaxConnections connections at
+// once. Further clients wait in the kernel's backlog until a connection closes.
+func (cfg Config) ListenHTTP(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &limitListener{Listener: listener, slots: make(chan struct{}, cfg.GetHttpMaxConnections())}, nil
+}
+
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.slots <- struct{}{}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+}
+
+// limitConn frees its slot on the first Close; net/http may close a connection twice.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// idempotencyKeyTTL is how long the result of a request with an Idempotency-Key
+// header is kept for retries.
+const idempotencyKeyTTL = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecorder keeps a copy of the response so it can be replayed.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// withIdempotencyKey makes POSTs carrying an Idempotency-Key header safe to retry.
+// The first response for a key is stored in the database and replayed for every
+// retry with the same body within idempotencyKeyTTL, even after a restart; a retry
+// with a different body gets 409. Server errors aren't stored so they can be retried.
+func withIdempotencyKey(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(sum[:])
+
+		now := time.Now().Unix()
+		var storedHash, contentType, response string
+		var status int
+		err = db.QueryRow("SELECT BodyHash,Status,ContentType,Response FROM IdempotencyKey WHERE Key=? AND CreatedAt>?", key, now-int64(idempotencyKeyTTL.Seconds())).Scan(&storedHash, &status, &contentType, &response)
+		if err == nil {
+			if storedHash != bodyHash {
+				http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusConflict)
+				return
+			}
+			log.Printf("🔁 [Bridge API] Replaying response for Idempotency-Key %q\n", key)
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(status)
+			w.Write([]byte(response))
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("❌ [Bridge API] Failed to look up Idempotency-Key: %v\n", err)
+			http.Error(w, "Failed to look up Idempotency-Key", http.StatusInternalServerError)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 || rec.status >= 500 {
+			return
+		}
+
+		_, err = db.Exec("DELETE FROM IdempotencyKey WHERE CreatedAt<=?", now-int64(idempotencyKeyTTL.Seconds()))
+		if err != nil {
+			log.Printf("⚠️ [Bridge API] Failed to expire idempotency keys: %v\n", err)
+		}
+		_, err = db.Exec("INSERT INTO IdempotencyKey (Key,BodyHash,Status,ContentType,Response,CreatedAt) VALUES (?,?,?,?,?,?) ON CONFLICT DO NOTHING;", key, bodyHash, rec.status, rec.Header().Get("Content-Type"), rec.body.String(), now)
+		if err != nil {
+			log.Printf("⚠️ [Bridge API] Failed to store Idempotency-Key %q: %v\n", key, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+// GittrEmailDomain is the domain of the <npub>@gittr author email convention.
+// Commits authored with such an email are attributed to that npub without a mapping.
+const GittrEmailDomain = "gittr"
+
+// PubKeyFromEmail returns the hex pubkey of an <npub>@gittr email.
+func PubKeyFromEmail(email string) (string, bool) {
+	local, domain, found := strings.Cut(strings.TrimSpace(email), "@")
+	if !found || !strings.EqualFold(domain, GittrEmailDomain) || !strings.HasPrefix(local, "npub1") {
+		return "", false
+	}
+	pubKey, err := gitnostr.DecodePubKey(local)
+	if err != nil {
+		return "", false
+	}
+	return pubKey, true
+}
+
+// ResolveAuthorPubKey returns the pubkey a git author email belongs to, either by
+// convention or from the GitIdentity mappings. It returns "" if the email is unknown.
+func ResolveAuthorPubKey(db *sql.DB, email string) (string, error) {
+	if pubKey, ok := PubKeyFromEmail(email); ok {
+		return pubKey, nil
+	}
+
+	var pubKey string
+	err := db.QueryRow("SELECT PubKey FROM GitIdentity WHERE Email=?", strings.ToLower(strings.TrimSpace(email))).Scan(&pubKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query git identity : %w", err)
+	}
+	return pubKey, nil
+}
+
+// ResolveCommitAuthors fills in the AuthorPubKey of each commit whose author email is known.
+func ResolveCommitAuthors(db *sql.DB, commits []Commit) error {
+	resolved := make(map[string]string)
+	for i := range commits {
+		pubKey, found := resolved[commits[i].AuthorEmail]
+		if !found {
+			var err error
+			pubKey, err = ResolveAuthorPubKey(db, commits[i].AuthorEmail)
+			if err != nil {
+				return err
+			}
+			resolved[commits[i].AuthorEmail] = pubKey
+		}
+		commits[i].AuthorPubKey = pubKey
+	}
+	return nil
+}
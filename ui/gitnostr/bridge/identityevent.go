@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// handleGitIdentityEvent replaces the git author emails claimed by the event's author.
+// An email claimed by another pubkey first stays with that pubkey.
+func handleGitIdentityEvent(event nostr.Event, db *sql.DB, cfg Config) error {
+
+	var identity protocol.GitIdentity
+	err := json.Unmarshal([]byte(event.Content), &identity)
+	if err != nil {
+		return fmt.Errorf("malformed git identity: %w : %v", err, event.Content)
+	}
+
+	updatedAt := event.CreatedAt.Unix()
+
+	var latest sql.NullInt64
+	err = db.QueryRow("SELECT MAX(UpdatedAt) FROM GitIdentity WHERE PubKey=?", event.PubKey).Scan(&latest)
+	if err != nil {
+		return fmt.Errorf("query git identity failed: %w", err)
+	}
+	if latest.Valid && latest.Int64 >= updatedAt {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin git identity update failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM GitIdentity WHERE PubKey=?", event.PubKey)
+	if err != nil {
+		return fmt.Errorf("clear git identity failed: %w", err)
+	}
+
+	for _, email := range identity.Emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if !strings.Contains(email, "@") {
+			log.Printf("⚠️ [Bridge] Skipping invalid git identity email %q of %s\n", email, event.PubKey)
+			continue
+		}
+		if _, ok := PubKeyFromEmail(email); ok {
+			continue // resolved by convention
+		}
+		result, err := tx.Exec("INSERT INTO GitIdentity (Email,PubKey,UpdatedAt) VALUES (?,?,?) ON CONFLICT DO NOTHING;", email, event.PubKey, updatedAt)
+		if err != nil {
+			return fmt.Errorf("insert git identity failed: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			log.Printf("⚠️ [Bridge] Git identity email %s is already claimed, ignoring claim by %s\n", email, event.PubKey)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit git identity update failed: %w", err)
+	}
+
+	log.Printf("🪪 [Bridge] Git identity updated: pubkey=%s emails=%d\n", event.PubKey, len(identity.Emails))
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package bridge
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RequiredWatchKinds must be part of any watchKinds setting: without repository
+// announcements the bridge has nothing to mirror.
+var RequiredWatchKinds = []int{protocol.KindRepositoryNIP34}
+
+// DefaultWatchKinds returns the kinds of the bridge's repository subscription when
+// watchKinds is not set.
+func DefaultWatchKinds() []int {
+	return append([]int{
+		protocol.KindRepository,
+		protocol.KindRepositoryPermission,
+		protocol.KindGroup,
+		protocol.KindRepositoryHook,
+		protocol.KindRepositoryNIP34,
+		protocol.KindRepositoryState,
+		protocol.KindComment,
+	}, protocol.StatusKinds...)
+}
+
+// ScopedWatchKinds maps watched kinds that are mostly about things other than git to
+// the tag filter limiting their subscription to events about repositories, issues
+// and patches. Each is subscribed in a filter of its own.
+func ScopedWatchKinds() map[int]nostr.TagMap {
+	gitKinds := []string{strconv.Itoa(protocol.KindRepositoryNIP34), strconv.Itoa(protocol.KindIssue), strconv.Itoa(protocol.KindPatch)}
+	return map[int]nostr.TagMap{
+		protocol.KindComment:  {"K": gitKinds}, // NIP-22 root kind
+		protocol.KindReaction: {"k": gitKinds}, // NIP-25 kind reacted to
+	}
+}
+
+// GetWatchKinds returns the kinds of the repository subscription, defaulting to DefaultWatchKinds.
+func (cfg Config) GetWatchKinds() []int {
+	if len(cfg.WatchKinds) == 0 {
+		return DefaultWatchKinds()
+	}
+	return cfg.WatchKinds
+}
+
+// ValidateWatchKinds checks the watchKinds setting. The bridge refuses to start
+// with an invalid one.
+func (cfg Config) ValidateWatchKinds() error {
+	if len(cfg.WatchKinds) == 0 {
+		return nil
+	}
+	seen := make(map[int]bool, len(cfg.WatchKinds))
+	for _, kind := range cfg.WatchKinds {
+		if kind < 0 || kind > 65535 {
+			return fmt.Errorf("watchKinds entry is not a valid kind: %v", kind)
+		}
+		if kind == protocol.KindSshKey || kind == protocol.KindGitIdentity {
+			return fmt.Errorf("watchKinds must not contain kind %v, it is subscribed per registered ssh key", kind)
+		}
+		if seen[kind] {
+			return fmt.Errorf("watchKinds contains kind %v twice", kind)
+		}
+		seen[kind] = true
+	}
+	for _, kind := range RequiredWatchKinds {
+		if !seen[kind] {
+			return fmt.Errorf("watchKinds must contain kind %v", kind)
+		}
+	}
+	return nil
+}
+
+// DefaultStrictSignatureKinds are the kinds POST /api/event only accepts with a valid
+// id and signature when strictSignatureKinds is not set: every kind that grants access
+// or changes a repository when forged. Permission, group and ssh key events and the
+// maintainers tag of announcements grant push access, announcements and deletions
+// delete repositories, state events move refs and hooks send pushes elsewhere. Git
+// identity events map commit author emails to a pubkey, so a forged one would have
+// the commits endpoint attribute someone else's commits to that pubkey.
+var DefaultStrictSignatureKinds = []int{
+	nostr.KindDeletion,
+	protocol.KindRepositoryPermission,
+	protocol.KindRepository,
+	protocol.KindSshKey,
+	protocol.KindGitIdentity,
+	protocol.KindGroup,
+	protocol.KindRepositoryHook,
+	protocol.KindRepositoryNIP34,
+	protocol.KindRepositoryState,
+}
+
+// GetStrictSignatureKinds returns the kinds POST /api/event verifies strictly,
+// defaulting to DefaultStrictSignatureKinds.
+func (cfg Config) GetStrictSignatureKinds() []int {
+	if cfg.StrictSignatureKinds == nil {
+		return DefaultStrictSignatureKinds
+	}
+	return cfg.StrictSignatureKinds
+}
+
+// StrictSignature reports whether POST /api/event rejects events of kind whose id or
+// signature doesn't verify. Events of other kinds are accepted with a warning, since
+// clients serialize some events differently than go-nostr does.
+func (cfg Config) StrictSignature(kind int) bool {
+	for _, strict := range cfg.GetStrictSignatureKinds() {
+		if strict == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateStrictSignatureKinds checks the strictSignatureKinds setting.
+func (cfg Config) ValidateStrictSignatureKinds() error {
+	for _, kind := range cfg.StrictSignatureKinds {
+		if kind < 0 || kind > 65535 {
+			return fmt.Errorf("strictSignatureKinds entry is not a valid kind: %v", kind)
+		}
+	}
+	return nil
+}
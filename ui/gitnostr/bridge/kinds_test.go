@@ -0,0 +1,22 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+)
+
+func TestDefaultStrictSignatureKinds(t *testing.T) {
+	var cfg Config
+	for kind, want := range map[int]bool{
+		protocol.KindRepositoryPermission: true,
+		protocol.KindSshKey:               true,
+		protocol.KindGitIdentity:          true,
+		protocol.KindRepositoryNIP34:      true,
+		protocol.KindComment:              false,
+	} {
+		if got := cfg.StrictSignature(kind); got != want {
+			t.Errorf("StrictSignature(%d) = %v, want %v", kind, got, want)
+		}
+	}
+}
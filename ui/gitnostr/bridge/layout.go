@@ -0,0 +1,224 @@
+package bridge
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+// Built-in values of pathLayout.
+const (
+	PathLayoutNested  = "nested"  // <owner>/<repo>.git, with npub symlinks to the owner directories
+	PathLayoutFlat    = "flat"    // <owner>-<repo>.git
+	PathLayoutSharded = "sharded" // <first two hex digits of owner>/<owner>/<repo>.git
+)
+
+// PathLayout places repositories below repositoryDir. ownerPubKey is always lowercase hex.
+type PathLayout interface {
+	RepoPath(reposDir, ownerPubKey, repoName string) (string, error)
+}
+
+var (
+	pathLayoutsMutex sync.Mutex
+	pathLayouts      = map[string]PathLayout{
+		PathLayoutNested:  nestedLayout{},
+		PathLayoutFlat:    flatLayout{},
+		PathLayoutSharded: shardedLayout{},
+	}
+)
+
+// RegisterPathLayout makes a layout available as pathLayout name.
+func RegisterPathLayout(name string, layout PathLayout) {
+	pathLayoutsMutex.Lock()
+	defer pathLayoutsMutex.Unlock()
+	pathLayouts[name] = layout
+}
+
+// LookupPathLayout returns the layout registered as name.
+func LookupPathLayout(name string) (PathLayout, error) {
+	pathLayoutsMutex.Lock()
+	defer pathLayoutsMutex.Unlock()
+	layout, found := pathLayouts[name]
+	if !found {
+		names := make([]string, 0, len(pathLayouts))
+		for name := range pathLayouts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown pathLayout %q, expected one of %v", name, names)
+	}
+	return layout, nil
+}
+
+type nestedLayout struct{}
+
+func (nestedLayout) RepoPath(reposDir, ownerPubKey, repoName string) (string, error) {
+	ownerDir, err := ResolveOwnerDir(reposDir, ownerPubKey)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(ownerDir, repoName+".git"), nil
+}
+
+// flatLayout puts every repository directly in repositoryDir. Pubkeys have a fixed
+// length, so the name still splits unambiguously into owner and repository.
+type flatLayout struct{}
+
+func (flatLayout) RepoPath(reposDir, ownerPubKey, repoName string) (string, error) {
+	return filepath.Join(reposDir, ownerPubKey+"-"+repoName+".git"), nil
+}
+
+// shardedLayout spreads the owner directories over 256 shards, for filesystems and
+// backup tools that slow down with many entries in one directory.
+type shardedLayout struct{}
+
+func (shardedLayout) RepoPath(reposDir, ownerPubKey, repoName string) (string, error) {
+	return filepath.Join(reposDir, ownerPubKey[:2], ownerPubKey, repoName+".git"), nil
+}
+
+// LowercaseOwnerDirs moves repositories stored under an upper or mixed case owner
+// pubkey, from before pubkeys were canonicalized to lowercase hex, to their path in
+// the pathLayout. Repositories present at both paths are left where they are and
+// returned as conflicts. Registered layouts are left alone.
+func LowercaseOwnerDirs(cfg Config) (int, []string, error) {
+	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	if err != nil {
+		return 0, nil, fmt.Errorf("resolve repos path : %w", err)
+	}
+	entries, err := os.ReadDir(reposDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	moved := 0
+	var conflicts []string
+	move := func(from, to string) error {
+		n, c, err := mergeDir(from, to)
+		moved += n
+		conflicts = append(conflicts, c...)
+		return err
+	}
+
+	switch cfg.GetPathLayout() {
+	case PathLayoutNested:
+		for _, entry := range entries {
+			if !entry.IsDir() || !isMixedCasePubKey(entry.Name()) {
+				continue
+			}
+			ownerPubKey := strings.ToLower(entry.Name())
+			if err := move(filepath.Join(reposDir, entry.Name()), filepath.Join(reposDir, ownerPubKey)); err != nil {
+				return moved, conflicts, err
+			}
+			if _, err := EnsureNpubSymlink(reposDir, ownerPubKey); err != nil {
+				return moved, conflicts, err
+			}
+		}
+
+	case PathLayoutSharded:
+		for _, shard := range entries {
+			if !shard.IsDir() || len(shard.Name()) != 2 {
+				continue
+			}
+			owners, err := os.ReadDir(filepath.Join(reposDir, shard.Name()))
+			if err != nil {
+				return moved, conflicts, err
+			}
+			for _, entry := range owners {
+				if !entry.IsDir() || !isMixedCasePubKey(entry.Name()) {
+					continue
+				}
+				ownerPubKey := strings.ToLower(entry.Name())
+				if err := move(filepath.Join(reposDir, shard.Name(), entry.Name()), filepath.Join(reposDir, ownerPubKey[:2], ownerPubKey)); err != nil {
+					return moved, conflicts, err
+				}
+			}
+		}
+
+	case PathLayoutFlat:
+		for _, entry := range entries {
+			name := entry.Name()
+			if len(name) < 66 || name[64] != '-' || !isMixedCasePubKey(name[:64]) {
+				continue
+			}
+			target := filepath.Join(reposDir, strings.ToLower(name[:64])+name[64:])
+			if !sameFile(filepath.Join(reposDir, name), target) {
+				if _, err := os.Lstat(target); err == nil {
+					conflicts = append(conflicts, filepath.Join(reposDir, name))
+					continue
+				}
+			}
+			if err := os.Rename(filepath.Join(reposDir, name), target); err != nil {
+				return moved, conflicts, err
+			}
+			moved++
+		}
+	}
+	return moved, conflicts, nil
+}
+
+// isMixedCasePubKey reports whether name is a hex pubkey with upper case digits.
+func isMixedCasePubKey(name string) bool {
+	if len(name) != 64 || name == strings.ToLower(name) {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// mergeDir moves the entries of from into to and removes from once it is empty.
+// Entries present in both are left in from and returned as conflicts.
+func mergeDir(from, to string) (int, []string, error) {
+	// On a case-insensitive filesystem both are the same directory, renaming fixes the case
+	if sameFile(from, to) {
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return 0, nil, err
+		}
+		return len(entries), nil, os.Rename(from, to)
+	}
+	if err := os.MkdirAll(to, 0750); err != nil {
+		return 0, nil, err
+	}
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return 0, nil, err
+	}
+	moved := 0
+	var conflicts []string
+	for _, entry := range entries {
+		target := filepath.Join(to, entry.Name())
+		if _, err := os.Lstat(target); err == nil {
+			conflicts = append(conflicts, filepath.Join(from, entry.Name()))
+			continue
+		}
+		if err := os.Rename(filepath.Join(from, entry.Name()), target); err != nil {
+			return moved, conflicts, err
+		}
+		moved++
+	}
+	if len(conflicts) > 0 {
+		return moved, conflicts, nil
+	}
+	return moved, nil, os.Remove(from)
+}
+
+// sameFile reports whether a and b both exist and are the same file.
+func sameFile(a, b string) bool {
+	aInfo, err := os.Lstat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Lstat(b)
+	return err == nil && os.SameFile(aInfo, bInfo)
+}
@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestLowercaseOwnerDirs(t *testing.T) {
+	upperOwner := strings.ToUpper(testOwner)
+	for _, layout := range []string{PathLayoutNested, PathLayoutSharded, PathLayoutFlat} {
+		t.Run(layout, func(t *testing.T) {
+			cfg := Config{RepositoryDir: t.TempDir(), PathLayout: layout}
+			upperPath, err := LookupPathLayout(layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Where the layout put repositories before pubkeys were lowercased,
+			// the nested layout lowercases the owner directory itself now
+			for _, repo := range []string{"repo", "both"} {
+				path, err := upperPath.RepoPath(cfg.RepositoryDir, upperOwner, repo)
+				if layout == PathLayoutNested {
+					path = filepath.Join(cfg.RepositoryDir, upperOwner, repo+".git")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(path, 0750); err != nil {
+					t.Fatal(err)
+				}
+			}
+			both, err := cfg.RepoPath(testOwner, "both")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(both, 0750); err != nil {
+				t.Fatal(err)
+			}
+
+			moved, conflicts, err := LowercaseOwnerDirs(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved != 1 || len(conflicts) != 1 || !strings.Contains(conflicts[0], "both") {
+				t.Errorf("moved %d, conflicts %v, want repo moved and both conflicting", moved, conflicts)
+			}
+			repo, err := cfg.RepoPath(testOwner, "repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(repo); err != nil {
+				t.Errorf("repository not at its lowercase path: %v", err)
+			}
+
+			if layout == PathLayoutNested {
+				npub, _ := nip19.EncodePublicKey(testOwner, "")
+				if target, err := os.Readlink(filepath.Join(cfg.RepositoryDir, npub)); err != nil || target != testOwner {
+					t.Errorf("npub symlink points to %q, %v, want the lowercase directory", target, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// leaderElector keeps bridge instances that share a database from processing events
+// at the same time. The instance holding the LeaderLease row is the leader; the
+// others wait as followers and serve the read endpoints only. A nil elector, used
+// when leaderElection is off, is always the leader.
+type leaderElector struct {
+	db     *sql.DB
+	holder string
+	ttl    time.Duration
+	leader atomic.Bool
+}
+
+func newLeaderElector(db *sql.DB, cfg Config) *leaderElector {
+	if !cfg.LeaderElection {
+		return nil
+	}
+	return &leaderElector{db: db, holder: cfg.GetInstanceName(), ttl: cfg.GetLeaseTtl()}
+}
+
+func (e *leaderElector) isLeader() bool {
+	return e == nil || e.leader.Load()
+}
+
+// waitLeader blocks until this instance holds the lease or ctx is done.
+func (e *leaderElector) waitLeader(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	interval := e.ttl / 3
+
+	logged := ""
+	for {
+		acquired, err := AcquireLease(e.db, LeaderLeaseName, e.holder, e.ttl)
+		if err != nil {
+			log.Printf("⚠️ [Bridge] Leader election: %v\n", err)
+		} else if acquired {
+			break
+		} else if holder, expiresAt, err := LeaseHolder(e.db, LeaderLeaseName); err == nil && holder != logged {
+			log.Printf("⏸️ [Bridge] Standing by as follower (%s): %s is the leader until %s\n", e.holder, holder, expiresAt.Format(time.RFC3339))
+			logged = holder
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	e.leader.Store(true)
+	log.Printf("👑 [Bridge] %s is now the leader (lease ttl %s)\n", e.holder, e.ttl)
+	return nil
+}
+
+// renewLease keeps renewing the lease of the leader until ctx is done. An instance
+// that can't renew in time calls lost instead of writing alongside a new leader, so
+// Run returns and its supervisor restarts it as a follower.
+func (e *leaderElector) renewLease(ctx context.Context, lost func(error)) {
+	if e == nil {
+		return
+	}
+	defer e.leader.Store(false)
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		acquired, err := AcquireLease(e.db, LeaderLeaseName, e.holder, e.ttl)
+		if err == nil && acquired {
+			renewedAt = time.Now()
+			continue
+		}
+		if err == nil {
+			lost(fmt.Errorf("%s lost the leader lease to another instance", e.holder))
+			return
+		}
+		log.Printf("⚠️ [Bridge] Failed to renew leader lease: %v\n", err)
+		// Give up well before the lease expires so no two leaders overlap
+		if time.Since(renewedAt) > e.ttl/2 {
+			lost(fmt.Errorf("%s could not renew the leader lease for %s", e.holder, time.Since(renewedAt).Round(time.Second)))
+			return
+		}
+	}
+}
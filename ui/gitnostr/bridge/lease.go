@@ -0,0 +1,43 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LeaderLeaseName is the lease bridge instances sharing a database compete for.
+const LeaderLeaseName = "bridge"
+
+// AcquireLease takes or renews the lease name for holder until ttl from now. It
+// succeeds when the lease is free, expired or already held by holder, and returns
+// false when another holder's lease is still running. Holders must have synchronized
+// clocks, as expiry is compared against the local time.
+func AcquireLease(db *sql.DB, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := db.Exec("INSERT INTO LeaderLease (Name,Holder,ExpiresAt) VALUES (?,?,?) ON CONFLICT (Name) DO UPDATE SET Holder=excluded.Holder,ExpiresAt=excluded.ExpiresAt WHERE Holder=excluded.Holder OR ExpiresAt<?;", name, holder, now.Add(ttl).Unix(), now.Unix())
+	if err != nil {
+		return false, fmt.Errorf("acquire lease : %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("acquire lease : %w", err)
+	}
+	return affected == 1, nil
+}
+
+// LeaseHolder returns the current holder of the lease name and when it expires.
+// An empty holder means the lease was never taken.
+func LeaseHolder(db *sql.DB, name string) (string, time.Time, error) {
+	var holder string
+	var expiresAt int64
+	err := db.QueryRow("SELECT Holder,ExpiresAt FROM LeaderLease WHERE Name=?", name).Scan(&holder, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("query lease : %w", err)
+	}
+	return holder, time.Unix(expiresAt, 0), nil
+}
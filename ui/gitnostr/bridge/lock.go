@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ErrRepoLocked is returned by TryLockRepoExclusive when someone else holds the repo lock.
+var ErrRepoLocked = errors.New("repository is locked")
+
+const repoLockFile = "git-nostr.lock"
+
+func lockRepo(repoPath string, how int) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(repoPath, repoLockFile), os.O_RDONLY|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("open repo lock : %w", err)
+	}
+
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrRepoLocked
+		}
+		return nil, fmt.Errorf("lock repo : %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// LockRepoShared blocks until the repository can be written to. Any number of
+// writers (pushes, state events) may hold it at once; git does its own ref locking.
+func LockRepoShared(repoPath string) (func(), error) {
+	return lockRepo(repoPath, syscall.LOCK_SH)
+}
+
+// TryLockRepoExclusive takes the repository for maintenance, failing with
+// ErrRepoLocked instead of waiting if a writer currently holds it.
+func TryLockRepoExclusive(repoPath string) (func(), error) {
+	return lockRepo(repoPath, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// DirSize returns the total size of the regular files below path.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
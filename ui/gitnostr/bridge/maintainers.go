@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+)
+
+// SyncMaintainers makes the RepositoryPermission rows with Source=maintainers of the
+// owner's repository match the maintainers tag of an announcement created at
+// updatedAt: listed pubkeys get WRITE, rows of pubkeys no longer listed are revoked.
+// The owner is skipped, its ADMIN is implicit, and grants from permission events are
+// left alone, so a maintainer with a manual ADMIN grant is never downgraded. It runs
+// in the caller's transaction and returns the number of newly granted and of revoked
+// rows; maintainers that were already listed are only refreshed and not counted.
+func SyncMaintainers(tx *sql.Tx, ownerPubKey, repoName string, maintainers []string, updatedAt int64) (granted, revoked int64, err error) {
+	for _, m := range maintainers {
+		if strings.EqualFold(m, ownerPubKey) {
+			continue
+		}
+		res, err := tx.Exec("UPDATE RepositoryPermission SET Permission=?,UpdatedAt=? WHERE OwnerPubKey=? AND RepositoryName=? AND TargetPubKey=? AND Source=? AND UpdatedAt<?;", protocol.PermissionWrite, updatedAt, ownerPubKey, repoName, m, PermissionSourceMaintainers, updatedAt)
+		if err != nil {
+			return 0, 0, fmt.Errorf("sync maintainer %v : %w", m, err)
+		}
+		refreshed, err := res.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("sync maintainer %v : %w", m, err)
+		}
+		if refreshed > 0 {
+			continue
+		}
+		// Not a maintainer yet; a grant from a permission event is kept as it is
+		res, err = tx.Exec("INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt,Source) VALUES (?,?,?,?,?,?) ON CONFLICT DO NOTHING;", ownerPubKey, repoName, m, protocol.PermissionWrite, updatedAt, PermissionSourceMaintainers)
+		if err != nil {
+			return 0, 0, fmt.Errorf("sync maintainer %v : %w", m, err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("sync maintainer %v : %w", m, err)
+		}
+		granted += inserted
+	}
+
+	res, err := tx.Exec("DELETE FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=? AND Source=? AND UpdatedAt<?;", ownerPubKey, repoName, PermissionSourceMaintainers, updatedAt)
+	if err != nil {
+		return 0, 0, fmt.Errorf("revoke removed maintainers : %w", err)
+	}
+	revoked, err = res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("revoke removed maintainers : %w", err)
+	}
+	return granted, revoked, nil
+}
@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestSyncMaintainers(t *testing.T) {
+	server := newTestServer(t)
+	db := server.DB()
+	execTest(t, db, "INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt,Source) VALUES ('"+testOwner+"','repo','"+testAdmin+"','ADMIN',1,'event')")
+
+	sync := func(updatedAt int64, maintainers ...string) (int64, int64) {
+		t.Helper()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		granted, revoked, err := SyncMaintainers(tx, testOwner, "repo", maintainers, updatedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return granted, revoked
+	}
+	permissions := func() map[string]string {
+		t.Helper()
+		rows, err := db.Query("SELECT TargetPubKey,Permission FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=?", testOwner, "repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		got := make(map[string]string)
+		for rows.Next() {
+			var target, permission string
+			if err := rows.Scan(&target, &permission); err != nil {
+				t.Fatal(err)
+			}
+			got[target] = permission
+		}
+		return got
+	}
+
+	if granted, revoked := sync(10, testOwner, testWriter, testAdmin); granted != 1 || revoked != 0 {
+		t.Errorf("adding a maintainer: granted %d, revoked %d, want 1 and 0", granted, revoked)
+	}
+	if got := permissions(); len(got) != 2 || got[testWriter] != protocol.PermissionWrite || got[testAdmin] != "ADMIN" {
+		t.Errorf("after adding: %v, want the writer with WRITE, the admin kept and no row for the owner", got)
+	}
+
+	if granted, revoked := sync(20, testOwner, testWriter, testAdmin); granted != 0 || revoked != 0 {
+		t.Errorf("same maintainers again: granted %d, revoked %d, want no change", granted, revoked)
+	}
+
+	if granted, revoked := sync(30, testAdmin); granted != 0 || revoked != 1 {
+		t.Errorf("removing a maintainer: granted %d, revoked %d, want 0 and 1", granted, revoked)
+	}
+	if got := permissions(); len(got) != 1 || got[testAdmin] != "ADMIN" {
+		t.Errorf("after removing: %v, want only the admin grant", got)
+	}
+}
+
+// Adding or removing a maintainer changes who the ssh key subscription covers, so the
+// announcement must make processEvent ask for a reconnect; an unchanged list must not.
+func TestProcessEventReconnectsOnMaintainerChanges(t *testing.T) {
+	server := newTestServer(t)
+	ownerKey := nostr.GeneratePrivateKey()
+	now := time.Now().Add(-time.Minute)
+	announce := func(offset time.Duration, maintainers ...string) bool {
+		t.Helper()
+		tags := nostr.Tags{{"d", "repo"}}
+		if len(maintainers) > 0 {
+			tags = append(tags, append(nostr.Tag{"maintainers"}, maintainers...))
+		}
+		return server.processEvent(signedEvent(t, ownerKey, protocol.KindRepositoryNIP34, now.Add(offset), tags))
+	}
+
+	if !announce(0, testWriter) {
+		t.Error("adding a maintainer didn't ask for a reconnect")
+	}
+	if announce(time.Second, testWriter) {
+		t.Error("an unchanged maintainers list asked for a reconnect")
+	}
+	if !announce(2*time.Second, testWriter, testReader) {
+		t.Error("adding a second maintainer didn't ask for a reconnect")
+	}
+	if !announce(3 * time.Second) {
+		t.Error("removing the maintainers didn't ask for a reconnect")
+	}
+}
@@ -7,15 +7,35 @@ import (
 	"github.com/spearson78/migrate"
 )
 
-var migrated = false
+// SchemaTables lists the tables the migrations below are expected to create.
+var SchemaTables = []string{
+	"Repository",
+	"AuthorizedKeys",
+	"RepositoryPermission",
+	"Since",
+	"RepositoryPushPolicy",
+	"RepositoryPushPayment",
+	"RepositoryPushPaymentIntent",
+	"GroupMember",
+	"RepositoryGroupPermission",
+	"RepositoryStats",
+	"RepositoryEventStatus",
+	"CommitSignature",
+	"GitIdentity",
+	"RepositoryHook",
+	"IdempotencyKey",
+	"AuditLog",
+	"LeaderLease",
+	"Comment",
+	"Reaction",
+	"WebhookDelivery",
+	"FailedEvent",
+	"OwnerGroup",
+}
 
+// applyMigrations brings the schema of db up to date. It runs for every database that
+// is opened; migrate.Apply skips the migrations db already recorded.
 func applyMigrations(db *sql.DB) (err error) {
-
-	if migrated {
-		return nil
-	}
-	migrated = true
-
 	return migrate.Apply(db, []migrate.Migration{
 		{Id: "createRepositoryTable", Migration: createRepositoryTable},
 		{Id: "createAuthorizedKeysTable", Migration: createAuthorizedKeysTable},
@@ -24,6 +44,28 @@ func applyMigrations(db *sql.DB) (err error) {
 		{Id: "createRepositoryPushPolicyTable", Migration: createRepositoryPushPolicyTable},
 		{Id: "createRepositoryPushPaymentTable", Migration: createRepositoryPushPaymentTable},
 		{Id: "createRepositoryPushPaymentIntentTable", Migration: createRepositoryPushPaymentIntentTable},
+		{Id: "createGroupMemberTable", Migration: createGroupMemberTable},
+		{Id: "createRepositoryGroupPermissionTable", Migration: createRepositoryGroupPermissionTable},
+		{Id: "addRepositoryPublicWriteRefsColumn", Migration: addRepositoryPublicWriteRefsColumn},
+		{Id: "createRepositoryStatsTable", Migration: createRepositoryStatsTable},
+		{Id: "addRepositoryStatsLastGcAtColumn", Migration: addRepositoryStatsLastGcAtColumn},
+		{Id: "createRepositoryEventStatusTable", Migration: createRepositoryEventStatusTable},
+		{Id: "createCommitSignatureTable", Migration: createCommitSignatureTable},
+		{Id: "createGitIdentityTable", Migration: createGitIdentityTable},
+		{Id: "addRepositoryPermissionSourceColumn", Migration: addRepositoryPermissionSourceColumn},
+		{Id: "createRepositoryPermissionTargetIndex", Migration: createRepositoryPermissionTargetIndex},
+		{Id: "createRepositoryHookTable", Migration: createRepositoryHookTable},
+		{Id: "addRepositorySizeColumns", Migration: addRepositorySizeColumns},
+		{Id: "addRepositoryMetadataColumns", Migration: addRepositoryMetadataColumns},
+		{Id: "createIdempotencyKeyTable", Migration: createIdempotencyKeyTable},
+		{Id: "createAuditLogTable", Migration: createAuditLogTable},
+		{Id: "createLeaderLeaseTable", Migration: createLeaderLeaseTable},
+		{Id: "createCommentTable", Migration: createCommentTable},
+		{Id: "createReactionTable", Migration: createReactionTable},
+		{Id: "createWebhookDeliveryTable", Migration: createWebhookDeliveryTable},
+		{Id: "createFailedEventTable", Migration: createFailedEventTable},
+		{Id: "createOwnerGroupTable", Migration: createOwnerGroupTable},
+		{Id: "lowercasePubKeys", Migration: lowercasePubKeys},
 	})
 }
 
@@ -72,3 +114,224 @@ func createRepositoryPushPaymentIntentTable(tx *sql.Tx) error {
 	_, err = fsql.Exec(tx, "CREATE INDEX idx_repo_push_payment_intent_lookup ON RepositoryPushPaymentIntent (OwnerPubKey,RepositoryName,PayerPubKey,Status,UpdatedAt)")
 	return err
 }
+
+func createGroupMemberTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE GroupMember (OwnerPubKey TEXT,GroupName TEXT,MemberPubKey TEXT,UpdatedAt INTEGER, PRIMARY KEY (OwnerPubKey,GroupName,MemberPubKey))")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_group_member_member ON GroupMember (MemberPubKey)")
+	return err
+}
+
+func createRepositoryGroupPermissionTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE RepositoryGroupPermission (OwnerPubKey TEXT,RepositoryName TEXT,GroupName TEXT,Permission TEXT,UpdatedAt INTEGER, PRIMARY KEY (OwnerPubKey,RepositoryName,GroupName))")
+	return err
+}
+
+func addRepositoryPublicWriteRefsColumn(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "ALTER TABLE Repository ADD COLUMN PublicWriteRefs TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+func createRepositoryStatsTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE RepositoryStats (OwnerPubKey TEXT,RepositoryName TEXT,PushCount INTEGER,LastPushAt INTEGER,LastPusherPubKey TEXT, PRIMARY KEY (OwnerPubKey,RepositoryName))")
+	return err
+}
+
+func addRepositoryStatsLastGcAtColumn(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "ALTER TABLE RepositoryStats ADD COLUMN LastGcAt INTEGER NOT NULL DEFAULT 0")
+	return err
+}
+
+func createRepositoryEventStatusTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE RepositoryEventStatus (OwnerPubKey TEXT,RepositoryName TEXT,TargetEventId TEXT,Status TEXT,StatusEventId TEXT,AuthorPubKey TEXT,UpdatedAt INTEGER, PRIMARY KEY (OwnerPubKey,RepositoryName,TargetEventId))")
+	return err
+}
+
+func createCommitSignatureTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE CommitSignature (CommitHash TEXT,Status TEXT,Signer TEXT,SigningKey TEXT,VerifiedAt INTEGER, PRIMARY KEY (CommitHash))")
+	return err
+}
+
+func createGitIdentityTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE GitIdentity (Email TEXT,PubKey TEXT,UpdatedAt INTEGER, PRIMARY KEY (Email))")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_git_identity_pubkey ON GitIdentity (PubKey)")
+	return err
+}
+
+func addRepositoryPermissionSourceColumn(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "ALTER TABLE RepositoryPermission ADD COLUMN Source TEXT NOT NULL DEFAULT 'event'")
+	if err != nil {
+		return err
+	}
+	// Maintainer rows were written with the UpdatedAt of the announcement that listed them.
+	_, err = fsql.Exec(tx, "UPDATE RepositoryPermission SET Source='maintainers' WHERE Permission='WRITE' AND UpdatedAt=(SELECT Repository.UpdatedAt FROM Repository WHERE Repository.OwnerPubKey=RepositoryPermission.OwnerPubKey AND Repository.RepositoryName=RepositoryPermission.RepositoryName)")
+	return err
+}
+
+func createRepositoryPermissionTargetIndex(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE INDEX idx_repository_permission_target ON RepositoryPermission (TargetPubKey)")
+	return err
+}
+
+func createRepositoryHookTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE RepositoryHook (OwnerPubKey TEXT,RepositoryName TEXT,Url TEXT,UpdatedAt INTEGER, PRIMARY KEY (OwnerPubKey,RepositoryName))")
+	return err
+}
+
+func addRepositorySizeColumns(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "ALTER TABLE Repository ADD COLUMN SizeBytes INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "ALTER TABLE Repository ADD COLUMN SizeUpdatedAt INTEGER NOT NULL DEFAULT 0")
+	return err
+}
+
+func addRepositoryMetadataColumns(tx *sql.Tx) error {
+
+	for _, column := range []string{"Description", "Topics", "CloneUrl", "DefaultBranch"} {
+		_, err := fsql.Exec(tx, "ALTER TABLE Repository ADD COLUMN "+column+" TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createIdempotencyKeyTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE IdempotencyKey (Key TEXT,BodyHash TEXT,Status INTEGER,ContentType TEXT,Response TEXT,CreatedAt INTEGER, PRIMARY KEY (Key))")
+	return err
+}
+
+func createAuditLogTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE AuditLog (Id INTEGER PRIMARY KEY AUTOINCREMENT,Time INTEGER,Verb TEXT,OwnerPubKey TEXT,RepositoryName TEXT,PubKey TEXT,EventId TEXT,Data TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_audit_log_repository ON AuditLog (OwnerPubKey,RepositoryName)")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_audit_log_pubkey ON AuditLog (PubKey)")
+	return err
+}
+
+func createLeaderLeaseTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE LeaderLease (Name TEXT,Holder TEXT,ExpiresAt INTEGER, PRIMARY KEY (Name))")
+	return err
+}
+
+func createCommentTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE Comment (OwnerPubKey TEXT,RepositoryName TEXT,EventId TEXT,RootEventId TEXT,ParentEventId TEXT,AuthorPubKey TEXT,Content TEXT,CreatedAt INTEGER, PRIMARY KEY (OwnerPubKey,RepositoryName,EventId))")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_comment_parent ON Comment (ParentEventId)")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_comment_root ON Comment (OwnerPubKey,RepositoryName,RootEventId)")
+	return err
+}
+
+func createReactionTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE Reaction (OwnerPubKey TEXT,RepositoryName TEXT,TargetEventId TEXT,ReactorPubKey TEXT,Content TEXT,EventId TEXT,CreatedAt INTEGER, PRIMARY KEY (OwnerPubKey,RepositoryName,TargetEventId,ReactorPubKey))")
+	return err
+}
+
+func createWebhookDeliveryTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE WebhookDelivery (Id INTEGER PRIMARY KEY AUTOINCREMENT,OwnerPubKey TEXT,RepositoryName TEXT,Url TEXT,Payload TEXT,Status TEXT,Attempts INTEGER,LastStatusCode INTEGER,LastError TEXT,CreatedAt INTEGER,NextAttemptAt INTEGER,DeliveredAt INTEGER)")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_webhook_delivery_repository ON WebhookDelivery (OwnerPubKey,RepositoryName)")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_webhook_delivery_due ON WebhookDelivery (Status,NextAttemptAt)")
+	return err
+}
+
+func createFailedEventTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE FailedEvent (EventId TEXT,Kind INTEGER,PubKey TEXT,Event TEXT,Error TEXT,Retries INTEGER,RetryRequested INTEGER,FirstFailedAt INTEGER,LastFailedAt INTEGER, PRIMARY KEY (EventId))")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "CREATE INDEX idx_failed_event_last_failed ON FailedEvent (LastFailedAt)")
+	return err
+}
+
+// createOwnerGroupTable keeps the time of the newest membership event of each group,
+// also once that event left the group without members. Existing groups start at
+// their newest member row.
+func createOwnerGroupTable(tx *sql.Tx) error {
+
+	_, err := fsql.Exec(tx, "CREATE TABLE OwnerGroup (OwnerPubKey TEXT,GroupName TEXT,UpdatedAt INTEGER, PRIMARY KEY (OwnerPubKey,GroupName))")
+	if err != nil {
+		return err
+	}
+	_, err = fsql.Exec(tx, "INSERT INTO OwnerGroup (OwnerPubKey,GroupName,UpdatedAt) SELECT OwnerPubKey,GroupName,MAX(UpdatedAt) FROM GroupMember GROUP BY OwnerPubKey,GroupName")
+	return err
+}
+
+// lowercasePubKeys rewrites pubkeys stored in upper or mixed case before events were
+// canonicalized to lowercase hex, so they match lookups again. Where the lowercase
+// row already exists it is newer and kept, the other one is dropped. The owner
+// directories are moved by LowercaseOwnerDirs.
+func lowercasePubKeys(tx *sql.Tx) error {
+
+	columns := [][2]string{
+		{"Repository", "OwnerPubKey"},
+		{"RepositoryPermission", "OwnerPubKey"},
+		{"RepositoryPermission", "TargetPubKey"},
+		{"RepositoryPushPolicy", "OwnerPubKey"},
+		{"RepositoryPushPayment", "OwnerPubKey"},
+		{"RepositoryPushPaymentIntent", "OwnerPubKey"},
+		{"OwnerGroup", "OwnerPubKey"},
+		{"GroupMember", "OwnerPubKey"},
+		{"GroupMember", "MemberPubKey"},
+		{"RepositoryGroupPermission", "OwnerPubKey"},
+		{"RepositoryStats", "OwnerPubKey"},
+		{"RepositoryEventStatus", "OwnerPubKey"},
+		{"RepositoryHook", "OwnerPubKey"},
+		{"Comment", "OwnerPubKey"},
+		{"Reaction", "OwnerPubKey"},
+		{"WebhookDelivery", "OwnerPubKey"},
+	}
+	for _, c := range columns {
+		table, column := c[0], c[1]
+		_, err := fsql.Exec(tx, "UPDATE OR IGNORE "+table+" SET "+column+"=lower("+column+") WHERE "+column+"<>lower("+column+")")
+		if err != nil {
+			return err
+		}
+		_, err = fsql.Exec(tx, "DELETE FROM "+table+" WHERE "+column+"<>lower("+column+")")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
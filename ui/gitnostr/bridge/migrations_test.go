@@ -0,0 +1,48 @@
+package bridge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLowercasePubKeys(t *testing.T) {
+	db := openTestDb(t)
+	upperOwner, upperWriter, upperMember := strings.ToUpper(testOwner), strings.ToUpper(testWriter), strings.ToUpper(testMember)
+	execTest(t, db,
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+upperOwner+"','old',0,0,1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+upperOwner+"','both',0,0,1)",
+		"INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+testOwner+"','both',1,0,2)",
+		"INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES ('"+upperOwner+"','old','"+upperWriter+"','WRITE',1)",
+		"INSERT INTO GroupMember (OwnerPubKey,GroupName,MemberPubKey,UpdatedAt) VALUES ('"+upperOwner+"','team','"+upperMember+"',1)",
+	)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := lowercasePubKeys(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT group_concat(OwnerPubKey||'/'||RepositoryName||'/'||PublicRead) FROM (SELECT * FROM Repository ORDER BY RepositoryName)", testOwner + "/both/1," + testOwner + "/old/0"},
+		{"SELECT OwnerPubKey||'/'||TargetPubKey FROM RepositoryPermission", testOwner + "/" + testWriter},
+		{"SELECT OwnerPubKey||'/'||MemberPubKey FROM GroupMember", testOwner + "/" + testMember},
+	}
+	for _, test := range tests {
+		var got string
+		if err := db.QueryRow(test.query).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// pruneMirrorRefs deletes the refs of a freshly imported repository that no
+// mirrorRefs pattern matches, like tags the fetch followed or branches of a full
+// clone, and logs them. HEAD is pointed at a remaining branch if its target was
+// pruned. Without mirrorRefs everything is kept.
+func pruneMirrorRefs(repoPath string, cfg Config) error {
+	if len(cfg.MirrorRefs) == 0 {
+		return nil
+	}
+
+	refs, err := ListRefs(repoPath)
+	if err != nil {
+		return err
+	}
+	var pruned []string
+	for ref := range refs {
+		kept := false
+		for _, pattern := range cfg.MirrorRefs {
+			if RefMatchesPattern(ref, pattern) {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			pruned = append(pruned, ref)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	sort.Strings(pruned)
+
+	var commands strings.Builder
+	for _, ref := range pruned {
+		fmt.Fprintf(&commands, "delete %s\n", ref)
+	}
+	cmd := cfg.Git("--git-dir", repoPath, "update-ref", "--stdin")
+	cmd.Stdin = strings.NewReader(commands.String())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git update-ref failed: %w: %s", err, output)
+	}
+	log.Printf("✂️ [Bridge] Pruned %d refs not in mirrorRefs from %s: %s\n", len(pruned), repoPath, strings.Join(pruned, ", "))
+
+	head, err := SymbolicHead(repoPath)
+	if err != nil {
+		return err
+	}
+	if head != "" && !headRefTargetExists(repoPath, head) {
+		if resolved := pickRecoverableHeadRef(repoPath, head, nil); resolved != "" {
+			output, err := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", resolved).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("git symbolic-ref HEAD failed: %w: %s", err, output)
+			}
+		}
+	}
+	return nil
+}
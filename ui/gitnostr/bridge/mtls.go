@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+// MtlsEnabled reports whether the API is also served with client certificates on mtlsAddr.
+func (cfg Config) MtlsEnabled() bool {
+	return cfg.MtlsAddr != ""
+}
+
+// MtlsConfig returns the TLS configuration of the mtlsAddr listener: its own server
+// certificate, and client certificates required to chain to mtlsClientCaFile.
+func (cfg Config) MtlsConfig() (*tls.Config, error) {
+	if cfg.MtlsCertFile == "" || cfg.MtlsKeyFile == "" || cfg.MtlsClientCaFile == "" {
+		return nil, fmt.Errorf("mtlsAddr needs mtlsCertFile, mtlsKeyFile and mtlsClientCaFile")
+	}
+	certFile, err := gitnostr.ResolvePath(cfg.MtlsCertFile)
+	if err != nil {
+		return nil, err
+	}
+	keyFile, err := gitnostr.ResolvePath(cfg.MtlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	caFile, err := gitnostr.ResolvePath(cfg.MtlsClientCaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load mtlsCertFile and mtlsKeyFile : %w", err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read mtlsClientCaFile : %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("mtlsClientCaFile %v holds no PEM certificate", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// requireClientCert only lets requests through that came in on the mtlsAddr listener
+// with a verified client certificate. The plain listener answers them with 403.
+func requireClientCert(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "Client certificate required, use the mutual TLS listener", http.StatusForbidden)
+			return
+		}
+		log.Printf("🔐 [Bridge API] Client certificate %q: %s %s\n", r.TLS.VerifiedChains[0][0].Subject.CommonName, r.Method, r.URL.Path)
+		next(w, r)
+	}
+}
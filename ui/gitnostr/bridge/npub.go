@@ -0,0 +1,139 @@
+package bridge
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// ResolveOwnerDir returns the directory holding the repositories of owner, a hex
+// pubkey or npub, below reposDir. That is <reposDir>/<hex> unless only the npub
+// entry exists: a symlink is followed to its target, and a real npub directory not
+// merged yet (see MergeNpubDir) is used as it is. If neither exists the hex
+// directory is returned, for the caller to create.
+func ResolveOwnerDir(reposDir, owner string) (string, error) {
+	ownerPubKey, err := gitnostr.DecodePubKey(owner)
+	if err != nil {
+		return "", err
+	}
+	hexPath := filepath.Join(reposDir, ownerPubKey)
+	if _, err := os.Lstat(hexPath); err == nil {
+		return hexPath, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	npub, err := nip19.EncodePublicKey(ownerPubKey, "")
+	if err != nil {
+		return "", fmt.Errorf("encode npub : %w", err)
+	}
+	npubPath := filepath.Join(reposDir, npub)
+	info, err := os.Lstat(npubPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return hexPath, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return npubPath, nil
+	}
+	target, err := filepath.EvalSymlinks(npubPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// A dangling link, e.g. to the hex directory before it was created
+		return hexPath, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolve %v : %w", npubPath, err)
+	}
+	return target, nil
+}
+
+// EnsureNpubSymlink links <reposDir>/<npub> to the owner's hex directory. Clone URLs
+// use the npub (per NIP-34) while repositories are stored by hex pubkey. It reports
+// whether the link was created or repointed.
+func EnsureNpubSymlink(reposDir, ownerPubKey string) (bool, error) {
+	if len(ownerPubKey) != 64 {
+		return false, fmt.Errorf("invalid pubkey %v", ownerPubKey)
+	}
+	if _, err := hex.DecodeString(ownerPubKey); err != nil {
+		return false, fmt.Errorf("invalid pubkey %v : %w", ownerPubKey, err)
+	}
+	npub, err := nip19.EncodePublicKey(ownerPubKey, "")
+	if err != nil {
+		return false, fmt.Errorf("encode npub : %w", err)
+	}
+
+	npubPath := filepath.Join(reposDir, npub)
+	if _, err := os.Lstat(npubPath); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		return true, os.Symlink(ownerPubKey, npubPath)
+	}
+
+	target, err := os.Readlink(npubPath)
+	if err != nil || target == ownerPubKey {
+		// Not a symlink (a real npub directory) or already correct.
+		return false, nil
+	}
+	if err := os.Remove(npubPath); err != nil {
+		return false, err
+	}
+	return true, os.Symlink(ownerPubKey, npubPath)
+}
+
+// MergeNpubDir moves the repositories of a real <reposDir>/<npub> directory, left
+// behind by a bug or by hand, into the owner's hex directory and replaces it with
+// the symlink. Repositories present in both are left where they are and returned as
+// conflicts; the npub directory is only replaced once nothing is left in it.
+func MergeNpubDir(reposDir, npub string) (int, []string, error) {
+	decoded, prefix, err := nip19.Decode(npub)
+	if err != nil || prefix != "npub" || len(decoded) != 32 {
+		return 0, nil, fmt.Errorf("invalid npub %v", npub)
+	}
+	ownerPubKey := hex.EncodeToString(decoded)
+
+	npubPath := filepath.Join(reposDir, npub)
+	info, err := os.Lstat(npubPath)
+	if err != nil || !info.IsDir() {
+		return 0, nil, err
+	}
+
+	hexPath := filepath.Join(reposDir, ownerPubKey)
+	if err := os.MkdirAll(hexPath, 0750); err != nil {
+		return 0, nil, err
+	}
+
+	entries, err := os.ReadDir(npubPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	merged := 0
+	var conflicts []string
+	for _, entry := range entries {
+		target := filepath.Join(hexPath, entry.Name())
+		if _, err := os.Lstat(target); err == nil {
+			conflicts = append(conflicts, entry.Name())
+			continue
+		}
+		if err := os.Rename(filepath.Join(npubPath, entry.Name()), target); err != nil {
+			return merged, conflicts, err
+		}
+		merged++
+	}
+	if len(conflicts) > 0 {
+		return merged, conflicts, nil
+	}
+
+	if err := os.Remove(npubPath); err != nil {
+		return merged, nil, err
+	}
+	return merged, nil, os.Symlink(ownerPubKey, npubPath)
+}
@@ -0,0 +1,147 @@
+package bridge
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseGate lets operators hold event processing at runtime. Events keep arriving
+// from relays and /api/event and wait until processing is resumed.
+type pauseGate struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	paused   bool
+	busy     bool
+	pausedAt time.Time
+}
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// enter blocks while processing is paused and marks an event as being processed.
+func (g *pauseGate) enter() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.busy = true
+	g.mu.Unlock()
+}
+
+func (g *pauseGate) leave() {
+	g.mu.Lock()
+	g.busy = false
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
+
+// pause stops processing and returns once the event being processed, if any, is done.
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	if !g.paused {
+		g.paused = true
+		g.pausedAt = time.Now()
+	}
+	for g.busy {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	g.paused = false
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
+
+func (g *pauseGate) status() (bool, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused, g.pausedAt
+}
+
+// requireAdmin writes an error and returns false unless the request carries
+// "Authorization: Bearer <adminToken>". Admin endpoints are off without an adminToken.
+func requireAdmin(w http.ResponseWriter, r *http.Request, cfg Config) bool {
+	if cfg.AdminToken == "" {
+		writeJSONError(w, http.StatusForbidden, "admin endpoints are disabled, set adminToken to enable them")
+		return false
+	}
+	if !isAdminRequest(r, cfg) {
+		writeJSONError(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
+
+// isAdminRequest reports whether r carries "Authorization: Bearer <adminToken>",
+// for endpoints that show admins more than anonymous callers.
+func isAdminRequest(r *http.Request, cfg Config) bool {
+	if cfg.AdminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+}
+
+// handlePauseAPI serves POST /api/pause and POST /api/resume.
+func handlePauseAPI(gate *pauseGate, cfg Config, pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		if pause {
+			gate.pause()
+			log.Printf("⏸️ [Bridge] Event processing paused, incoming events are held until /api/resume\n")
+		} else {
+			gate.resume()
+			log.Printf("▶️ [Bridge] Event processing resumed\n")
+		}
+
+		paused, pausedAt := gate.status()
+		response := map[string]any{"paused": paused}
+		if paused {
+			response["pausedAt"] = pausedAt.Unix()
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// handleHealthz reports that the bridge is up, also while processing is paused.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports 503 while event processing is paused, or when staleAfter is
+// set and the relay subscriptions haven't delivered any event for that long.
+// The time of the last event of each kind is included either way.
+func handleReadyz(gate *pauseGate, health *subscriptionHealth, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lastEvent := health.lastEventUnix()
+		paused, pausedAt := gate.status()
+		if paused {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "paused", "pausedAt": pausedAt.Unix(), "lastEvent": lastEvent})
+			return
+		}
+		if staleAfter := cfg.StaleAfter.Duration(); staleAfter > 0 {
+			if idle := health.idleFor(); idle > staleAfter {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "stale", "idleSeconds": int64(idle.Seconds()), "lastEvent": lastEvent})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "lastEvent": lastEvent})
+	}
+}
@@ -0,0 +1,153 @@
+package bridge
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// processEvent handles an event from either relay or direct API. It returns true
+// after permission changes, which may change who the ssh key subscription covers.
+func (s *Server) processEvent(event nostr.Event) bool {
+	db, cfg := s.db, s.cfg
+	// Rows and repository directories are keyed by lowercase hex, whatever casing the event used.
+	event.PubKey = strings.ToLower(event.PubKey)
+	log.Printf("📥 [Bridge] Received event: kind=%d, id=%s, pubkey=%s, created_at=%d\n", event.Kind, event.ID, event.PubKey, event.CreatedAt.Unix())
+	if cfg.MaxEventAge > 0 && time.Since(event.CreatedAt) > cfg.MaxEventAge.Duration() {
+		log.Printf("⏭️ [Bridge] Skipping event older than maxEventAge (%s): id=%s, created_at=%d\n", cfg.MaxEventAge.Duration(), event.ID, event.CreatedAt.Unix())
+		// The relay loop and POST /api/event mark events seen before they get here
+		s.seenMutex.Lock()
+		delete(s.seenEventIDs, event.ID)
+		s.seenMutex.Unlock()
+		return false
+	}
+	// A far future created_at would win every UpdatedAt<? guard and freeze the row.
+	if skew := time.Until(event.CreatedAt); skew > cfg.GetMaxFutureSkew() {
+		log.Printf("⚠️ [Bridge] Rejecting event created %s in the future (maxFutureSkew %s): id=%s, pubkey=%s, created_at=%d\n", skew.Round(time.Second), cfg.GetMaxFutureSkew(), event.ID, event.PubKey, event.CreatedAt.Unix())
+		return false
+	}
+	if s.DryRun {
+		s.recordPlan(event, planEvent(event, db, cfg))
+		return false
+	}
+
+	// Events the handlers fail on are quarantined in FailedEvent for gn failed
+	failed := false
+	fail := func(err error) bool {
+		failed = true
+		s.quarantine(event, err)
+		return false
+	}
+	defer func() { s.finishRetry(event.ID, failed) }()
+
+	switch event.Kind {
+	case protocol.KindRepository, protocol.KindRepositoryNIP34:
+		log.Printf("📦 [Bridge] Processing repository event: kind=%d id=%s, pubkey=%s\n", event.Kind, event.ID, event.PubKey)
+		permissionsChanged, err := s.handleRepositoryEvent(event)
+		if err != nil {
+			log.Printf("❌ [Bridge] Failed to handle repository event: %v\n", err)
+			return fail(err) || permissionsChanged
+		}
+		log.Printf("✅ [Bridge] Successfully processed repository event: id=%s\n", event.ID)
+
+		advanceSince(event.Kind, event.CreatedAt.Unix(), db)
+		// Added or removed maintainers change who the ssh key subscription covers
+		return permissionsChanged
+
+	case protocol.KindSshKey, protocol.KindGitIdentity:
+		var err error
+		if event.Kind == protocol.KindGitIdentity {
+			err = handleGitIdentityEvent(event, db, cfg)
+		} else {
+			err = handleSshKeyEvent(event, db, cfg)
+		}
+		if err != nil {
+			log.Println(err)
+			return fail(err)
+		}
+		if event.Kind == protocol.KindSshKey {
+			s.authorizedKeys.trigger()
+		}
+
+		advanceSince(protocol.KindSshKey, event.CreatedAt.Unix(), db) //Git identities are queried in the same filter as KindSshKey
+		return false
+
+	case protocol.KindRepositoryState:
+		log.Printf("📊 [Bridge] Processing repository state event: kind=%d id=%s, pubkey=%s\n", event.Kind, event.ID, event.PubKey)
+		err := s.handleRepositoryStateEvent(event)
+		if err != nil {
+			// Check if repository doesn't exist yet - don't mark as processed so it can be reprocessed
+			if err == ErrRepositoryNotExists {
+				log.Printf("⏳ [Bridge] State event deferred (repository not created yet): id=%s\n", event.ID)
+				log.Printf("💡 [Bridge] Event will be reprocessed when repository is created\n")
+				return false // Don't reconnect, but don't update Since either
+			}
+			log.Printf("❌ [Bridge] Failed to handle repository state event: %v\n", err)
+			return fail(err)
+		}
+		log.Printf("✅ [Bridge] Successfully processed repository state event: id=%s\n", event.ID)
+
+		advanceSince(protocol.KindRepositoryState, event.CreatedAt.Unix(), db)
+		return false // Don't need to reconnect
+
+	case protocol.KindStatusOpen, protocol.KindStatusApplied, protocol.KindStatusClosed, protocol.KindStatusDraft:
+		err := handleStatusEvent(event, db, cfg)
+		if err != nil {
+			log.Printf("❌ [Bridge] Failed to handle status event: %v\n", err)
+			return fail(err)
+		}
+
+		advanceSince(protocol.KindRepository, event.CreatedAt.Unix(), db) //Statuses are queried in the same filter as KindRepository
+		return false
+
+	case protocol.KindComment, protocol.KindTextNote, protocol.KindReaction:
+		var err error
+		if event.Kind == protocol.KindReaction {
+			err = handleReactionEvent(event, db, cfg)
+		} else {
+			err = handleCommentEvent(event, db, cfg)
+		}
+		if err != nil {
+			log.Printf("❌ [Bridge] Failed to handle kind %d event: %v\n", event.Kind, err)
+			return fail(err)
+		}
+
+		advanceSince(protocol.KindRepository, event.CreatedAt.Unix(), db) //Comments and reactions share the Since of KindRepository
+		return false
+
+	case protocol.KindRepositoryPermission, protocol.KindGroup, protocol.KindRepositoryHook:
+		var err error
+		switch event.Kind {
+		case protocol.KindGroup:
+			err = handleGroupEvent(event, db, cfg)
+		case protocol.KindRepositoryHook:
+			err = handleRepositoryHookEvent(event, db, cfg)
+		default:
+			err = s.handleRepositorPermission(event)
+		}
+		if err != nil {
+			log.Println(err)
+			return fail(err)
+		}
+
+		advanceSince(protocol.KindRepository, event.CreatedAt.Unix(), db) //Permissions, groups and hooks are queried in the same filter as KindRepository
+
+		// The authors of the ssh key subscription may have changed
+		return true
+
+	default:
+		s.health.recordUnhandled(event.Kind)
+		switch cfg.GetUnknownKinds() {
+		case UnknownKindsLog:
+			log.Printf("❔ [Bridge] Ignoring event of unhandled kind %d: id=%s, pubkey=%s\n", event.Kind, event.ID, event.PubKey)
+		case UnknownKindsStore:
+			log.Printf("❔ [Bridge] Storing event of unhandled kind %d: id=%s, pubkey=%s\n", event.Kind, event.ID, event.PubKey)
+			return fail(fmt.Errorf("unhandled kind %d", event.Kind))
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// mixedCase upper cases the first half of a hex pubkey.
+func mixedCase(pubKey string) string {
+	return strings.ToUpper(pubKey[:32]) + pubKey[32:]
+}
+
+// Pubkeys are stored and looked up as lowercase hex, so a grant published with one
+// casing applies to lookups with any other.
+func TestPubKeyCasing(t *testing.T) {
+	server := newTestServer(t)
+	execTest(t, server.DB(), "INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+testOwner+"','repo',0,0,1)")
+
+	content, err := json.Marshal(protocol.RepositoryPermission{RepositoryName: "repo", TargetPubKey: mixedCase(testWriter), Permission: protocol.PermissionWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.processEvent(nostr.Event{PubKey: strings.ToUpper(testOwner), CreatedAt: time.Now().Add(-time.Minute), Kind: protocol.KindRepositoryPermission, Content: string(content)})
+
+	var stored string
+	if err := server.DB().QueryRow("SELECT OwnerPubKey||'/'||TargetPubKey FROM RepositoryPermission WHERE RepositoryName='repo'").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != testOwner+"/"+testWriter {
+		t.Errorf("stored grant %s, want lowercase owner and target", stored)
+	}
+
+	wantPath, err := server.Config().RepoPath(testOwner, "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range []string{testOwner, strings.ToUpper(testOwner), mixedCase(testOwner)} {
+		for _, target := range []string{testWriter, strings.ToUpper(testWriter), mixedCase(testWriter)} {
+			access, err := ResolveAccess(server.DB(), owner, "repo", target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if access != AccessWrite {
+				t.Errorf("ResolveAccess(%s, %s) = %v, want write", owner[:8], target[:8], access)
+			}
+		}
+		if path, err := server.Config().RepoPath(owner, "repo"); err != nil || path != wantPath {
+			t.Errorf("RepoPath(%s) = %s, %v, want %s", owner[:8], path, err, wantPath)
+		}
+	}
+}
+
+// Events skipped for their age aren't remembered as seen, so a later copy isn't
+// dropped as a duplicate.
+func TestOldEventNotSeen(t *testing.T) {
+	server := newTestServer(t)
+	server.cfg.MaxEventAge = Duration(time.Hour)
+
+	event := nostr.Event{ID: "old", PubKey: testOwner, CreatedAt: time.Now().Add(-2 * time.Hour), Kind: protocol.KindRepositoryPermission}
+	server.seenEventIDs[event.ID] = true
+	server.processEvent(event)
+	if server.seenEventIDs[event.ID] {
+		t.Errorf("event older than maxEventAge is marked seen")
+	}
+}
@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ProxyURL returns the configured SOCKS5 proxy, or nil if none is configured.
+func (cfg Config) ProxyURL() (*url.URL, error) {
+	if cfg.Proxy == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy : %w", err)
+	}
+	if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+		return nil, fmt.Errorf("proxy must be a socks5:// url: %v", cfg.Proxy)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy has no host: %v", cfg.Proxy)
+	}
+	return proxyURL, nil
+}
+
+// ApplyRelayProxy routes relay websocket connections through the configured proxy.
+// go-nostr dials with websocket.DefaultDialer, so this affects the whole process.
+// Host names are resolved by the proxy, which makes .onion relays reachable over Tor.
+func (cfg Config) ApplyRelayProxy() error {
+	proxyURL, err := cfg.ProxyURL()
+	if err != nil || proxyURL == nil {
+		return err
+	}
+	relayProxy := *proxyURL
+	relayProxy.Scheme = "socks5" // the only scheme gorilla/websocket knows, it always resolves remotely
+	websocket.DefaultDialer.Proxy = http.ProxyURL(&relayProxy)
+	return nil
+}
+
+// GitProxyArgs returns the git options that send http(s) clones through the
+// configured proxy, resolving host names on the proxy side.
+func (cfg Config) GitProxyArgs() []string {
+	proxyURL, err := cfg.ProxyURL()
+	if err != nil || proxyURL == nil {
+		return nil
+	}
+	gitProxy := *proxyURL
+	gitProxy.Scheme = "socks5h"
+	return []string{"-c", "http.proxy=" + gitProxy.String()}
+}
+
+// IsOnionURL reports whether rawURL points to a Tor hidden service.
+func IsOnionURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(parsed.Hostname()), ".onion")
+}
@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// handleReactionEvent stores a NIP-25 reaction to a hosted repository or to one of
+// its issues or patches. Each reactor counts once per target: their newest reaction
+// replaces the previous one. A reaction to an issue or patch without a repository
+// "a" tag is attributed to the repositories the bridge has statuses or comments of
+// that issue or patch for.
+func handleReactionEvent(event nostr.Event, db *sql.DB, cfg Config) error {
+
+	reaction, err := protocol.ParseReaction(event)
+	if err != nil {
+		return fmt.Errorf("malformed reaction: %w", err)
+	}
+
+	repos := reaction.Repositories
+	if len(repos) == 0 {
+		repos, err = repositoriesOfEvent(db, reaction.TargetEventID)
+		if err != nil {
+			return err
+		}
+	}
+
+	createdAt := event.CreatedAt.Unix()
+	for _, repo := range repos {
+		var exists int
+		err := db.QueryRow("SELECT 1 FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", repo.PubKey, repo.Identifier).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("query repository failed: %w", err)
+		}
+
+		res, err := db.Exec("INSERT INTO Reaction (OwnerPubKey,RepositoryName,TargetEventId,ReactorPubKey,Content,EventId,CreatedAt) VALUES (?,?,?,?,?,?,?) ON CONFLICT DO UPDATE SET Content=?,EventId=?,CreatedAt=? WHERE CreatedAt<?;", repo.PubKey, repo.Identifier, reaction.TargetEventID, event.PubKey, reaction.Content, event.ID, createdAt, reaction.Content, event.ID, createdAt, createdAt)
+		if err != nil {
+			return fmt.Errorf("insert reaction failed: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("rows affected failed: %w", err)
+		}
+
+		if affected == 1 {
+			log.Printf("👍 [Bridge] Reaction stored: %s/%s target=%q reaction=%q from %s\n", repo.PubKey, repo.Identifier, reaction.TargetEventID, reaction.Content, event.PubKey)
+		}
+	}
+
+	return nil
+}
+
+// repositoriesOfEvent returns the repositories the bridge stored statuses or comments
+// of the issue or patch eventID for.
+func repositoriesOfEvent(db *sql.DB, eventID string) ([]protocol.Address, error) {
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName FROM RepositoryEventStatus WHERE TargetEventId=? UNION SELECT OwnerPubKey,RepositoryName FROM Comment WHERE RootEventId=?", eventID, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("query repositories of %s failed: %w", eventID, err)
+	}
+	defer rows.Close()
+
+	var repos []protocol.Address
+	for rows.Next() {
+		repo := protocol.Address{Kind: protocol.KindRepositoryNIP34}
+		if err := rows.Scan(&repo.PubKey, &repo.Identifier); err != nil {
+			return nil, fmt.Errorf("scan repository failed: %w", err)
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
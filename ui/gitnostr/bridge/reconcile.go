@@ -0,0 +1,165 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+)
+
+// ReconcileSummary counts what ReconcileRepositories did.
+type ReconcileSummary struct {
+	Checked  int      // Repository rows looked at
+	Created  int      // missing repositories created empty
+	HeadSet  int      // repositories whose HEAD was pointed back at the default branch
+	Symlinks int      // npub symlinks created or repointed
+	Problems []string // repositories that couldn't be repaired, with the reason
+}
+
+func (s *ReconcileSummary) problem(format string, args ...any) {
+	problem := fmt.Sprintf(format, args...)
+	log.Printf("⚠️ [Bridge] reconcile: %s\n", problem)
+	s.Problems = append(s.Problems, problem)
+}
+
+// Print writes the summary to stdout.
+func (s ReconcileSummary) Print() {
+	fmt.Printf("reconcile summary: %d repositories checked, %d created, %d HEADs set, %d npub symlinks fixed, %d problems\n", s.Checked, s.Created, s.HeadSet, s.Symlinks, len(s.Problems))
+	for _, problem := range s.Problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+}
+
+// ReconcileRepositories re-derives the repository directory from the database
+// without asking the relays: every Repository row gets its bare repository (created
+// empty if missing), HEAD on the stored default branch, the upload-pack settings
+// and owner directory mode new repositories get, and its owner's npub symlink.
+// Repositories with an import still in progress are left for the import to finish.
+func ReconcileRepositories(db *sql.DB, cfg Config) (ReconcileSummary, error) {
+	var summary ReconcileSummary
+
+	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	if err != nil {
+		return summary, fmt.Errorf("resolve repos path : %w", err)
+	}
+
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName,DefaultBranch FROM Repository ORDER BY OwnerPubKey,RepositoryName")
+	if err != nil {
+		return summary, fmt.Errorf("query repositories : %w", err)
+	}
+	type repository struct{ owner, name, defaultBranch string }
+	var repos []repository
+	for rows.Next() {
+		var r repository
+		if err := rows.Scan(&r.owner, &r.name, &r.defaultBranch); err != nil {
+			rows.Close()
+			return summary, fmt.Errorf("scan repository : %w", err)
+		}
+		repos = append(repos, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return summary, fmt.Errorf("query repositories : %w", err)
+	}
+
+	owners := map[string]bool{}
+	for _, r := range repos {
+		summary.Checked++
+		if !IsValidRepoName(r.name) {
+			summary.problem("%s/%s: invalid repository name", r.owner, r.name)
+			continue
+		}
+		if r.defaultBranch == "" {
+			r.defaultBranch = protocol.DefaultBranchName
+		}
+
+		repoPath, err := cfg.RepoPath(r.owner, r.name)
+		if err != nil {
+			summary.problem("%s/%s: %v", r.owner, r.name, err)
+			continue
+		}
+		repoParentPath := filepath.Dir(repoPath)
+		if err := os.MkdirAll(repoParentPath, 0750); err != nil {
+			summary.problem("%s/%s: %v", r.owner, r.name, err)
+			continue
+		}
+		if !owners[r.owner] && cfg.OwnerDirs() {
+			owners[r.owner] = true
+			_ = os.Chmod(repoParentPath, 0750)
+			if changed, err := EnsureNpubSymlink(reposDir, r.owner); err != nil {
+				summary.problem("%s: npub symlink: %v", r.owner, err)
+			} else if changed {
+				summary.Symlinks++
+			}
+		}
+
+		if url := ImportInProgress(repoPath); url != "" {
+			summary.problem("%s/%s: import from %s still in progress, skipped", r.owner, r.name, url)
+			continue
+		}
+
+		created, headSet, err := reconcileRepository(repoPath, r.defaultBranch, cfg)
+		if err != nil {
+			summary.problem("%s/%s: %v", r.owner, r.name, err)
+			continue
+		}
+		if created {
+			log.Printf("📦 [Bridge] reconcile: created missing repository %s/%s\n", r.owner, r.name)
+			summary.Created++
+		}
+		if headSet {
+			log.Printf("📌 [Bridge] reconcile: HEAD of %s/%s set to %s\n", r.owner, r.name, r.defaultBranch)
+			summary.HeadSet++
+		}
+	}
+	return summary, nil
+}
+
+// reconcileRepository brings one repository in line with its database row. It
+// reports whether the repository had to be created and whether HEAD was moved.
+func reconcileRepository(repoPath, defaultBranch string, cfg Config) (created bool, headSet bool, err error) {
+	if _, err := os.Stat(repoPath); errors.Is(err, fs.ErrNotExist) {
+		output, err := cfg.Git("init", "--bare", repoPath).CombinedOutput()
+		if err != nil {
+			return false, false, fmt.Errorf("git init --bare failed: %w: %s", err, output)
+		}
+		created = true
+	} else if err != nil {
+		return false, false, fmt.Errorf("git repository stat: %w", err)
+	}
+
+	unlock, err := LockRepoShared(repoPath)
+	if err != nil {
+		return created, false, fmt.Errorf("lock repository: %w", err)
+	}
+	defer unlock()
+
+	// An empty repository gets HEAD on the default branch like a newly created one;
+	// otherwise HEAD only moves there if the branch exists
+	headRef := "refs/heads/" + defaultBranch
+	current, err := SymbolicHead(repoPath)
+	if err != nil {
+		return created, false, err
+	}
+	if current != headRef && (created || headRefTargetExists(repoPath, headRef)) {
+		output, err := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", headRef).CombinedOutput()
+		if err != nil {
+			return created, false, fmt.Errorf("set HEAD to %s failed: %w: %s", headRef, err, output)
+		}
+		headSet = !created
+	}
+
+	ensureUploadPackBrowserCaps(repoPath, cfg)
+	if cfg.DumbHttp {
+		if err := UpdateServerInfo(repoPath); err != nil {
+			return created, headSet, err
+		}
+	}
+	return created, headSet, nil
+}
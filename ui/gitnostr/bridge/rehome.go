@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// OwnerTables lists the tables keyed by the owner's pubkey, moved by RehomeOwner.
+var OwnerTables = []string{
+	"Repository",
+	"RepositoryPermission",
+	"RepositoryPushPolicy",
+	"RepositoryPushPayment",
+	"RepositoryPushPaymentIntent",
+	"OwnerGroup",
+	"GroupMember",
+	"RepositoryGroupPermission",
+	"RepositoryStats",
+	"RepositoryEventStatus",
+	"RepositoryHook",
+	"Comment",
+	"Reaction",
+	"WebhookDelivery",
+}
+
+// RehomeOwner moves everything oldPubKey owns in the database to newPubKey in one
+// transaction. Grants the old key received on other owners' repositories stay as
+// they are; the new key needs its own.
+func RehomeOwner(db *sql.DB, oldPubKey, newPubKey string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("rehome owner begin : %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range OwnerTables {
+		_, err := tx.Exec("UPDATE "+table+" SET OwnerPubKey=? WHERE OwnerPubKey=?", newPubKey, oldPubKey)
+		if err != nil {
+			return fmt.Errorf("rehome owner %v : %w", table, err)
+		}
+	}
+	// The new owner has implicit ADMIN, a grant to itself is redundant.
+	_, err = tx.Exec("DELETE FROM RepositoryPermission WHERE OwnerPubKey=? AND TargetPubKey=?", newPubKey, newPubKey)
+	if err != nil {
+		return fmt.Errorf("rehome owner self permission : %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("rehome owner commit : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RelayConfig is a relay the bridge connects to and what it uses it for.
+// In the config file a plain URL string is a read-only relay.
+type RelayConfig struct {
+	URL   string `json:"url"`
+	Read  bool   `json:"read"`
+	Write bool   `json:"write"`
+}
+
+type relayConfigJSON RelayConfig
+
+func (r RelayConfig) MarshalJSON() ([]byte, error) {
+	if r.Read && !r.Write {
+		return json.Marshal(r.URL)
+	}
+	return json.Marshal(relayConfigJSON(r))
+}
+
+func (r *RelayConfig) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*r = RelayConfig{URL: url, Read: true}
+		return nil
+	}
+
+	var relay relayConfigJSON
+	if err := json.Unmarshal(data, &relay); err != nil {
+		return fmt.Errorf("relay must be a URL or {\"url\",\"read\",\"write\"}: %s", data)
+	}
+	*r = RelayConfig(relay)
+	return nil
+}
+
+// RelayURLs returns the URLs of all configured relays.
+func (cfg Config) RelayURLs() []string {
+	urls := make([]string, 0, len(cfg.Relays))
+	for _, relay := range cfg.Relays {
+		urls = append(urls, relay.URL)
+	}
+	return urls
+}
+
+// WriteRelayURLs returns the URLs of the relays the bridge may publish to.
+// A read-only bridge publishes nowhere.
+func (cfg Config) WriteRelayURLs() []string {
+	if cfg.ReadOnly {
+		return nil
+	}
+	var urls []string
+	for _, relay := range cfg.Relays {
+		if relay.Write {
+			urls = append(urls, relay.URL)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,167 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// GetRelayListRefresh returns how often the relay list of relayListPubKey is fetched
+// again, defaulting to 1h.
+func (cfg Config) GetRelayListRefresh() time.Duration {
+	if cfg.RelayListRefresh <= 0 {
+		return time.Hour
+	}
+	return cfg.RelayListRefresh.Duration()
+}
+
+// fetchRelayList returns the relays of the newest NIP-65 relay list (kind 10002) of
+// pubKey that the readable relays of relays know of. Every listed relay is read from,
+// whatever its read or write marker: the bridge wants the events the pubkey sees as
+// well as the ones it publishes.
+func fetchRelayList(relays []RelayConfig, pubKey string, timeout time.Duration) ([]RelayConfig, error) {
+	var newest *nostr.Event
+	reached := 0
+	for _, relayCfg := range relays {
+		if !relayCfg.Read {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		relay, err := nostr.RelayConnectContext(ctx, relayCfg.URL)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ [Bridge] relay list: failed to connect to %s: %v\n", relayCfg.URL, err)
+			continue
+		}
+		reached++
+		for _, event := range relay.QuerySync(nostr.Filter{Kinds: []int{protocol.KindRelayList}, Authors: []string{pubKey}, Limit: 1}, timeout) {
+			if event.PubKey != pubKey || event.Kind != protocol.KindRelayList {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			if newest == nil || event.CreatedAt.After(newest.CreatedAt) {
+				event := event
+				newest = &event
+			}
+		}
+		relay.Close()
+	}
+	if reached == 0 {
+		return nil, fmt.Errorf("no relay reachable to fetch the relay list from")
+	}
+	if newest == nil {
+		return nil, nil
+	}
+
+	var listed []RelayConfig
+	for _, tag := range newest.Tags {
+		if len(tag) < 2 || tag[0] != "r" {
+			continue
+		}
+		url := strings.TrimSpace(tag[1])
+		if !strings.HasPrefix(url, "wss://") && !strings.HasPrefix(url, "ws://") {
+			continue
+		}
+		listed = append(listed, RelayConfig{URL: url, Read: true})
+	}
+	return listed, nil
+}
+
+// mergeRelays returns the configured relays followed by the listed ones they don't
+// already contain. Configured relays keep their own read and write policy.
+func mergeRelays(configured, listed []RelayConfig) []RelayConfig {
+	merged := append([]RelayConfig(nil), configured...)
+	known := make(map[string]bool, len(configured))
+	for _, relay := range configured {
+		known[normalizeRelayURL(relay.URL)] = true
+	}
+	for _, relay := range listed {
+		url := normalizeRelayURL(relay.URL)
+		if known[url] {
+			continue
+		}
+		known[url] = true
+		merged = append(merged, relay)
+	}
+	return merged
+}
+
+// normalizeRelayURL lets relay URLs that only differ in case or a trailing slash match.
+func normalizeRelayURL(url string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(url)), "/")
+}
+
+// sameRelays reports whether a and b list the same relays with the same policies.
+func sameRelays(a, b []RelayConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// relays returns the relays the relay loop connects to: the configured ones and
+// those of the relay list of relayListPubKey.
+func (s *Server) relays() []RelayConfig {
+	s.relaysMutex.Lock()
+	defer s.relaysMutex.Unlock()
+	return s.currentRelays
+}
+
+// refreshRelayList fetches the relay list of relayListPubKey and reports whether it
+// changed the relays. A failed fetch keeps the relays from the last one.
+func (s *Server) refreshRelayList() bool {
+	listed, err := fetchRelayList(s.cfg.Relays, s.relayListPubKey, s.cfg.GetRelayConnectTimeout())
+	if err != nil {
+		log.Printf("⚠️ [Bridge] Failed to fetch the relay list of %s: %v\n", s.relayListPubKey, err)
+		return false
+	}
+	// Like configured ones, .onion relays can only be reached through the proxy
+	reachable := listed[:0]
+	for _, relay := range listed {
+		if s.cfg.Proxy != "" || !IsOnionURL(relay.URL) {
+			reachable = append(reachable, relay)
+		}
+	}
+	merged := mergeRelays(s.cfg.Relays, reachable)
+
+	s.relaysMutex.Lock()
+	defer s.relaysMutex.Unlock()
+	if sameRelays(merged, s.currentRelays) {
+		return false
+	}
+	log.Printf("📡 [Bridge] Relay list of %s has %d usable relays, using %d relays in total\n", s.relayListPubKey, len(reachable), len(merged))
+	s.currentRelays = merged
+	return true
+}
+
+// runRelayListRefresher fetches the relay list again every relayListRefresh and has
+// the relay loop reconnect when the relays changed.
+func (s *Server) runRelayListRefresher(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.GetRelayListRefresh())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.refreshRelayList() {
+				select {
+				case s.relaysChanged <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
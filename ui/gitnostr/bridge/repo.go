@@ -1,7 +1,143 @@
 package bridge
 
-import "strings"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
 
+// MaxRepoNameLength is the longest repository name accepted.
+const MaxRepoNameLength = 100
+
+// reservedRepoNames can't be used as file names on Windows, which breaks clones there.
+var reservedRepoNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// IsValidRepoName reports whether repoName is safe to use as a directory name and
+// git argument: 1 to MaxRepoNameLength characters, no whitespace, control characters,
+// dots or path separators, not starting with '-' and not a reserved device name.
 func IsValidRepoName(repoName string) bool {
-	return len(repoName) > 0 && !strings.ContainsAny(repoName, " /.")
+	if len(repoName) == 0 || len(repoName) > MaxRepoNameLength {
+		return false
+	}
+	if strings.HasPrefix(repoName, "-") || reservedRepoNames[strings.ToUpper(repoName)] {
+		return false
+	}
+	for _, r := range repoName {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("/\\.", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValidRepoName is like the package IsValidRepoName but additionally requires names
+// to match the repoNamePattern setting, if set.
+func (cfg Config) IsValidRepoName(repoName string) bool {
+	if !IsValidRepoName(repoName) {
+		return false
+	}
+	if cfg.RepoNamePattern == "" {
+		return true
+	}
+	matched, err := regexp.MatchString(cfg.RepoNamePattern, repoName)
+	return err == nil && matched
+}
+
+// logInvalidRepoNames logs the repositories in the database whose names are no longer
+// valid. Those failing the built-in rules, e.g. ones created before they were
+// tightened, are refused by the ssh wrapper and the API until renamed; those only
+// failing repoNamePattern are kept, the pattern applies to new repositories.
+func logInvalidRepoNames(db *sql.DB, cfg Config) error {
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName FROM Repository")
+	if err != nil {
+		return fmt.Errorf("query repository names : %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var owner, name string
+		if err := rows.Scan(&owner, &name); err != nil {
+			return fmt.Errorf("scan repository name : %w", err)
+		}
+		if !IsValidRepoName(name) {
+			log.Printf("⚠️ [Bridge] Repository %s/%q has an invalid name and can't be accessed, rename it\n", owner, name)
+		} else if !cfg.IsValidRepoName(name) {
+			log.Printf("ℹ️ [Bridge] Repository %s/%s doesn't match repoNamePattern, keeping it as it already exists\n", owner, name)
+		}
+	}
+	return rows.Err()
+}
+
+func IsValidGroupName(groupName string) bool {
+	return IsValidRepoName(groupName)
+}
+
+// FindRepoNameCollision returns the name of another repository of the owner that
+// differs from repoName only in case, looking at both the database and the owner's
+// directory. On case-insensitive filesystems both would share one directory, so
+// the name that exists first wins and the other is rejected.
+func FindRepoNameCollision(db *sql.DB, cfg Config, ownerPubKey, repoName string) (string, error) {
+	var existing string
+	err := db.QueryRow("SELECT RepositoryName FROM Repository WHERE OwnerPubKey=? AND RepositoryName=? COLLATE NOCASE AND RepositoryName<>? ORDER BY UpdatedAt LIMIT 1", ownerPubKey, repoName, repoName).Scan(&existing)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("query repository collision : %w", err)
+	}
+
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(filepath.Dir(repoPath))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	// In the flat layout the directory is shared with other owners, whose repositories
+	// have a different prefix than <owner>-
+	base := filepath.Base(repoPath)
+	prefix := strings.TrimSuffix(base, repoName+".git")
+	for _, entry := range entries {
+		if entry.Name() != base && strings.EqualFold(entry.Name(), base) && strings.HasPrefix(entry.Name(), prefix) {
+			return strings.TrimSuffix(strings.TrimPrefix(entry.Name(), prefix), ".git"), nil
+		}
+	}
+	return "", nil
+}
+
+// importSentinelSuffix names the file next to a repository directory that marks an
+// import (clone) as in progress. It holds the URL being imported from.
+const importSentinelSuffix = ".importing"
+
+// ImportSentinelPath returns the sentinel file marking an import into repoPath.
+func ImportSentinelPath(repoPath string) string {
+	return repoPath + importSentinelSuffix
+}
+
+// ImportInProgress returns the URL an unfinished import into repoPath was started
+// from, or "" when no import is in progress. A sentinel left behind by a restart
+// means the repository directory holds a partial clone.
+func ImportInProgress(repoPath string) string {
+	content, err := os.ReadFile(ImportSentinelPath(repoPath))
+	if err != nil {
+		return ""
+	}
+	if url := strings.TrimSpace(string(content)); url != "" {
+		return url
+	}
+	return "unknown"
 }
@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestIsValidRepoName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"repo", true},
+		{"my-repo_2", true},
+		{"Repo", true},
+		{"-repo", false},
+		{"repo-", true},
+		{"", false},
+		{strings.Repeat("a", MaxRepoNameLength), true},
+		{strings.Repeat("a", MaxRepoNameLength+1), false},
+		{".hidden", false},
+		{"repo.git", false},
+		{"..", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a b", false},
+		{"a\tb", false},
+		{"a\x00b", false},
+		{"a\nb", false},
+		{"CON", false},
+		{"con", false},
+		{"Lpt1", false},
+		{"console", true},
+		{"COM10", true},
+		{"ünïcödé", true},
+	}
+	for _, test := range tests {
+		if got := IsValidRepoName(test.name); got != test.valid {
+			t.Errorf("IsValidRepoName(%q) = %v, want %v", test.name, got, test.valid)
+		}
+	}
+}
+
+func TestConfigIsValidRepoName(t *testing.T) {
+	cfg := Config{RepoNamePattern: "^[a-z0-9][a-z0-9_-]*$"}
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"repo", true},
+		{"my-repo_2", true},
+		{"Repo", false},
+		{"_repo", false},
+		{"CON", false},
+		{"con", false},
+		{"a.b", false},
+	}
+	for _, test := range tests {
+		if got := cfg.IsValidRepoName(test.name); got != test.valid {
+			t.Errorf("IsValidRepoName(%q) with pattern %s = %v, want %v", test.name, cfg.RepoNamePattern, got, test.valid)
+		}
+	}
+
+	if !(Config{}).IsValidRepoName("Repo") {
+		t.Error("a name was rejected without repoNamePattern")
+	}
+	invalid := Config{RepositoryDir: "repos", DbFile: "db.sqlite", Relays: []RelayConfig{{URL: "wss://relay.example.com", Read: true}}, RepoNamePattern: "("}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "repoNamePattern") {
+		t.Errorf("Validate() = %v, want the invalid repoNamePattern reported", err)
+	}
+}
+
+// repoNamePattern applies to new repositories; announcements of repositories that
+// already have a row are still applied.
+func TestRepoNamePatternGrandfathersExistingRepos(t *testing.T) {
+	server := newTestServer(t)
+	server.cfg.RepoNamePattern = "^[a-z]+$"
+	ownerKey := nostr.GeneratePrivateKey()
+	ownerPubKey, _ := nostr.GetPublicKey(ownerKey)
+	execTest(t, server.DB(), "INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES ('"+ownerPubKey+"','Old_Repo',0,0,1)")
+	now := time.Now().Add(-time.Minute)
+
+	announce := func(repoName string) error {
+		t.Helper()
+		_, err := server.handleRepositoryEvent(signedEvent(t, ownerKey, protocol.KindRepositoryNIP34, now, nostr.Tags{{"d", repoName}}))
+		return err
+	}
+	if err := announce("New_Repo"); err == nil {
+		t.Error("created a repository whose name doesn't match repoNamePattern")
+	}
+	if err := announce("Old_Repo"); err != nil {
+		t.Errorf("update of an existing repository not matching repoNamePattern failed: %v", err)
+	}
+	var publicRead bool
+	if err := server.DB().QueryRow("SELECT PublicRead FROM Repository WHERE OwnerPubKey=? AND RepositoryName='Old_Repo'", ownerPubKey).Scan(&publicRead); err != nil || !publicRead {
+		t.Errorf("existing repository wasn't updated: publicRead=%v, %v", publicRead, err)
+	}
+	if err := announce("newrepo"); err != nil {
+		t.Errorf("creating a repository matching repoNamePattern failed: %v", err)
+	}
+}
@@ -0,0 +1,713 @@
+package bridge
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// repositoryAnnouncement is what a kind 51 or 30617 event says about a repository.
+type repositoryAnnouncement struct {
+	repo        protocol.Repository
+	repoName    string
+	cloneUrls   []string
+	bundles     []BundleSource // NIP-34 only
+	sourceUrl   string
+	maintainers []string // NIP-34 only
+	description string   // NIP-34 only
+	topics      []string // NIP-34 only
+}
+
+// parseRepositoryEvent reads a legacy kind 51 or NIP-34 kind 30617 repository event.
+func parseRepositoryEvent(event nostr.Event) (repositoryAnnouncement, error) {
+	var repo protocol.Repository
+	var repoName string
+	var cloneUrls []string
+	var sourceUrl string
+	var maintainers []string
+	var description string
+	var topics []string
+	var isDeleted bool
+	var isArchived bool
+
+	// Handle NIP-34 events (kind 30617) - data is in tags, not content
+	if event.Kind == protocol.KindRepositoryNIP34 {
+		// Extract repository name from "d" tag
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "d" {
+				repoName = tag[1]
+				break
+			}
+		}
+		if repoName == "" {
+			return repositoryAnnouncement{}, fmt.Errorf("NIP-34 event missing 'd' tag with repository name")
+		}
+
+		// Extract clone URLs from "clone" tags
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "clone" {
+				cloneUrl := tag[1]
+				if cloneUrl != "" {
+					cloneUrls = append(cloneUrls, cloneUrl)
+				}
+			}
+			if len(tag) >= 2 && tag[0] == "source" {
+				sourceUrl = tag[1]
+			}
+			if len(tag) >= 2 && tag[0] == "description" {
+				description = tag[1]
+			}
+			if len(tag) >= 2 && tag[0] == "t" && tag[1] != "" {
+				topics = append(topics, tag[1])
+			}
+		}
+
+		// Extract deleted/archived flags from content (if present) or tags
+		if event.Content != "" {
+			err := json.Unmarshal([]byte(event.Content), &repo)
+			if err == nil {
+				isDeleted = repo.Deleted
+				isArchived = repo.Archived
+			}
+		}
+		// Also check for deleted/archived in tags (some implementations use this)
+		// and visibility tags (gittr extension: ["public-read","true|false"],
+		// ["public-write","true|false"]). Missing tags keep the NIP-34 defaults
+		// (public read, owner-only write) so older announcements stay public.
+		publicRead := true
+		publicWrite := false
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "deleted" && tag[1] == "true" {
+				isDeleted = true
+			}
+			if len(tag) >= 2 && tag[0] == "archived" && tag[1] == "true" {
+				isArchived = true
+			}
+			if len(tag) >= 2 && tag[0] == "public-read" && tag[1] == "false" {
+				publicRead = false
+			}
+			if len(tag) >= 2 && tag[0] == "public-write" && tag[1] == "true" {
+				publicWrite = true
+			}
+			if len(tag) >= 2 && tag[0] == "public-write-refs" {
+				repo.PublicWriteRefs = append(repo.PublicWriteRefs, tag[1:]...)
+			}
+		}
+
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && (tag[0] == "maintainers" || tag[0] == "merge_maintainers") {
+				for _, v := range tag[1:] {
+					v = strings.ToLower(strings.TrimSpace(v))
+					if len(v) == 64 {
+						if _, err := hex.DecodeString(v); err == nil {
+							maintainers = append(maintainers, v)
+						}
+					}
+				}
+			}
+		}
+
+		// Set values for NIP-34 (visibility from tags, defaults above)
+		repo.RepositoryName = repoName
+		repo.PublicRead = publicRead
+		repo.PublicWrite = publicWrite
+		repo.Deleted = isDeleted
+		repo.Archived = isArchived
+		repo.DefaultBranch = protocol.AnnouncedDefaultBranch(event.Tags)
+	} else {
+		// Legacy kind 51 - parse from JSON content
+		err := json.Unmarshal([]byte(event.Content), &repo)
+		if err != nil {
+			return repositoryAnnouncement{}, fmt.Errorf("malformed repository: %w : %v", err, event.Content)
+		}
+		repoName = repo.RepositoryName
+	}
+
+	var bundles []BundleSource
+	if event.Kind == protocol.KindRepositoryNIP34 {
+		bundles = ParseBundleTags(event.Tags)
+	}
+
+	return repositoryAnnouncement{repo: repo, repoName: repoName, cloneUrls: cloneUrls, bundles: bundles, sourceUrl: sourceUrl, maintainers: maintainers, description: description, topics: topics}, nil
+}
+
+func (s *Server) handleRepositoryEvent(event nostr.Event) (bool, error) {
+	db, cfg := s.db, s.cfg
+	announcement, err := parseRepositoryEvent(event)
+	if err != nil {
+		return false, err
+	}
+	repo := announcement.repo
+	repoName := announcement.repoName
+	cloneUrls := announcement.cloneUrls
+	sourceUrl := announcement.sourceUrl
+
+	if !IsValidRepoName(repoName) {
+		return false, fmt.Errorf("invalid repository name: %v", repoName)
+	}
+
+	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	if err != nil {
+		return false, fmt.Errorf("resolve repos path : %w", err)
+	}
+	repoPath, err := cfg.RepoPath(event.PubKey, repoName)
+	if err != nil {
+		return false, err
+	}
+	repoParentPath := filepath.Dir(repoPath)
+
+	if repo.Deleted {
+		log.Printf("🗑️ [Bridge] Repository marked deleted: pubkey=%s repo=%s\n", event.PubKey, repoName)
+		// Recorded with the deletion, the row is gone afterwards
+		var wasPublicRead bool
+		_ = db.QueryRow("SELECT PublicRead FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", event.PubKey, repoName).Scan(&wasPublicRead)
+		_, err := db.Exec("DELETE FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		if err != nil {
+			return false, fmt.Errorf("delete repository row failed: %w", err)
+		}
+		_, err = db.Exec("DELETE FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		if err != nil {
+			return false, fmt.Errorf("delete repository permissions failed: %w", err)
+		}
+		_, _ = db.Exec("DELETE FROM RepositoryGroupPermission WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM RepositoryEventStatus WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM RepositoryStats WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM RepositoryPushPolicy WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM RepositoryPushPayment WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM RepositoryHook WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM Comment WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM Reaction WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		_, _ = db.Exec("DELETE FROM WebhookDelivery WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
+		if grace := cfg.DeleteGracePeriod.Duration(); grace > 0 {
+			if _, err := os.Stat(repoPath); err == nil {
+				trashPath, err := TrashRepository(reposDir, repoPath, event.PubKey, repoName)
+				if err != nil {
+					return true, err
+				}
+				log.Printf("🗑️ [Bridge] Moved %s/%s to %s, it is removed after %v\n", event.PubKey, repoName, trashPath, grace)
+			}
+		} else if err := os.RemoveAll(repoPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return true, fmt.Errorf("remove repository path failed: %w", err)
+		}
+		s.emit(SinkEvent{Type: SinkRepositoryDeleted, Owner: event.PubKey, Repo: repoName, PubKey: event.PubKey, EventID: event.ID, Data: map[string]any{
+			"publicRead": wasPublicRead,
+		}})
+		// The grants went with the repository, which may change who the ssh key subscription covers
+		return true, nil
+	}
+
+	// Repos differing only in case would share a directory on case-insensitive
+	// filesystems; the name that exists first keeps it.
+	var exists int
+	err = db.QueryRow("SELECT COUNT(*) FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", event.PubKey, repoName).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query repository failed: %w", err)
+	}
+	if exists == 0 {
+		// Repositories created before repoNamePattern was set keep their names
+		if !cfg.IsValidRepoName(repoName) {
+			return false, fmt.Errorf("repository name %v doesn't match repoNamePattern", repoName)
+		}
+		collision, err := FindRepoNameCollision(db, cfg, event.PubKey, repoName)
+		if err != nil {
+			return false, fmt.Errorf("check repository name collision failed: %w", err)
+		}
+		if collision != "" {
+			log.Printf("⚠️ [Bridge] Repository name collision: %s/%s differs only in case from existing %s, ignoring it\n", event.PubKey, repoName, collision)
+			return false, fmt.Errorf("repository %s collides with %s on case-insensitive filesystems", repoName, collision)
+		}
+	}
+
+	var publicWriteRefs []string
+	for _, pattern := range repo.PublicWriteRefs {
+		if !IsValidRefPattern(pattern) {
+			log.Printf("⚠️ [Bridge] Ignoring invalid public-write-refs pattern %q on %s/%s\n", pattern, event.PubKey, repoName)
+			continue
+		}
+		publicWriteRefs = append(publicWriteRefs, pattern)
+	}
+	publicWriteRefsValue := strings.Join(publicWriteRefs, " ")
+	// An empty scope means the whole repository, so a scope without a valid pattern
+	// must not widen public write to every ref
+	if repo.PublicWrite && len(repo.PublicWriteRefs) > 0 && len(publicWriteRefs) == 0 {
+		log.Printf("⚠️ [Bridge] No valid public-write-refs pattern on %s/%s, storing it without public write\n", event.PubKey, repoName)
+		repo.PublicWrite = false
+	}
+
+	// Metadata for /api/repos/{owner}/{repo}/meta, stored so that endpoint never runs git.
+	// Topics are space separated, like PublicWriteRefs.
+	topicsValue := strings.Join(announcement.topics, " ")
+	cloneUrlValue := ""
+	if len(cloneUrls) > 0 {
+		cloneUrlValue = cloneUrls[0]
+	}
+
+	updatedAt := event.CreatedAt.Unix()
+
+	// The repository row and the maintainer grants derived from it change together,
+	// so a failure can't leave grants that disagree with the stored announcement.
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("begin repository update failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,PublicWriteRefs,Description,Topics,CloneUrl,UpdatedAt) VALUES (?,?,?,?,?,?,?,?,?) ON CONFLICT DO UPDATE SET PublicRead=?,PublicWrite=?,PublicWriteRefs=?,Description=?,Topics=?,CloneUrl=?,UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, repoName, repo.PublicRead, repo.PublicWrite, publicWriteRefsValue, announcement.description, topicsValue, cloneUrlValue, updatedAt, repo.PublicRead, repo.PublicWrite, publicWriteRefsValue, announcement.description, topicsValue, cloneUrlValue, updatedAt, updatedAt)
+	if err != nil {
+		return false, fmt.Errorf("insert repository failed: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected failed: %w", err)
+	}
+
+	// Sync NIP-34 maintainers into RepositoryPermission (Permission=WRITE) so
+	// SSH and web-API ACLs cover gittr contributors. Synced rows are marked with
+	// Source=maintainers: a newer announcement refreshes the listed ones and revokes
+	// the rest, while grants from permission events are left alone. Only the newest
+	// announcement is synced, so a late older one can't bring back a removed maintainer.
+	var granted, revoked int64
+	if event.Kind == protocol.KindRepositoryNIP34 && affected == 1 {
+		granted, revoked, err = SyncMaintainers(tx, event.PubKey, repoName, announcement.maintainers, updatedAt)
+		if err != nil {
+			return false, fmt.Errorf("sync maintainers of %s/%s failed: %w", event.PubKey, repoName, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("commit repository update failed: %w", err)
+	}
+	permissionsChanged := granted > 0 || revoked > 0
+
+	if affected == 1 {
+		log.Printf("✅ [Bridge] Repository updated: pubkey=%s repo=%s\n", event.PubKey, repoName)
+		s.emit(SinkEvent{Type: SinkRepositoryUpdated, Owner: event.PubKey, Repo: repoName, PubKey: event.PubKey, EventID: event.ID, Data: map[string]any{
+			"publicRead":  repo.PublicRead,
+			"publicWrite": repo.PublicWrite,
+		}})
+	}
+	if revoked > 0 {
+		log.Printf("🔑 [Bridge] Revoked %d removed maintainer(s) of %s/%s\n", revoked, event.PubKey, repoName)
+		s.emit(SinkEvent{Type: SinkPermissionChanged, Owner: event.PubKey, Repo: repoName, PubKey: event.PubKey, EventID: event.ID, Data: map[string]any{
+			"revokedMaintainers": revoked,
+		}})
+	}
+
+	// Optional repo-level push cost policy from NIP-34 tags.
+	// Tag format: ["push_cost_sats", "<integer>"].
+	pushCostSats := 0
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "push_cost_sats" {
+			if parsed, parseErr := strconv.Atoi(strings.TrimSpace(tag[1])); parseErr == nil && parsed >= 0 {
+				pushCostSats = parsed
+			}
+			break
+		}
+	}
+	_, err = db.Exec(
+		"INSERT INTO RepositoryPushPolicy (OwnerPubKey,RepositoryName,PushCostSats,UpdatedAt) VALUES (?,?,?,?) ON CONFLICT DO UPDATE SET PushCostSats=?,UpdatedAt=? WHERE UpdatedAt<=?;",
+		event.PubKey, repoName, pushCostSats, updatedAt,
+		pushCostSats, updatedAt, updatedAt,
+	)
+	if err != nil {
+		return permissionsChanged, fmt.Errorf("insert push policy failed: %w", err)
+	}
+
+	err = os.MkdirAll(repoParentPath, 0750)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			//Ignore
+		} else {
+			return permissionsChanged, fmt.Errorf("repository path mkdir: %w", err)
+		}
+	}
+	// HTTPS git (git-http-backend via fcgiwrap as www-data) must traverse owner dirs.
+	// www-data is typically in supplementary group `git-nostr`; group needs rx on this directory.
+	// Older installs used 0700 here, which breaks https://git…/<pubkey>/<repo>.git (404) while SSH still works.
+	if st, err := os.Stat(repoParentPath); err == nil && st.IsDir() && cfg.OwnerDirs() {
+		_ = os.Chmod(repoParentPath, 0750)
+	}
+
+	// Check if repository already exists
+	repoExists := false
+	_, err = os.Stat(repoPath)
+	if err == nil {
+		// A partial clone left by a restart is resumed by cloneRepository below
+		repoExists = ImportInProgress(repoPath) == ""
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return permissionsChanged, fmt.Errorf("git repository stat: %w", err)
+	}
+
+	// If repo doesn't exist, try to clone from source URL or clone URLs
+	if !repoExists {
+		defer func() {
+			if _, err := os.Stat(repoPath); err == nil {
+				if cfg.DumbHttp {
+					if err := UpdateServerInfo(repoPath); err != nil {
+						log.Printf("⚠️ [Bridge] %v\n", err)
+					}
+				}
+				s.emit(SinkEvent{Type: SinkRepositoryCreated, Owner: event.PubKey, Repo: repoName, PubKey: event.PubKey, EventID: event.ID})
+			}
+		}()
+		// Priority 1: Try to clone from source URL (GitHub/GitLab/Codeberg)
+		if sourceUrl != "" && (strings.Contains(sourceUrl, "github.com") || strings.Contains(sourceUrl, "gitlab.com") || strings.Contains(sourceUrl, "codeberg.org")) {
+			// Convert source URL to clone URL
+			cloneUrl := sourceUrl
+			if !strings.HasSuffix(cloneUrl, ".git") {
+				cloneUrl = cloneUrl + ".git"
+			}
+			log.Printf("🔍 [Bridge] Attempting to clone from source URL: %s\n", cloneUrl)
+			err := s.cloneRepository(cloneUrl, repoPath, cfg)
+			if err == nil {
+				log.Printf("✅ [Bridge] Successfully cloned repository from source URL: %s\n", cloneUrl)
+				ensureUploadPackBrowserCaps(repoPath, cfg)
+				return permissionsChanged, nil
+			}
+			log.Printf("⚠️ [Bridge] Failed to clone from source URL, will try clone URLs: %v\n", err)
+		}
+
+		// Priority 2: Try to clone from clone URLs (prefer HTTPS)
+		if len(cloneUrls) > 0 {
+			// Prefer HTTPS URLs over SSH
+			var httpsUrl string
+			for _, url := range cloneUrls {
+				if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+					httpsUrl = url
+					break
+				}
+			}
+			// If no HTTPS found, use first clone URL
+			if httpsUrl == "" {
+				httpsUrl = cloneUrls[0]
+			}
+
+			log.Printf("🔍 [Bridge] Attempting to clone from clone URL: %s\n", httpsUrl)
+			err := s.cloneRepository(httpsUrl, repoPath, cfg)
+			if err == nil {
+				log.Printf("✅ [Bridge] Successfully cloned repository from clone URL: %s\n", httpsUrl)
+				ensureUploadPackBrowserCaps(repoPath, cfg)
+				return permissionsChanged, nil
+			}
+			log.Printf("⚠️ [Bridge] Failed to clone from clone URL, will try bundles or create empty repo: %v\n", err)
+		}
+
+		// Priority 3: Import a git bundle from blob storage (blossom/NIP-96)
+		for _, bundle := range announcement.bundles {
+			log.Printf("🔍 [Bridge] Attempting to import bundle: %s\n", bundle.URL)
+			err := s.cloneBundle(bundle, repoPath, repo.GetDefaultBranch(), cfg)
+			if err == nil {
+				log.Printf("✅ [Bridge] Successfully imported repository from bundle: %s\n", bundle.URL)
+				ensureUploadPackBrowserCaps(repoPath, cfg)
+				return permissionsChanged, nil
+			}
+			log.Printf("⚠️ [Bridge] Failed to import bundle: %v\n", err)
+		}
+
+		// Fallback: Create empty bare repository
+		log.Printf("📦 [Bridge] Creating empty bare repository: %s\n", repoName+".git")
+		err = cfg.Git("init", "--bare", repoPath).Run()
+		if err != nil {
+			return permissionsChanged, fmt.Errorf("git init --bare failed : %w", err)
+		}
+
+		ensureUploadPackBrowserCaps(repoPath, cfg)
+
+		// CRITICAL: Point HEAD at the announced default branch (main if none) so git clone
+		// of the empty repository checks out the branch the owner expects
+		defaultBranch := repo.GetDefaultBranch()
+		output, err := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", "refs/heads/"+defaultBranch).CombinedOutput()
+		if err != nil && defaultBranch != protocol.DefaultBranchName {
+			log.Printf("⚠️ [Bridge] Invalid default branch %q for %s, using %s: %v: %s\n", defaultBranch, repoName, protocol.DefaultBranchName, err, output)
+			defaultBranch = protocol.DefaultBranchName
+			output, err = cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", "refs/heads/"+defaultBranch).CombinedOutput()
+		}
+		if err != nil {
+			log.Printf("⚠️ [Bridge] Warning: Failed to set HEAD for empty repo %s: %v: %s\n", repoName, err, output)
+			// Continue anyway - repo is created, user can set branch on first push
+		} else {
+			log.Printf("✅ [Bridge] Set HEAD to %s for empty repo: %s\n", defaultBranch, repoName)
+			// The state event's HEAD overrides this once the owner pushes
+			if _, err := db.Exec("UPDATE Repository SET DefaultBranch=? WHERE OwnerPubKey=? AND RepositoryName=? AND (DefaultBranch IS NULL OR DefaultBranch='')", defaultBranch, event.PubKey, repoName); err != nil {
+				log.Printf("⚠️ [Bridge] Failed to record default branch of %s: %v\n", repoName, err)
+			}
+		}
+	}
+
+	// CRITICAL: Create symlink from npub to hex pubkey for NIP-34 compatibility
+	// Clone URLs use npub format (per NIP-34 spec), but we store repos by hex pubkey
+	// This symlink allows both formats to work: hex (storage) and npub (URLs)
+	if !cfg.OwnerDirs() {
+		return permissionsChanged, nil
+	}
+	if changed, err := EnsureNpubSymlink(reposDir, event.PubKey); err != nil {
+		log.Printf("⚠️ [Bridge] Failed to create npub symlink: %v\n", err)
+	} else if changed {
+		log.Printf("🔗 [Bridge] Linked npub directory to %s\n", event.PubKey)
+	}
+
+	return permissionsChanged, nil
+}
+
+// Clone repository from URL to path
+// ensureUploadPackBrowserCaps advertises partial-clone filter + tip SHA wants.
+// gitworkshop's explorer requires the "filter" capability; without it info/refs
+// succeeds but tree fetch fails as "upload-pack failed". allowFilter false turns
+// the filter capability off again.
+func ensureUploadPackBrowserCaps(repoPath string, cfg Config) {
+	_ = cfg.Git("--git-dir", repoPath, "config", "uploadpack.allowFilter", strconv.FormatBool(cfg.GetAllowFilter())).Run()
+	_ = cfg.Git("--git-dir", repoPath, "config", "uploadpack.allowAnySHA1InWant", "true").Run()
+	_ = cfg.Git("--git-dir", repoPath, "config", "uploadpack.allowReachableSHA1InWant", "true").Run()
+}
+
+// acquireCloneSlot bounds the number of concurrent git clones to cfg.MaxConcurrentClones.
+// Clones beyond that wait for a slot; the returned function releases it.
+func (s *Server) acquireCloneSlot() func() {
+	select {
+	case s.cloneSlots <- struct{}{}:
+	default:
+		log.Printf("⏳ [Bridge] Waiting for a clone slot (maxConcurrentClones=%d)\n", cap(s.cloneSlots))
+		s.cloneSlots <- struct{}{}
+	}
+	return func() { <-s.cloneSlots }
+}
+
+func (s *Server) cloneRepository(cloneUrl, repoPath string, cfg Config) error {
+	// Normalize URL: convert git:// to https://, git@ to https://
+	normalizedUrl := cloneUrl
+	if strings.HasPrefix(normalizedUrl, "git://") {
+		normalizedUrl = strings.Replace(normalizedUrl, "git://", "https://", 1)
+	} else if strings.HasPrefix(normalizedUrl, "git@") {
+		// Convert git@host:path to https://host/path
+		normalizedUrl = strings.Replace(normalizedUrl, "git@", "https://", 1)
+		normalizedUrl = strings.Replace(normalizedUrl, ":", "/", 1)
+	}
+
+	// Ensure parent directory exists
+	parentDir := filepath.Dir(repoPath)
+	err := os.MkdirAll(parentDir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	// Clone repository
+	// Clone through the proxy if one is configured; .onion hosts can't be reached without it
+	args := append(cfg.GitProxyArgs(), "clone", "--bare", normalizedUrl, repoPath)
+	if IsOnionURL(normalizedUrl) && cfg.Proxy == "" {
+		return fmt.Errorf("cannot clone %s without a proxy", normalizedUrl)
+	}
+
+	release := s.acquireCloneSlot()
+	defer release()
+
+	// The sentinel outlives a restart, so the next attempt knows the directory holds a
+	// partial clone. It is resumed with a fetch when it came from the same URL and
+	// removed otherwise; a failure within this attempt removes it like git clone would.
+	sentinel := ImportSentinelPath(repoPath)
+	if previousUrl := ImportInProgress(repoPath); previousUrl != "" {
+		if _, statErr := os.Stat(repoPath); statErr == nil && previousUrl == normalizedUrl {
+			log.Printf("🔁 [Bridge] Resuming interrupted import of %s from %s\n", repoPath, normalizedUrl)
+			err = resumeClone(normalizedUrl, repoPath, cfg)
+			if err == nil {
+				err = pruneMirrorRefs(repoPath, cfg)
+			}
+			if err == nil {
+				os.Remove(sentinel)
+				return nil
+			}
+			log.Printf("⚠️ [Bridge] Failed to resume import, starting over: %v\n", err)
+		} else {
+			log.Printf("🧹 [Bridge] Removing interrupted import of %s from %s\n", repoPath, previousUrl)
+		}
+		if err := os.RemoveAll(repoPath); err != nil {
+			return fmt.Errorf("remove partial clone: %w", err)
+		}
+	}
+	err = os.WriteFile(sentinel, []byte(normalizedUrl+"\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("write import sentinel: %w", err)
+	}
+
+	if len(cfg.ImportRefspecs()) > 0 {
+		err = fetchCloneRefspecs(normalizedUrl, repoPath, cfg)
+	} else {
+		log.Printf("🔍 [Bridge] Executing: git %s\n", strings.Join(args, " "))
+		cmd := cfg.Git(args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			err = fmt.Errorf("git clone failed: %w", err)
+		}
+	}
+	if err == nil {
+		err = pruneMirrorRefs(repoPath, cfg)
+	}
+	if err != nil {
+		os.RemoveAll(repoPath) // like a failed git clone, leave nothing behind
+		os.Remove(sentinel)
+		return err
+	}
+
+	os.Remove(sentinel)
+	return nil
+}
+
+// resumeClone completes a partial clone at repoPath by fetching the refs a fresh clone
+// would have imported. Objects that already arrived are not downloaded again. HEAD is
+// pointed at the remote's default branch, as git clone does once it finishes.
+func resumeClone(cloneUrl, repoPath string, cfg Config) error {
+	refspecs := cfg.ImportRefspecs()
+	if len(refspecs) == 0 {
+		refspecs = []string{"refs/heads/*", "refs/tags/*"}
+	}
+	args := append(cfg.GitProxyArgs(), "--git-dir", repoPath, "fetch", cloneUrl)
+	for _, pattern := range refspecs {
+		args = append(args, "+"+pattern+":"+pattern)
+	}
+
+	log.Printf("🔍 [Bridge] Executing: git %s\n", strings.Join(args, " "))
+	cmd := cfg.Git(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	head := ""
+	output, err := cfg.Git(append(cfg.GitProxyArgs(), "ls-remote", "--symref", cloneUrl, "HEAD")...).Output()
+	if err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			if target, found := strings.CutPrefix(line, "ref: "); found {
+				head = strings.TrimSuffix(target, "\tHEAD")
+				break
+			}
+		}
+	}
+	if head == "" {
+		head, err = SymbolicHead(repoPath)
+		if err != nil {
+			return err
+		}
+	}
+	if resolved := pickRecoverableHeadRef(repoPath, head, nil); resolved != "" {
+		output, err := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", resolved).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git symbolic-ref HEAD failed: %w: %s", err, output)
+		}
+	}
+	return nil
+}
+
+// fetchCloneRefspecs imports only the refs matching cfg.ImportRefspecs into a new bare
+// repository. HEAD is pointed at an imported branch if its default target wasn't fetched.
+func fetchCloneRefspecs(cloneUrl, repoPath string, cfg Config) error {
+	output, err := cfg.Git("init", "--bare", repoPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git init --bare failed: %w: %s", err, output)
+	}
+
+	args := append(cfg.GitProxyArgs(), "--git-dir", repoPath, "fetch", cloneUrl)
+	for _, pattern := range cfg.ImportRefspecs() {
+		args = append(args, "+"+pattern+":"+pattern)
+	}
+
+	log.Printf("🔍 [Bridge] Executing: git %s\n", strings.Join(args, " "))
+	cmd := cfg.Git(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	head, err := SymbolicHead(repoPath)
+	if err != nil {
+		return err
+	}
+	if resolved := pickRecoverableHeadRef(repoPath, head, nil); resolved != "" && resolved != head {
+		output, err := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", resolved).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git symbolic-ref HEAD failed: %w: %s", err, output)
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleRepositorPermission(event nostr.Event) error {
+	db := s.db
+
+	var perm protocol.RepositoryPermission
+	err := json.Unmarshal([]byte(event.Content), &perm)
+	if err != nil {
+		return fmt.Errorf("malformed permission: %w : %v", err, event.Content)
+	}
+	perm.TargetPubKey = strings.ToLower(perm.TargetPubKey)
+
+	if !IsValidRepoName(perm.RepositoryName) {
+		return fmt.Errorf("invalid repository name: %v", perm.RepositoryName)
+	}
+	if err := protocol.ValidatePermission(perm.Permission); err != nil {
+		return fmt.Errorf("rejecting permission event %v: %w", event.ID, err)
+	}
+
+	updatedAt := event.CreatedAt.Unix()
+
+	if perm.TargetGroup != "" {
+		if !IsValidGroupName(perm.TargetGroup) {
+			return fmt.Errorf("invalid group name: %v", perm.TargetGroup)
+		}
+		res, err := db.Exec("INSERT INTO RepositoryGroupPermission (OwnerPubKey,RepositoryName,GroupName,Permission,UpdatedAt) VALUES (?,?,?,?,?) ON CONFLICT DO UPDATE SET Permission=?,UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, perm.RepositoryName, perm.TargetGroup, perm.Permission, updatedAt, perm.Permission, updatedAt, updatedAt)
+		if err != nil {
+			return fmt.Errorf("insert group permission failed: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("rows affected failed: %w", err)
+		}
+
+		if affected == 1 {
+			log.Println("group permission updated", event.Content)
+			s.emit(SinkEvent{Type: SinkPermissionChanged, Owner: event.PubKey, Repo: perm.RepositoryName, PubKey: event.PubKey, EventID: event.ID, Data: map[string]any{
+				"targetGroup": perm.TargetGroup,
+				"permission":  perm.Permission,
+			}})
+		}
+		return nil
+	}
+
+	res, err := db.Exec("INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt,Source) VALUES (?,?,?,?,?,?) ON CONFLICT DO UPDATE SET Permission=?,UpdatedAt=?,Source=? WHERE UpdatedAt<?;", event.PubKey, perm.RepositoryName, perm.TargetPubKey, perm.Permission, updatedAt, PermissionSourceEvent, perm.Permission, updatedAt, PermissionSourceEvent, updatedAt)
+	if err != nil {
+		return fmt.Errorf("insert permission failed: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected failed: %w", err)
+	}
+
+	if affected == 1 {
+		log.Println("permission updated", event.Content)
+		s.emit(SinkEvent{Type: SinkPermissionChanged, Owner: event.PubKey, Repo: perm.RepositoryName, PubKey: event.PubKey, EventID: event.ID, Data: map[string]any{
+			"targetPubKey": perm.TargetPubKey,
+			"permission":   perm.Permission,
+		}})
+	}
+
+	return nil
+}
@@ -0,0 +1,775 @@
+package bridge
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Server is a git-nostr-bridge: it subscribes to the configured relays, applies the
+// events to the database and the bare repositories, and serves the HTTP API.
+// Set DryRun, Since, Reconcile and Addr before calling Run.
+type Server struct {
+	// DryRun makes the server describe what it would do instead of doing it.
+	DryRun bool
+	// Since skips events before it, like the --since flag.
+	Since *time.Time
+	// Reconcile repairs the repository directory from the database before the
+	// relays are subscribed, like the --reconcile flag. See ReconcileRepositories.
+	Reconcile bool
+	// Addr is the address Run serves the HTTP API on, ":8080" by default.
+	// An empty Addr doesn't start an HTTP server; embed Handler() instead.
+	Addr string
+
+	cfg     Config
+	db      *sql.DB
+	mux     *http.ServeMux
+	handler http.Handler // mux behind the compression middleware
+	gate    *pauseGate
+	health  *subscriptionHealth
+	elector *leaderElector
+	stream  *eventStream // feeds /api/events/stream
+
+	// Rebuilds authorized_keys once per debounceWindow however many keys change
+	authorizedKeys *debouncer
+
+	// Events submitted with POST /api/event
+	directEvents chan nostr.Event
+	seenEventIDs map[string]bool
+	seenMutex    sync.RWMutex
+
+	// Failed events handed back to the relay loop by runFailedEventRetrier
+	retrying   map[string]bool
+	retryMutex sync.Mutex
+
+	sink       EventSink // the configured event sink and the audit log
+	waiters    *processedWaiters
+	refUpdates *refThrottle
+	cloneSlots chan struct{} // bounds concurrent clones to maxConcurrentClones
+	dryRun     dryRunPlan
+
+	// The configured relays plus those of the relay list of relayListPubKey
+	relayListPubKey string
+	currentRelays   []RelayConfig
+	relaysMutex     sync.Mutex
+	relaysChanged   chan struct{}
+}
+
+// New validates cfg, opens the event sink and the database and registers the HTTP
+// handlers. Close releases what it opened.
+func New(cfg Config) (*Server, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.ApplyRelayProxy()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔍 [Bridge] Watching repository event kinds %v\n", cfg.GetWatchKinds())
+
+	if strict := cfg.GetStrictSignatureKinds(); len(strict) > 0 {
+		log.Printf("🔏 [Bridge] POST /api/event requires a valid id and signature for kinds %v, other kinds are accepted with a warning\n", strict)
+	} else {
+		log.Printf("⚠️ [Bridge] POST /api/event accepts events of every kind with an invalid id or signature (strictSignatureKinds is empty)\n")
+	}
+
+	err = checkGitVersion(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ReadOnly {
+		log.Printf("🔒 [Bridge] READ-ONLY MIRROR: pushes, relay publishing and POST /api/event are disabled\n")
+	}
+
+	sink, err := OpenEventSink(cfg.EventSink)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := OpenDb(cfg.DbFile)
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+
+	// The database migrations lowercase stored pubkeys, the directories follow here
+	moved, conflicts, err := LowercaseOwnerDirs(cfg)
+	if err != nil {
+		db.Close()
+		sink.Close()
+		return nil, fmt.Errorf("move upper case owner directories : %w", err)
+	}
+	if moved > 0 {
+		log.Printf("🔡 [Bridge] Moved %d repositories of upper case owner pubkeys to their lowercase path\n", moved)
+	}
+	for _, conflict := range conflicts {
+		log.Printf("⚠️ [Bridge] %s also exists under the lowercase owner pubkey, merge or remove it by hand\n", conflict)
+	}
+
+	s := &Server{
+		Addr:         ":8080",
+		cfg:          cfg,
+		db:           db,
+		mux:          http.NewServeMux(),
+		gate:         newPauseGate(),
+		stream:       newEventStream(),
+		health:       newSubscriptionHealth(cfg),
+		elector:      newLeaderElector(db, cfg),
+		directEvents: make(chan nostr.Event, 100),
+		seenEventIDs: make(map[string]bool),
+		retrying:     make(map[string]bool),
+		// Everything emitted to the configured sink is also kept in the audit log
+		sink:       MultiSink(sink, NewAuditSink(db)),
+		waiters:    newProcessedWaiters(),
+		refUpdates: newRefThrottle(),
+		cloneSlots: make(chan struct{}, cfg.GetMaxConcurrentClones()),
+
+		currentRelays: cfg.Relays,
+		relaysChanged: make(chan struct{}, 1),
+	}
+	if cfg.RelayListPubKey != "" {
+		s.relayListPubKey, err = gitnostr.DecodePubKey(cfg.RelayListPubKey)
+		if err != nil {
+			db.Close()
+			sink.Close()
+			return nil, err
+		}
+	}
+	s.authorizedKeys = newDebouncer(cfg.GetDebounceWindow(), func() {
+		if err := updateAuthorizedKeys(db, cfg); err != nil {
+			log.Printf("❌ [Bridge] Failed to update authorized_keys: %v\n", err)
+		}
+	})
+
+	// With mutual TLS, events are only accepted from clients with a certificate
+	if cfg.MtlsEnabled() {
+		s.mux.HandleFunc("/api/event", requireClientCert(s.handleEventAPI()))
+	} else {
+		s.mux.HandleFunc("/api/event", s.handleEventAPI())
+	}
+	s.mux.HandleFunc("/api/repos/", handleRepoAPI(db, cfg))
+	s.mux.HandleFunc("/api/access", handleAccessAPI(db))
+	s.mux.HandleFunc("/api/owners/", handleOwnerAPI(db))
+	s.mux.HandleFunc("/api/catalog", handleCatalogAPI(db))
+	s.mux.HandleFunc("/api/events/stream", handleEventStream(s.stream))
+	s.mux.HandleFunc("/api/validate", handleValidateAPI(db, cfg))
+	s.mux.HandleFunc("/api/pause", handlePauseAPI(s.gate, cfg, true))
+	s.mux.HandleFunc("/api/resume", handlePauseAPI(s.gate, cfg, false))
+	s.mux.HandleFunc("/api/audit", handleAuditAPI(db, cfg))
+	s.mux.HandleFunc("/healthz", handleHealthz)
+	s.mux.HandleFunc("/readyz", handleReadyz(s.gate, s.health, cfg))
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	if cfg.DumbHttp {
+		s.mux.HandleFunc("/git/", handleDumbHttp(db, cfg))
+	}
+	s.handler = compressHandler(s.mux)
+
+	return s, nil
+}
+
+// Config returns the configuration the server was created with.
+func (s *Server) Config() Config {
+	return s.cfg
+}
+
+// DB returns the bridge database.
+func (s *Server) DB() *sql.DB {
+	return s.db
+}
+
+// Handler returns the HTTP API, for serving it from another http.Server.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Close closes the database and the event sink.
+func (s *Server) Close() error {
+	return errors.Join(s.db.Close(), s.sink.Close())
+}
+
+// handleMetrics reads the elector when scraped, as dry runs drop it in Run.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	handleMetrics(s.health, s.gate, s.elector)(w, r)
+}
+
+// Run serves the HTTP API and processes relay events until ctx is done, the relays
+// can't be reached or one of its servers fails. It returns nil when ctx is done, and
+// only after every goroutine it started has stopped.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, fail := context.WithCancelCause(ctx)
+	var workers sync.WaitGroup
+	err := s.run(ctx, fail, &workers)
+	fail(nil)
+	workers.Wait()
+
+	// A failing server or a lost lease cancels ctx with the failure as the cause
+	if cause := context.Cause(ctx); err == nil && !errors.Is(cause, context.Canceled) && !errors.Is(cause, context.DeadlineExceeded) {
+		return cause
+	}
+	return err
+}
+
+func (s *Server) run(ctx context.Context, fail context.CancelCauseFunc, workers *sync.WaitGroup) error {
+	db, cfg := s.db, s.cfg
+	start := func(worker func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker()
+		}()
+	}
+
+	sshDir, err := gitnostr.ResolvePath("~/.ssh")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(sshDir, 0700)
+
+	if s.DryRun {
+		log.Printf("🧪 [Bridge] Dry-run mode: nothing is written, press Ctrl-C for a summary\n")
+		defer s.dryRun.printSummary()
+		// A dry run never takes the lease, it would keep the real leader waiting
+		s.elector = nil
+	} else {
+		err = updateAuthorizedKeys(db, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Since != nil {
+		log.Printf("⏩ [Bridge] Starting from %s (--since), older events are skipped\n", s.Since.Format(time.RFC3339))
+		if !s.DryRun {
+			if err := seedSince(db, *s.Since); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := logInvalidRepoNames(db, cfg); err != nil {
+		return err
+	}
+
+	sshKeyPubKeys, err := getSshKeyPubKeys(db)
+	if err != nil {
+		return err
+	}
+
+	if s.Addr != "" {
+		listener, err := cfg.ListenHTTP(s.Addr)
+		if err != nil {
+			return fmt.Errorf("HTTP server failed: %w", err)
+		}
+		httpServer := cfg.NewHTTPServer(s.Addr, s.handler)
+		start(func() {
+			log.Printf("🌐 [Bridge] Starting HTTP server on %s for direct event submission\n", s.Addr)
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				fail(fmt.Errorf("HTTP server failed: %w", err))
+			}
+		})
+		defer httpServer.Close()
+	}
+
+	if cfg.MtlsEnabled() {
+		tlsConfig, err := cfg.MtlsConfig()
+		if err != nil {
+			return err
+		}
+		listener, err := cfg.ListenHTTP(cfg.MtlsAddr)
+		if err != nil {
+			return fmt.Errorf("mutual TLS server failed: %w", err)
+		}
+		mtlsServer := cfg.NewHTTPServer(cfg.MtlsAddr, s.handler)
+		mtlsServer.TLSConfig = tlsConfig
+		start(func() {
+			log.Printf("🔐 [Bridge] Starting mutual TLS server on %s\n", cfg.MtlsAddr)
+			if err := mtlsServer.Serve(tls.NewListener(listener, tlsConfig)); err != nil && err != http.ErrServerClosed {
+				fail(fmt.Errorf("mutual TLS server failed: %w", err))
+			}
+		})
+		defer mtlsServer.Close()
+	}
+
+	start(func() { s.stream.run(ctx, db) })
+
+	// Followers serve the read endpoints above and take over once the leader's lease expires
+	if err := s.elector.waitLeader(ctx); err != nil {
+		return nil
+	}
+	start(func() { s.elector.renewLease(ctx, fail) })
+
+	if s.Reconcile {
+		if s.DryRun {
+			log.Printf("🧪 [Bridge] Dry-run mode: skipping --reconcile\n")
+		} else {
+			log.Printf("🔧 [Bridge] Reconciling repositories with the database\n")
+			summary, err := ReconcileRepositories(db, cfg)
+			if err != nil {
+				return err
+			}
+			summary.Print()
+		}
+	}
+
+	if !s.DryRun {
+		start(func() { runGcScheduler(ctx, db, cfg) })
+		start(func() { runSizeSweeper(ctx, db, cfg) })
+		start(func() { runDeliveryRetrier(ctx, db) })
+		start(func() { s.runFailedEventRetrier(ctx) })
+		if cfg.DeleteGracePeriod.Duration() > 0 {
+			start(func() { runTrashPurger(ctx, cfg) })
+		}
+	}
+
+	if s.relayListPubKey != "" {
+		log.Printf("📡 [Bridge] Following the relay list of %s, refreshed every %s\n", s.relayListPubKey, cfg.GetRelayListRefresh())
+		s.refreshRelayList()
+		start(func() { s.runRelayListRefresher(ctx) })
+	}
+
+	return s.relayLoop(ctx, sshKeyPubKeys)
+}
+
+// relayLoop subscribes to the relays and processes their events and the directly
+// submitted ones. It reconnects whenever an event changes the subscription filters.
+func (s *Server) relayLoop(ctx context.Context, sshKeyPubKeys []string) error {
+	db, cfg := s.db, s.cfg
+	startSince := s.Since
+
+	for {
+		poolCtx, cancelPool := context.WithCancel(ctx)
+		pool, err := connectNostr(poolCtx, s.relays(), cfg.GetRelayConnectTimeout())
+		if err != nil {
+			cancelPool()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		since, err := getSince(db)
+		if err != nil {
+			cancelPool()
+			return err
+		}
+		// getSince moves old markers up to an hour ago; the first subscription
+		// starts exactly at --since unless events past it were already processed.
+		if startSince != nil {
+			applySinceFlag(db, since, *startSince)
+			startSince = nil
+		}
+
+		// Build filter for repository events (legacy kind 51 + NIP-34 kind 30617 + state events 30618) and permissions
+		repoSince := minTime(since[protocol.KindRepository], since[protocol.KindRepositoryNIP34], since[protocol.KindRepositoryState])
+		watchKinds := cfg.GetWatchKinds()
+		// Comments and reactions get filters of their own, limited to ones about git
+		scopedKinds := ScopedWatchKinds()
+		var repoKinds []int
+		var scopedFilters nostr.Filters
+		for _, kind := range watchKinds {
+			if tags, found := scopedKinds[kind]; found {
+				scopedFilters = append(scopedFilters, nostr.Filter{Kinds: []int{kind}, Tags: tags, Since: repoSince})
+			} else {
+				repoKinds = append(repoKinds, kind)
+			}
+		}
+		repoFilter := nostr.Filter{
+			Kinds: repoKinds,
+			Since: repoSince,
+		}
+		if len(cfg.GitRepoOwners) > 0 {
+			repoFilter.Authors = cfg.GitRepoOwners
+		}
+		// If gitRepoOwners is empty, don't set Authors - this makes it watch ALL repos
+
+		if repoSince != nil {
+			log.Printf("🔍 [Bridge] Subscribing to repository events since: %s (kinds %v)\n", repoSince.Format(time.RFC3339), watchKinds)
+		} else {
+			log.Printf("🔍 [Bridge] Subscribing to ALL repository events (no Since filter, kinds %v)\n", watchKinds)
+		}
+		if len(cfg.GitRepoOwners) > 0 {
+			log.Printf("🔍 [Bridge] Filtering by authors: %v\n", cfg.GitRepoOwners)
+		} else {
+			log.Printf("🔍 [Bridge] Watching ALL authors (decentralized mode)\n")
+		}
+
+		filters := nostr.Filters{
+			repoFilter,
+			{
+				Authors: sshKeyPubKeys,
+				Kinds:   []int{protocol.KindSshKey, protocol.KindGitIdentity},
+				Since:   since[protocol.KindSshKey],
+			},
+		}
+		filters = append(filters, scopedFilters...)
+		gitNostrEvents := subscribeBatches(poolCtx, pool, subscriptionBatches(filters, cfg.GetMaxFilterAuthors()))
+
+		// Relay events, deduplicated across relays. Every stage returns once poolCtx is
+		// cancelled, so a reconnect leaves none of them behind. Direct API events are
+		// read from s.directEvents below, which outlives the pools.
+		relayEvents := make(chan nostr.Event, 200)
+		go func() {
+			for event := range uniqueEvents(poolCtx, sinceCompliantEvents(poolCtx, filters, readableEvents(poolCtx, pool, gitNostrEvents), cfg.ClientSideSinceFilter)) {
+				s.health.record(event.Kind)
+				// Mark relay events as seen
+				s.seenMutex.Lock()
+				s.seenEventIDs[event.ID] = true
+				if len(s.seenEventIDs) > 10000 {
+					s.seenEventIDs = make(map[string]bool)
+				}
+				s.seenMutex.Unlock()
+				select {
+				case relayEvents <- event:
+				case <-poolCtx.Done():
+					return
+				}
+			}
+		}()
+
+		// Set while permission changes wait to be looked at, see debounceWindow
+		var resubscribe <-chan time.Time
+
+	exit:
+		// Process relay and direct events (deduplication already handled by s.seenEventIDs)
+		for {
+			var event nostr.Event
+			select {
+			case <-ctx.Done():
+				cancelPool()
+				return nil
+			case <-resubscribe:
+				resubscribe = nil
+				newSshKeyPubKeys, err := getSshKeyPubKeys(db)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				if sameKeys(newSshKeyPubKeys, sshKeyPubKeys) {
+					continue
+				}
+				log.Printf("🔁 [Bridge] Ssh key authors changed (%d -> %d), resubscribing\n", len(sshKeyPubKeys), len(newSshKeyPubKeys))
+				sshKeyPubKeys = newSshKeyPubKeys
+				//There doesn't seem to be a function to cancel the subscription and resubscribe so I have to reconnect
+				pool.Relays.Range(func(key string, value *nostr.Relay) bool {
+					pool.Remove(key)
+					value.Close()
+					return true
+				})
+				cancelPool()
+				break exit
+			case <-s.relaysChanged:
+				log.Printf("🔁 [Bridge] Relays changed, reconnecting\n")
+				pool.Relays.Range(func(key string, value *nostr.Relay) bool {
+					pool.Remove(key)
+					value.Close()
+					return true
+				})
+				cancelPool()
+				break exit
+			case event = <-relayEvents:
+			case event = <-s.directEvents:
+			}
+			s.gate.enter()
+			permissionsChanged := s.processEvent(event)
+			s.gate.leave()
+			s.waiters.notify(event.ID)
+			// A burst of permission events costs one lookup and at most one reconnect
+			if permissionsChanged && resubscribe == nil {
+				resubscribe = time.After(cfg.GetDebounceWindow())
+			}
+		}
+	}
+}
+
+// sameKeys reports whether a and b hold the same pubkeys in any order.
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// min returns the minimum of two integers
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func getSshKeyPubKeys(db *sql.DB) ([]string, error) {
+
+	var sshKeyPubKeys []string
+	rows, err := db.Query("SELECT TargetPubKey FROM RepositoryPermission UNION SELECT MemberPubKey FROM GroupMember")
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var targetPubKey string
+		err := rows.Scan(&targetPubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		sshKeyPubKeys = append(sshKeyPubKeys, targetPubKey)
+	}
+
+	return sshKeyPubKeys, nil
+
+}
+
+// connectNostr connects to the relays one by one, giving each at most timeout.
+// Relays that fail or time out are skipped. Notices are logged until ctx is done,
+// which the caller cancels when it tears the pool down.
+func connectNostr(ctx context.Context, relays []RelayConfig, timeout time.Duration) (*nostr.RelayPool, error) {
+
+	pool := nostr.NewRelayPool()
+
+	connectedRelays := []string{}
+	failedRelays := []string{}
+	for _, relay := range relays {
+		if !relay.Read && !relay.Write {
+			continue
+		}
+		addCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := pool.AddContext(addCtx, relay.URL, nostr.SimplePolicy{
+			Read:  relay.Read,
+			Write: relay.Write,
+		})
+		cancel()
+		if err != nil {
+			log.Printf("relay connect failed : %v\n", err)
+			failedRelays = append(failedRelays, err.Error())
+		} else {
+			connectedRelays = append(connectedRelays, relay.URL)
+			log.Printf("relay connected: %s (read=%v write=%v)\n", relay.URL, relay.Read, relay.Write)
+		}
+	}
+
+	if len(connectedRelays) == 0 {
+		return nil, fmt.Errorf("no relays connected: %v", strings.Join(failedRelays, "; "))
+	}
+	log.Printf("connected to %d/%d relays: %v\n", len(connectedRelays), len(relays), connectedRelays)
+
+	pool.Relays.Range(func(url string, relay *nostr.Relay) bool {
+		go drainRelay(ctx, relay)
+		return true
+	})
+
+	return pool, nil
+}
+
+// drainRelay logs the notices of a pooled relay until ctx is cancelled. go-nostr
+// delivers them, and finally the error that ends the connection, over unbuffered
+// channels of the relay, not over pool.Notices, and its reader blocks until they
+// are received. So once ctx is cancelled the relay is closed and its closing error
+// awaited, leaving no reader behind after a reconnect.
+func drainRelay(ctx context.Context, relay *nostr.Relay) {
+	for {
+		select {
+		case notice := <-relay.Notices:
+			log.Printf("notice: %s '%s'\n", relay.URL, notice)
+			if isFilterRejection(notice) {
+				log.Printf("⚠️ [Bridge] Relay %s may have rejected a subscription filter; lower maxFilterAuthors if events of some pubkeys go missing\n", relay.URL)
+			}
+		case err := <-relay.ConnectionError:
+			if ctx.Err() == nil {
+				log.Printf("⚠️ [Bridge] Relay %s disconnected: %v\n", relay.URL, err)
+			}
+			return
+		case <-ctx.Done():
+			relay.Close()
+			timeout := time.After(10 * time.Second)
+			for {
+				select {
+				case <-relay.Notices:
+				case <-relay.ConnectionError:
+					return
+				case <-timeout:
+					log.Printf("⚠️ [Bridge] Relay %s did not close its connection\n", relay.URL)
+					return
+				}
+			}
+		}
+	}
+}
+
+// readableEvents drops events from relays whose policy doesn't allow reading.
+// RelayPool.Sub subscribes on every relay in the pool regardless of policy.
+func readableEvents(ctx context.Context, pool *nostr.RelayPool, events chan nostr.EventMessage) chan nostr.EventMessage {
+	readable := make(chan nostr.EventMessage)
+	go func() {
+		defer close(readable)
+		for message := range events {
+			if policy, ok := pool.Policies.Load(message.Relay); ok && !policy.ShouldRead(nil) {
+				continue
+			}
+			select {
+			case readable <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readable
+}
+
+// uniqueEvents passes on the first copy of every event, like nostr.Unique, but stops
+// once ctx is cancelled.
+func uniqueEvents(ctx context.Context, events chan nostr.EventMessage) chan nostr.Event {
+	unique := make(chan nostr.Event)
+	go func() {
+		defer close(unique)
+		emitted := make(map[string]bool)
+		for message := range events {
+			if emitted[message.Event.ID] {
+				continue
+			}
+			emitted[message.Event.ID] = true
+			select {
+			case unique <- message.Event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return unique
+}
+
+func minTime(times ...*time.Time) *time.Time {
+	var min *time.Time
+	for _, t := range times {
+		if t == nil {
+			continue
+		}
+		if min == nil || t.Before(*min) {
+			tmp := *t
+			min = &tmp
+		}
+	}
+	return min
+}
+
+// updateSince moves the Since marker for kind forward to updatedAt. The max is taken
+// inside a single statement, which SQLite runs atomically, so concurrent handlers
+// can finish in any order without moving Since backward.
+func updateSince(kind int, updatedAt int64, db *sql.DB) error {
+	_, err := db.Exec("INSERT INTO Since (Kind,UpdatedAt) VALUES (?,?) ON CONFLICT (Kind) DO UPDATE SET UpdatedAt=MAX(UpdatedAt,excluded.UpdatedAt);", kind, updatedAt)
+	if err != nil {
+		return fmt.Errorf("insert since failed: %w", err)
+	}
+
+	return nil
+}
+
+// Attempts of advanceSince and the wait before its first retry, doubled for each
+// further one: about 1.5s in total on top of the busy timeout of every attempt.
+const (
+	sinceAttempts     = 5
+	sinceRetryBackoff = 100 * time.Millisecond
+)
+
+// advanceSince moves the Since marker of kind to updatedAt, retrying while the
+// database is busy or locked. Once the retries run out, or on a permanent error, the
+// marker is left where it is as a last resort: the handlers are idempotent, so the
+// only cost is that the event is fetched and applied again on the next reconnect.
+func advanceSince(kind int, updatedAt int64, db *sql.DB) {
+	backoff := sinceRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := updateSince(kind, updatedAt, db)
+		if err == nil {
+			return
+		}
+		if !IsTransientDbError(err) {
+			log.Printf("❌ [Bridge] Failed to update Since of kind %d, leaving it behind: %v\n", kind, err)
+			return
+		}
+		if attempt == sinceAttempts {
+			log.Printf("❌ [Bridge] Database still locked after %d attempts to update Since of kind %d, leaving it behind: %v\n", attempt, kind, err)
+			return
+		}
+		log.Printf("⏳ [Bridge] Database locked while updating Since of kind %d, retrying in %s: %v\n", kind, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func getSince(db *sql.DB) (map[int]*time.Time, error) {
+
+	since := make(map[int]*time.Time)
+	rows, err := db.Query("SELECT Kind,UpdatedAt FROM Since")
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var kind int
+		var updatedAt int64
+		err := rows.Scan(&kind, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// CRITICAL: Subtract 1 hour to avoid missing events due to clock skew
+		// But if Since is very old (more than 24 hours), reset it to 1 hour ago to catch recent events
+		t := time.Unix(updatedAt, 0).Add(-1 * time.Hour)
+		now := time.Now()
+		if now.Sub(t) > 24*time.Hour {
+			// Since is very old - reset to 1 hour ago to catch recent events
+			t = now.Add(-1 * time.Hour)
+			log.Printf("⚠️ [Bridge] Since timestamp for kind %d is very old, resetting to 1 hour ago\n", kind)
+		}
+		since[kind] = &t
+	}
+
+	return since, nil
+}
+
+// checkGitVersion logs the installed git version and fails if it is older than
+// minGitVersion, unless allowOldGit turns that into a warning.
+func checkGitVersion(cfg Config) error {
+	minVersion, err := cfg.GetMinGitVersion()
+	if err != nil {
+		return err
+	}
+	version, err := DetectGitVersion()
+	if err != nil {
+		return fmt.Errorf("cannot determine the git version, is git installed and on PATH? %w", err)
+	}
+	log.Printf("🔧 [Bridge] Using git %v (minimum %v)\n", version, minVersion)
+	if version.AtLeast(minVersion) {
+		return nil
+	}
+	if cfg.AllowOldGit {
+		log.Printf("⚠️ [Bridge] git %v is older than %v, some repository operations may fail (allowOldGit is set)\n", version, minVersion)
+		return nil
+	}
+	return fmt.Errorf("git %v is older than the required %v: upgrade git, or set allowOldGit to start anyway", version, minVersion)
+}
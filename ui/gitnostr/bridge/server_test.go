@@ -0,0 +1,232 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// fakeRelay is a minimal nostr relay: it sends a notice to every client, answers
+// subscriptions with its stored events and an EOSE, and stores published events.
+type fakeRelay struct {
+	URL string
+
+	mutex  sync.Mutex
+	events []nostr.Event
+}
+
+// newFakeRelay starts a fakeRelay. It isn't shut down with httptest's Close, which
+// waits for the hijacked websocket connections; the test binary exiting ends it.
+func newFakeRelay(t *testing.T, events ...nostr.Event) *fakeRelay {
+	t.Helper()
+	relay := &fakeRelay{events: events}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON([]any{"NOTICE", "welcome"})
+		for {
+			var message []json.RawMessage
+			if err := conn.ReadJSON(&message); err != nil || len(message) < 2 {
+				return
+			}
+			var label string
+			json.Unmarshal(message[0], &label)
+			switch label {
+			case "REQ":
+				var subID string
+				json.Unmarshal(message[1], &subID)
+				relay.mutex.Lock()
+				stored := append([]nostr.Event(nil), relay.events...)
+				relay.mutex.Unlock()
+				for _, event := range stored {
+					conn.WriteJSON([]any{"EVENT", subID, event})
+				}
+				conn.WriteJSON([]any{"EOSE", subID})
+			case "EVENT":
+				var event nostr.Event
+				json.Unmarshal(message[1], &event)
+				relay.mutex.Lock()
+				relay.events = append(relay.events, event)
+				relay.mutex.Unlock()
+				conn.WriteJSON([]any{"OK", event.ID, true, ""})
+			}
+		}
+	}))
+	relay.URL = "ws" + strings.TrimPrefix(server.URL, "http")
+	return relay
+}
+
+// newTestServer returns a Server with its database and repositories in a temporary
+// directory. It isn't run, tests call its handlers directly.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	server, err := New(Config{
+		RepositoryDir: filepath.Join(dir, "repos"),
+		DbFile:        filepath.Join(dir, "db.sqlite"),
+		PrivateKey:    nostr.GeneratePrivateKey(),
+		Relays:        []RelayConfig{{URL: "ws://127.0.0.1:1", Read: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// signedEvent signs an event of kind with tags by key, created at createdAt.
+func signedEvent(t *testing.T, key string, kind int, createdAt time.Time, tags nostr.Tags) nostr.Event {
+	t.Helper()
+	pubKey, err := nostr.GetPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := nostr.Event{PubKey: pubKey, CreatedAt: createdAt, Kind: kind, Tags: tags}
+	if err := event.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// Every reconnect of the relay loop tears the pool down like this; the goroutines
+// connectNostr started for it must not outlive it.
+func TestReconnectDoesNotLeakGoroutines(t *testing.T) {
+	relay := newFakeRelay(t)
+	relays := []RelayConfig{{URL: relay.URL, Read: true, Write: true}}
+
+	cycle := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		pool, err := connectNostr(ctx, relays, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Relays.Range(func(key string, value *nostr.Relay) bool {
+			pool.Remove(key)
+			value.Close()
+			return true
+		})
+		cancel()
+	}
+
+	// The first cycle starts goroutines that live as long as the process, like the http transport's
+	cycle()
+	time.Sleep(200 * time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		cycle()
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		after := runtime.NumGoroutine()
+		if after <= before+2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines before 20 reconnects, %d after:\n%s", before, after, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Servers keep their state to themselves, so two of them can run in one process,
+// each with its own database and repositories, and Run returns once stopped.
+func TestTwoServersInOneProcess(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ownerKey := nostr.GeneratePrivateKey()
+	ownerPubKey, _ := nostr.GetPublicKey(ownerKey)
+	announcement := nostr.Event{PubKey: ownerPubKey, CreatedAt: time.Now(), Kind: protocol.KindRepositoryNIP34, Tags: nostr.Tags{{"d", "repo"}}}
+	if err := announcement.Sign(ownerKey); err != nil {
+		t.Fatal(err)
+	}
+	relay := newFakeRelay(t, announcement)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var servers []*Server
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		dir := t.TempDir()
+		server, err := New(Config{
+			RepositoryDir: filepath.Join(dir, "repos"),
+			DbFile:        filepath.Join(dir, "db.sqlite"),
+			PrivateKey:    nostr.GeneratePrivateKey(),
+			Relays:        []RelayConfig{{URL: relay.URL, Read: true}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		server.Addr = ""
+		servers = append(servers, server)
+		go func() { results <- server.Run(ctx) }()
+	}
+
+	for _, server := range servers {
+		repoPath, err := server.Config().RepoPath(ownerPubKey, "repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			var count int
+			if err := server.DB().QueryRow("SELECT COUNT(*) FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, "repo").Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if _, statErr := os.Stat(repoPath); count == 1 && statErr == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("server with %s did not create the announced repository", server.Config().DbFile)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	cancel()
+	for range servers {
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Errorf("Run returned %v after its context was cancelled", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Run did not return after its context was cancelled")
+		}
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(Config{
+		RepositoryDir: filepath.Join(dir, "repos"),
+		DbFile:        filepath.Join(dir, "db.sqlite"),
+		PrivateKey:    nostr.GeneratePrivateKey(),
+	})
+	if err == nil || !strings.Contains(err.Error(), "no relays") {
+		t.Errorf("New() = %v, want the missing relays reported", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "db.sqlite")); err == nil {
+		t.Errorf("New() created the database for an invalid config")
+	}
+}
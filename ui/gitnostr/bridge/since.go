@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// sinceCompliantEvents watches for relays that ignore the Since of the subscription
+// and return older events. Each such relay is logged once; with enforce the old
+// events are dropped so they aren't processed again.
+func sinceCompliantEvents(ctx context.Context, filters nostr.Filters, events chan nostr.EventMessage, enforce bool) chan nostr.EventMessage {
+	compliant := make(chan nostr.EventMessage)
+	go func() {
+		nonCompliant := make(map[string]int)
+		defer func() {
+			for relay, count := range nonCompliant {
+				log.Printf("⚠️ [Bridge] Relay %s sent %d events older than the since filter\n", relay, count)
+			}
+			close(compliant)
+		}()
+		for message := range events {
+			since := subscriptionSince(filters, message.Event.Kind)
+			if since == nil || !message.Event.CreatedAt.Before(*since) {
+				select {
+				case compliant <- message:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			nonCompliant[message.Relay]++
+			if nonCompliant[message.Relay] == 1 {
+				log.Printf("⚠️ [Bridge] Relay %s ignores the since filter: got event %s from %s, requested since %s\n", message.Relay, message.Event.ID, message.Event.CreatedAt.Format(time.RFC3339), since.Format(time.RFC3339))
+			}
+			if !enforce {
+				select {
+				case compliant <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return compliant
+}
+
+// subscriptionSince returns the Since of the filter subscribing to kind.
+func subscriptionSince(filters nostr.Filters, kind int) *time.Time {
+	for _, filter := range filters {
+		for _, k := range filter.Kinds {
+			if k == kind {
+				return filter.Since
+			}
+		}
+	}
+	return nil
+}
+
+// sinceKinds are the kinds with a Since marker, see updateSince.
+var sinceKinds = []int{protocol.KindRepository, protocol.KindRepositoryNIP34, protocol.KindRepositoryState, protocol.KindSshKey}
+
+// SinceMarker is the created_at of the newest processed event of a subscribed kind.
+type SinceMarker struct {
+	Kind      int   `json:"kind"`
+	UpdatedAt int64 `json:"updatedAt"` // 0 if no event of the kind was processed yet
+}
+
+// ListSince returns the Since marker of every subscribed kind, in subscription order.
+func ListSince(db *sql.DB) ([]SinceMarker, error) {
+	var markers []SinceMarker
+	for _, kind := range sinceKinds {
+		marker := SinceMarker{Kind: kind}
+		err := db.QueryRow("SELECT UpdatedAt FROM Since WHERE Kind=?", kind).Scan(&marker.UpdatedAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("query since of kind %d : %w", kind, err)
+		}
+		markers = append(markers, marker)
+	}
+	return markers, nil
+}
+
+// seedSince raises the Since marker of every kind to t. Markers already past t are kept.
+func seedSince(db *sql.DB, t time.Time) error {
+	for _, kind := range sinceKinds {
+		if err := updateSince(kind, t.Unix(), db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySinceFlag makes since start at t for every kind whose stored marker isn't past t.
+func applySinceFlag(db *sql.DB, since map[int]*time.Time, t time.Time) {
+	for _, kind := range sinceKinds {
+		var stored int64
+		err := db.QueryRow("SELECT UpdatedAt FROM Since WHERE Kind=?", kind).Scan(&stored)
+		if err != nil || stored <= t.Unix() {
+			start := t
+			since[kind] = &start
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package bridge
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Events are processed concurrently, from relays and POST /api/event, and finish
+// in any order; the marker must end up at the newest, never moving backwards.
+func TestConcurrentUpdateSince(t *testing.T) {
+	db := openTestDb(t)
+	const kind, updates = 30617, 200
+
+	timestamps := rand.Perm(updates)
+	var wg sync.WaitGroup
+	errs := make(chan error, updates)
+	for _, ts := range timestamps {
+		wg.Add(1)
+		go func(updatedAt int64) {
+			defer wg.Done()
+			if err := updateSince(kind, updatedAt, db); err != nil {
+				errs <- err
+			}
+		}(int64(1700000000 + ts))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("updateSince: %v", err)
+	}
+
+	var got int64
+	if err := db.QueryRow("SELECT UpdatedAt FROM Since WHERE Kind=?", kind).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(1700000000 + updates - 1); got != want {
+		t.Errorf("Since = %d after concurrent updates, want the newest %d", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+// Types of SinkEvent.
+const (
+	SinkRepositoryCreated = "repository.created"
+	SinkRepositoryUpdated = "repository.updated"
+	SinkRepositoryDeleted = "repository.deleted"
+	SinkPermissionChanged = "permission.changed"
+	SinkPushReceived      = "push.received"
+)
+
+// SinkEvent is a processing result handed to the configured event sink.
+type SinkEvent struct {
+	Type    string         `json:"type"`
+	Time    int64          `json:"time"`
+	Owner   string         `json:"owner,omitempty"`
+	Repo    string         `json:"repo,omitempty"`
+	PubKey  string         `json:"pubkey,omitempty"`  // who caused it
+	EventID string         `json:"eventId,omitempty"` // the nostr event it came from, if any
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// EventSink delivers SinkEvents to an external system.
+type EventSink interface {
+	Emit(event SinkEvent) error
+	Close() error
+}
+
+var (
+	eventSinksMutex sync.Mutex
+	eventSinks      = map[string]func(target string) (EventSink, error){
+		"file": openFileSink,
+	}
+)
+
+// RegisterEventSink makes a sink available as eventSink "<scheme>:<target>".
+func RegisterEventSink(scheme string, open func(target string) (EventSink, error)) {
+	eventSinksMutex.Lock()
+	defer eventSinksMutex.Unlock()
+	eventSinks[scheme] = open
+}
+
+// OpenEventSink opens the sink configured as "<scheme>:<target>", e.g.
+// "file:~/git-nostr-events.jsonl". An empty spec returns a sink that drops everything.
+func OpenEventSink(spec string) (EventSink, error) {
+	if spec == "" {
+		return nopSink{}, nil
+	}
+
+	scheme, target, found := strings.Cut(spec, ":")
+	if !found || target == "" {
+		return nil, fmt.Errorf("eventSink must be <type>:<target>: %v", spec)
+	}
+
+	eventSinksMutex.Lock()
+	open, found := eventSinks[scheme]
+	eventSinksMutex.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown eventSink type %v", scheme)
+	}
+	return open(target)
+}
+
+type nopSink struct{}
+
+func (nopSink) Emit(SinkEvent) error { return nil }
+func (nopSink) Close() error         { return nil }
+
+// fileSink appends one JSON object per line. Each event is a single O_APPEND
+// write, so the bridge and git-nostr-ssh can share the file.
+type fileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func openFileSink(target string) (EventSink, error) {
+	path, err := gitnostr.ResolvePath(target)
+	if err != nil {
+		return nil, fmt.Errorf("resolve eventSink path : %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("open eventSink : %w", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Emit(event SinkEvent) error {
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,17 @@
+package bridge
+
+import (
+	"log"
+	"time"
+)
+
+// emit passes a processing result to the event sink of the server.
+func (s *Server) emit(event SinkEvent) {
+	if s.sink == nil {
+		return
+	}
+	event.Time = time.Now().Unix()
+	if err := s.sink.Emit(event); err != nil {
+		log.Printf("⚠️ [Bridge] Failed to emit %s event: %v\n", event.Type, err)
+	}
+}
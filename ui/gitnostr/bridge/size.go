@@ -0,0 +1,31 @@
+package bridge
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StoreRepoSize records the on-disk size of a repository. Sizes are cached in the
+// Repository table so the API never has to walk a repository directory.
+func StoreRepoSize(db *sql.DB, ownerPubKey, repoName string, sizeBytes int64) error {
+	_, err := db.Exec("UPDATE Repository SET SizeBytes=?,SizeUpdatedAt=? WHERE OwnerPubKey=? AND RepositoryName=?", sizeBytes, time.Now().Unix(), strings.ToLower(ownerPubKey), repoName)
+	if err != nil {
+		return fmt.Errorf("store repository size : %w", err)
+	}
+	return nil
+}
+
+// RefreshRepoSize walks the repository directory and stores its size.
+func RefreshRepoSize(db *sql.DB, cfg Config, ownerPubKey, repoName string) (int64, error) {
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		return 0, err
+	}
+	sizeBytes, err := DirSize(repoPath)
+	if err != nil {
+		return 0, fmt.Errorf("measure repository size : %w", err)
+	}
+	return sizeBytes, StoreRepoSize(db, ownerPubKey, repoName, sizeBytes)
+}
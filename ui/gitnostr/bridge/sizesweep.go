@@ -0,0 +1,52 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"log"
+	"time"
+)
+
+// runSizeSweeper keeps Repository.SizeBytes fresh for repositories whose size
+// wasn't refreshed by a push or gc within the sweep interval.
+func runSizeSweeper(ctx context.Context, db *sql.DB, cfg Config) {
+	interval := cfg.GetSizeSweepInterval()
+	for {
+		sweepRepoSizes(db, cfg, time.Now().Add(-interval).Unix())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func sweepRepoSizes(db *sql.DB, cfg Config, staleBefore int64) {
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName FROM Repository WHERE SizeUpdatedAt<?", staleBefore)
+	if err != nil {
+		log.Printf("⚠️ [Bridge] size sweep: failed to query repositories: %v\n", err)
+		return
+	}
+
+	type repoKey struct{ owner, name string }
+	var repos []repoKey
+	for rows.Next() {
+		var repo repoKey
+		if err := rows.Scan(&repo.owner, &repo.name); err != nil {
+			log.Printf("⚠️ [Bridge] size sweep: failed to scan repository: %v\n", err)
+			rows.Close()
+			return
+		}
+		repos = append(repos, repo)
+	}
+	rows.Close()
+
+	for _, repo := range repos {
+		_, err := RefreshRepoSize(db, cfg, repo.owner, repo.name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("⚠️ [Bridge] size sweep: %s/%s: %v\n", repo.owner, repo.name, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Ways the bridge can hand ssh keys to sshd.
+const (
+	AuthorizedKeysModeFile    = "file"    // the bridge rewrites ~/.ssh/authorized_keys
+	AuthorizedKeysModeCommand = "command" // sshd asks `git-nostr-ssh keys` via AuthorizedKeysCommand
+)
+
+// GetAuthorizedKeysMode returns the configured authorized keys mode, defaulting to file.
+func (cfg Config) GetAuthorizedKeysMode() string {
+	if cfg.AuthorizedKeysMode == "" {
+		return AuthorizedKeysModeFile
+	}
+	return cfg.AuthorizedKeysMode
+}
+
+// AuthorizedKeyLine returns the authorized_keys line that forces sshKey to run
+// sshCommand for pubKey.
+func AuthorizedKeyLine(sshCommand, pubKey, sshKey string) string {
+	return fmt.Sprintf("command=\"%v %v\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty %v", sshCommand, pubKey, sshKey)
+}
+
+// SshKeyFingerprint returns the SHA256 fingerprint of an authorized_keys style
+// key ("<type> <base64> [comment]") in the format sshd passes as %f.
+func SshKeyFingerprint(sshKey string) (string, error) {
+	fields := strings.Fields(sshKey)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("invalid ssh key: %v", sshKey)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid ssh key : %w", err)
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
@@ -1,4 +1,4 @@
-package main
+package bridge
 
 import (
 	"database/sql"
@@ -10,10 +10,13 @@ import (
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/arbadacarbaYK/gitnostr"
-	"github.com/arbadacarbaYK/gitnostr/bridge"
 )
 
-func updateAuthorizedKeys(db *sql.DB) error {
+func updateAuthorizedKeys(db *sql.DB, cfg Config) error {
+
+	if cfg.GetAuthorizedKeysMode() == AuthorizedKeysModeCommand {
+		return nil // sshd looks keys up through `git-nostr-ssh keys`
+	}
 
 	bridgeExePath, err := os.Readlink("/proc/self/exe")
 	if err != nil {
@@ -49,7 +52,7 @@ func updateAuthorizedKeys(db *sql.DB) error {
 			return err
 		}
 
-		fmt.Fprintf(w, "command=\"%v %v\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty %v\n", cmd, pubKey, sshKey)
+		fmt.Fprintln(w, AuthorizedKeyLine(cmd, pubKey, sshKey))
 	}
 	err = rows.Close()
 	if err != nil {
@@ -71,7 +74,7 @@ func updateAuthorizedKeys(db *sql.DB) error {
 	return nil
 }
 
-func handleSshKeyEvent(event nostr.Event, db *sql.DB, cfg bridge.Config) error {
+func handleSshKeyEvent(event nostr.Event, db *sql.DB, cfg Config) error {
 
 	keyData := event.Content
 
@@ -95,5 +98,5 @@ func handleSshKeyEvent(event nostr.Event, db *sql.DB, cfg bridge.Config) error {
 		log.Println("ssh-key updated", event.Content)
 	}
 
-	return updateAuthorizedKeys(db)
+	return nil
 }
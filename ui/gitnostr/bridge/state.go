@@ -1,18 +1,14 @@
-package main
+package bridge
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/nbd-wtf/go-nostr"
-	"github.com/arbadacarbaYK/gitnostr"
-	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
 )
 
 // ErrRepositoryNotExists is returned when a state event arrives before the repository is created.
@@ -26,7 +22,7 @@ func headRefTargetExists(repoPath, ref string) bool {
 	if ref == "" {
 		return false
 	}
-	cmd := exec.Command("git", "--git-dir", repoPath, "show-ref", "--verify", "-q", ref)
+	cmd := Git("--git-dir", repoPath, "show-ref", "--verify", "-q", ref)
 	return cmd.Run() == nil
 }
 
@@ -52,7 +48,7 @@ func pickRecoverableHeadRef(
 			return r.ref
 		}
 	}
-	out, err := exec.Command("git", "--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/heads").Output()
+	out, err := Git("--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/heads").Output()
 	if err != nil {
 		return ""
 	}
@@ -67,7 +63,8 @@ func pickRecoverableHeadRef(
 
 // handleRepositoryStateEvent processes NIP-34 state events (kind 30618)
 // These events contain refs and commits that need to be updated in the git repository
-func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config) error {
+func (s *Server) handleRepositoryStateEvent(event nostr.Event) error {
+	db, cfg := s.db, s.cfg
 	// Extract repository name from "d" tag (must match announcement event)
 	var repoName string
 	for _, tag := range event.Tags {
@@ -81,12 +78,10 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 	}
 
 	// Resolve repository path (same as announcement event)
-	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	repoPath, err := cfg.RepoPath(event.PubKey, repoName)
 	if err != nil {
-		return fmt.Errorf("resolve repos path: %w", err)
+		return err
 	}
-	repoParentPath := filepath.Join(reposDir, event.PubKey)
-	repoPath := filepath.Join(repoParentPath, repoName+".git")
 
 	// Check if repository exists
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
@@ -96,13 +91,19 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 		return ErrRepositoryNotExists // Return special error to prevent updateSince
 	}
 
+	unlock, err := LockRepoShared(repoPath)
+	if err != nil {
+		return fmt.Errorf("lock repository: %w", err)
+	}
+	defer unlock()
+
 	// Extract refs from tags
 	// NIP-34 format: ["refs/heads/main", "commit-sha"] where tag name is ref path, value is commit SHA
 	var refsToUpdate []struct {
 		ref    string
 		commit string
 	}
-	var headRef string
+	var headRef, headCommit string
 
 	for _, tag := range event.Tags {
 		if len(tag) < 2 {
@@ -112,10 +113,15 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 		tagName := tag[0]
 		tagValue := tag[1]
 
-		// Handle HEAD tag: ["HEAD", "ref: refs/heads/main"]
-		if tagName == "HEAD" && strings.HasPrefix(tagValue, "ref: ") {
-			headRef = strings.TrimPrefix(tagValue, "ref: ")
-			log.Printf("📌 [Bridge] State event HEAD: %s\n", headRef)
+		// Handle HEAD tag: ["HEAD", "ref: refs/heads/main"], ["HEAD", "refs/heads/main"]
+		// or a detached ["HEAD", "<commit-sha>"]
+		if tagName == "HEAD" {
+			headRef, headCommit = protocol.ParseHead(tagValue)
+			if headRef == "" && headCommit == "" {
+				log.Printf("⚠️ [Bridge] Ignoring unrecognized HEAD %q in state event\n", tagValue)
+			} else {
+				log.Printf("📌 [Bridge] State event HEAD: %s%s\n", headRef, headCommit)
+			}
 		} else if strings.HasPrefix(tagName, "refs/") {
 			// Handle ref tags: ["refs/heads/main", "commit-sha"]
 			refsToUpdate = append(refsToUpdate, struct {
@@ -130,7 +136,7 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 
 	// Only return early if there are no refs AND no HEAD to update
 	// A state event might contain only a HEAD tag without refs
-	if len(refsToUpdate) == 0 && headRef == "" {
+	if len(refsToUpdate) == 0 && headRef == "" && headCommit == "" {
 		log.Printf("⚠️ [Bridge] State event has no refs or HEAD to update: pubkey=%s repo=%s\n", event.PubKey, repoName)
 		return nil // Not an error - state event might have empty refs initially
 	}
@@ -147,7 +153,7 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 		// CRITICAL: Validate commit exists before updating ref
 		// This handles cases where state events have invalid commit SHAs (e.g., after migration)
 		// Check if commit exists using git cat-file -e (exits with 0 if exists, 1 if not)
-		checkCmd := exec.Command("git", "--git-dir", repoPath, "cat-file", "-e", ref.commit)
+		checkCmd := cfg.Git("--git-dir", repoPath, "cat-file", "-e", ref.commit)
 		checkErr := checkCmd.Run()
 		if checkErr != nil {
 			// Commit doesn't exist - try to fallback to current HEAD of this ref
@@ -158,7 +164,7 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 			log.Printf("⚠️ [Bridge] Commit %s doesn't exist (possibly invalid after migration), trying HEAD fallback for ref %s\n", commitDisplay, ref.ref)
 			
 			// Try to get current HEAD commit of this ref
-			headCmd := exec.Command("git", "--git-dir", repoPath, "rev-parse", ref.ref)
+			headCmd := cfg.Git("--git-dir", repoPath, "rev-parse", ref.ref)
 			headOutput, headErr := headCmd.Output()
 			if headErr == nil {
 				headCommit := strings.TrimSpace(string(headOutput))
@@ -178,7 +184,7 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 		// CRITICAL: Check if the commit is empty (has no files)
 		// If the commit is empty and the current ref points to a commit with files, don't overwrite it
 		// This prevents state events from overwriting valid commits (e.g., from GitHub clones) with empty commits
-		lsTreeCmd := exec.Command("git", "--git-dir", repoPath, "ls-tree", "-r", "--name-only", ref.commit)
+		lsTreeCmd := cfg.Git("--git-dir", repoPath, "ls-tree", "-r", "--name-only", ref.commit)
 		lsTreeOutput, lsTreeErr := lsTreeCmd.Output()
 		if lsTreeErr == nil {
 			files := strings.TrimSpace(string(lsTreeOutput))
@@ -190,13 +196,13 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 				log.Printf("⚠️ [Bridge] Commit %s is empty (no files), checking if current ref has files\n", commitDisplay)
 				
 				// Check if current ref exists and has files
-				currentRefCmd := exec.Command("git", "--git-dir", repoPath, "rev-parse", ref.ref)
+				currentRefCmd := cfg.Git("--git-dir", repoPath, "rev-parse", ref.ref)
 				currentRefOutput, currentRefErr := currentRefCmd.Output()
 				if currentRefErr == nil {
 					currentCommit := strings.TrimSpace(string(currentRefOutput))
 					if currentCommit != "" && currentCommit != ref.commit {
 						// Check if current commit has files
-						currentLsTreeCmd := exec.Command("git", "--git-dir", repoPath, "ls-tree", "-r", "--name-only", currentCommit)
+						currentLsTreeCmd := cfg.Git("--git-dir", repoPath, "ls-tree", "-r", "--name-only", currentCommit)
 						currentLsTreeOutput, currentLsTreeErr := currentLsTreeCmd.Output()
 						if currentLsTreeErr == nil {
 							currentFiles := strings.TrimSpace(string(currentLsTreeOutput))
@@ -216,9 +222,14 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 			}
 		}
 
+		// Refs flipped by a burst of state events are updated at most once per window
+		if !s.throttleRefUpdate(repoPath, ref.ref, ref.commit) {
+			continue
+		}
+
 		// Update ref using git update-ref
 		// Format: git update-ref refs/heads/main commit-sha
-		cmd := exec.Command("git", "--git-dir", repoPath, "update-ref", ref.ref, ref.commit)
+		cmd := cfg.Git("--git-dir", repoPath, "update-ref", ref.ref, ref.commit)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			// Safely truncate commit SHA for logging (handle short SHAs)
@@ -248,15 +259,38 @@ func handleRepositoryStateEvent(event nostr.Event, db *sql.DB, cfg bridge.Config
 		if resolved == "" {
 			log.Printf("⚠️ [Bridge] Skipping HEAD update: no existing refs/heads/* matches state (requested %s)\n", headRef)
 		} else {
-			cmd := exec.Command("git", "--git-dir", repoPath, "symbolic-ref", "HEAD", headRef)
+			cmd := cfg.Git("--git-dir", repoPath, "symbolic-ref", "HEAD", headRef)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
 				log.Printf("⚠️ [Bridge] Failed to update HEAD to %s: %v\n", headRef, err)
 				log.Printf("🔍 [Bridge] Git output: %s\n", string(output))
 			} else {
 				log.Printf("✅ [Bridge] Updated HEAD to %s\n", headRef)
+				_, err = db.Exec("UPDATE Repository SET DefaultBranch=? WHERE OwnerPubKey=? AND RepositoryName=?", strings.TrimPrefix(headRef, "refs/heads/"), event.PubKey, repoName)
+				if err != nil {
+					log.Printf("⚠️ [Bridge] Failed to record default branch of %s/%s: %v\n", event.PubKey, repoName, err)
+				}
 			}
 		}
+	} else if headCommit != "" {
+		// Detached HEAD: only point it at a commit the repository has
+		if err := cfg.Git("--git-dir", repoPath, "cat-file", "-e", headCommit+"^{commit}").Run(); err != nil {
+			log.Printf("⚠️ [Bridge] Skipping HEAD update: commit %s doesn't exist\n", headCommit[:8])
+		} else {
+			output, err := cfg.Git("--git-dir", repoPath, "update-ref", "--no-deref", "HEAD", headCommit).CombinedOutput()
+			if err != nil {
+				log.Printf("⚠️ [Bridge] Failed to detach HEAD at %s: %v\n", headCommit[:8], err)
+				log.Printf("🔍 [Bridge] Git output: %s\n", string(output))
+			} else {
+				log.Printf("✅ [Bridge] Detached HEAD at %s\n", headCommit[:8])
+			}
+		}
+	}
+
+	if cfg.DumbHttp {
+		if err := UpdateServerInfo(repoPath); err != nil {
+			log.Printf("⚠️ [Bridge] %v\n", err)
+		}
 	}
 
 	log.Printf("✅ [Bridge] Successfully processed state event: pubkey=%s repo=%s\n", event.PubKey, repoName)
@@ -0,0 +1,34 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type RepositoryStats struct {
+	PushCount        int64  `json:"pushCount"`
+	LastPushAt       int64  `json:"lastPushAt,omitempty"`
+	LastPusherPubKey string `json:"lastPusherPubKey,omitempty"`
+}
+
+// RecordPush counts a successful receive-pack by pusherPubKey.
+func RecordPush(db *sql.DB, ownerPubKey, repoName, pusherPubKey string, pushedAt int64) error {
+	pusherPubKey = strings.ToLower(pusherPubKey)
+	_, err := db.Exec("INSERT INTO RepositoryStats (OwnerPubKey,RepositoryName,PushCount,LastPushAt,LastPusherPubKey) VALUES (?,?,1,?,?) ON CONFLICT DO UPDATE SET PushCount=PushCount+1,LastPushAt=?,LastPusherPubKey=?;", ownerPubKey, repoName, pushedAt, pusherPubKey, pushedAt, pusherPubKey)
+	if err != nil {
+		return fmt.Errorf("record push : %w", err)
+	}
+	return nil
+}
+
+// GetRepositoryStats returns zero stats for repositories that were never pushed to.
+func GetRepositoryStats(db *sql.DB, ownerPubKey, repoName string) (RepositoryStats, error) {
+	var stats RepositoryStats
+	err := db.QueryRow("SELECT PushCount,LastPushAt,LastPusherPubKey FROM RepositoryStats WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&stats.PushCount, &stats.LastPushAt, &stats.LastPusherPubKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return RepositoryStats{}, fmt.Errorf("query repository stats : %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// handleStatusEvent stores the latest NIP-34 status of an issue or patch for each
+// repository it references. Only statuses published by someone with write access
+// to the repository (owner, maintainers, WRITE/ADMIN grants) are recorded.
+func handleStatusEvent(event nostr.Event, db *sql.DB, cfg Config) error {
+
+	status, err := protocol.ParseStatus(event)
+	if err != nil {
+		return fmt.Errorf("malformed status: %w", err)
+	}
+
+	updatedAt := event.CreatedAt.Unix()
+	for _, repo := range status.Repositories {
+		access, err := ResolveAccess(db, repo.PubKey, repo.Identifier, event.PubKey)
+		if err != nil {
+			if errors.Is(err, ErrRepositoryNotFound) {
+				continue
+			}
+			return err
+		}
+		if access < AccessWrite {
+			log.Printf("⚠️ [Bridge] Ignoring status %s on %s from %s (no write access)\n", status.Status, repo, event.PubKey)
+			continue
+		}
+
+		res, err := db.Exec("INSERT INTO RepositoryEventStatus (OwnerPubKey,RepositoryName,TargetEventId,Status,StatusEventId,AuthorPubKey,UpdatedAt) VALUES (?,?,?,?,?,?,?) ON CONFLICT DO UPDATE SET Status=?,StatusEventId=?,AuthorPubKey=?,UpdatedAt=? WHERE UpdatedAt<?;", repo.PubKey, repo.Identifier, status.TargetEventID, status.Status, event.ID, event.PubKey, updatedAt, status.Status, event.ID, event.PubKey, updatedAt, updatedAt)
+		if err != nil {
+			return fmt.Errorf("insert status failed: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("rows affected failed: %w", err)
+		}
+
+		if affected == 1 {
+			log.Printf("🏷️ [Bridge] Status updated: %s/%s event=%s status=%s\n", repo.PubKey, repo.Identifier, status.TargetEventID, status.Status)
+		}
+	}
+
+	return nil
+}
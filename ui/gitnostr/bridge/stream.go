@@ -0,0 +1,247 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+const (
+	streamPollInterval   = time.Second
+	streamKeepalive      = 15 * time.Second
+	streamWriteTimeout   = 30 * time.Second
+	streamClientBacklog  = 64
+	streamMaxEntriesPoll = 500
+)
+
+// streamedTypes are the audit verbs /api/events/stream passes on.
+var streamedTypes = map[string]bool{
+	SinkRepositoryCreated: true,
+	SinkRepositoryUpdated: true,
+	SinkRepositoryDeleted: true,
+	SinkPushReceived:      true,
+}
+
+// StreamEvent is one message of /api/events/stream.
+type StreamEvent struct {
+	Id      int64  `json:"id"`
+	Type    string `json:"type"`
+	Time    int64  `json:"time"`
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	PubKey  string `json:"pubkey,omitempty"`
+	EventID string `json:"eventId,omitempty"`
+}
+
+// eventStream tails the audit log and fans repository changes out to the connected
+// stream clients. Tailing the audit log, rather than the bridge's own sink, also
+// picks up the pushes git-nostr-ssh records and works on follower instances.
+type eventStream struct {
+	mutex   sync.Mutex
+	clients map[*streamClient]bool
+}
+
+// streamClient is one connection of /api/events/stream. A client that doesn't read
+// its backlog in time loses events; dropped counts them until it is told.
+type streamClient struct {
+	owner   string
+	events  chan StreamEvent
+	dropped int
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{clients: map[*streamClient]bool{}}
+}
+
+func (es *eventStream) subscribe(owner string) *streamClient {
+	client := &streamClient{owner: owner, events: make(chan StreamEvent, streamClientBacklog)}
+	es.mutex.Lock()
+	es.clients[client] = true
+	es.mutex.Unlock()
+	return client
+}
+
+func (es *eventStream) unsubscribe(client *streamClient) {
+	es.mutex.Lock()
+	delete(es.clients, client)
+	es.mutex.Unlock()
+}
+
+// takeDropped returns and resets how many events the client lost.
+func (es *eventStream) takeDropped(client *streamClient) int {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	dropped := client.dropped
+	client.dropped = 0
+	return dropped
+}
+
+func (es *eventStream) broadcast(event StreamEvent) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	for client := range es.clients {
+		if client.owner != "" && client.owner != event.Owner {
+			continue
+		}
+		select {
+		case client.events <- event:
+		default:
+			client.dropped++
+		}
+	}
+}
+
+// run polls the audit log for new entries and broadcasts those of publicly
+// readable repositories. Entries written before the bridge started are skipped.
+func (es *eventStream) run(ctx context.Context, db *sql.DB) {
+	var lastId int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(Id),0) FROM AuditLog").Scan(&lastId); err != nil {
+		log.Printf("⚠️ [Bridge] event stream: failed to query audit log: %v\n", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(streamPollInterval):
+		}
+		events, newLastId, err := pollStreamEvents(db, lastId)
+		if err != nil {
+			log.Printf("⚠️ [Bridge] event stream: %v\n", err)
+			continue
+		}
+		lastId = newLastId
+		for _, event := range events {
+			es.broadcast(event)
+		}
+	}
+}
+
+// pollStreamEvents returns the streamed audit entries after lastId and the id to
+// continue from.
+func pollStreamEvents(db *sql.DB, lastId int64) ([]StreamEvent, int64, error) {
+	rows, err := db.Query("SELECT Id,Time,Verb,OwnerPubKey,RepositoryName,PubKey,EventId,Data FROM AuditLog WHERE Id>? ORDER BY Id LIMIT ?", lastId, streamMaxEntriesPoll)
+	if err != nil {
+		return nil, lastId, fmt.Errorf("query audit log : %w", err)
+	}
+	type entry struct {
+		event StreamEvent
+		data  string
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.event.Id, &e.event.Time, &e.event.Type, &e.event.Owner, &e.event.Repo, &e.event.PubKey, &e.event.EventID, &e.data); err != nil {
+			rows.Close()
+			return nil, lastId, fmt.Errorf("scan audit entry : %w", err)
+		}
+		lastId = e.event.Id
+		if streamedTypes[e.event.Type] {
+			entries = append(entries, e)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, lastId, fmt.Errorf("query audit log : %w", err)
+	}
+
+	var events []StreamEvent
+	for _, e := range entries {
+		if streamPublic(db, e.event, e.data) {
+			events = append(events, e.event)
+		}
+	}
+	return events, lastId, nil
+}
+
+// streamPublic reports whether the repository of an entry is publicly readable.
+// Deleted repositories have no row anymore; their entry records what they were.
+func streamPublic(db *sql.DB, event StreamEvent, data string) bool {
+	if event.Type == SinkRepositoryDeleted {
+		var recorded struct {
+			PublicRead bool `json:"publicRead"`
+		}
+		return data != "" && json.Unmarshal([]byte(data), &recorded) == nil && recorded.PublicRead
+	}
+	var publicRead bool
+	err := db.QueryRow("SELECT PublicRead FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", event.Owner, event.Repo).Scan(&publicRead)
+	return err == nil && publicRead
+}
+
+// handleEventStream serves /api/events/stream: Server-Sent Events of repository
+// creates, updates, deletes and pushes, optionally only those of ?owner=.
+func handleEventStream(stream *eventStream) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		owner := ""
+		if value := r.URL.Query().Get("owner"); value != "" {
+			pubKey, err := gitnostr.DecodePubKey(value)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "owner must be a hex or npub public key")
+				return
+			}
+			owner = pubKey
+		}
+
+		client := stream.subscribe(owner)
+		defer stream.unsubscribe(client)
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// Each write gets its own deadline instead of httpWriteTimeout, which would end
+		// the stream; a client that doesn't read for that long is disconnected
+		controller := http.NewResponseController(w)
+		send := func(message string) bool {
+			_ = controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprint(w, message); err != nil {
+				return false
+			}
+			return controller.Flush() == nil
+		}
+
+		if !send(": connected\n\n") {
+			return
+		}
+		keepalive := time.NewTicker(streamKeepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepalive.C:
+				if !send(": keepalive\n\n") {
+					return
+				}
+			case event := <-client.events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				message := fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+				// Once the backlog is sent, tell the client how many events it missed
+				if len(client.events) == 0 {
+					if dropped := stream.takeDropped(client); dropped > 0 {
+						message += fmt.Sprintf("event: dropped\ndata: {\"dropped\":%d}\n\n", dropped)
+					}
+				}
+				if !send(message) {
+					return
+				}
+			}
+		}
+	}
+}
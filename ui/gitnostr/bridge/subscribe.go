@@ -0,0 +1,87 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// subscriptionBatches splits filters into relay subscriptions listing at most
+// maxAuthors authors each. Relays reject or silently truncate filters with too many
+// authors, which would drop events of the pubkeys past their limit. Filters within
+// the limit share the first subscription; every chunk of a longer author list gets
+// its own.
+func subscriptionBatches(filters nostr.Filters, maxAuthors int) []nostr.Filters {
+	var small nostr.Filters
+	var batches []nostr.Filters
+	for _, filter := range filters {
+		if len(filter.Authors) <= maxAuthors {
+			small = append(small, filter)
+			continue
+		}
+		for start := 0; start < len(filter.Authors); start += maxAuthors {
+			end := start + maxAuthors
+			if end > len(filter.Authors) {
+				end = len(filter.Authors)
+			}
+			chunk := filter
+			chunk.Authors = filter.Authors[start:end]
+			batches = append(batches, nostr.Filters{chunk})
+		}
+		log.Printf("🔍 [Bridge] Split %d authors of kinds %v into %d subscriptions (maxFilterAuthors=%d)\n", len(filter.Authors), filter.Kinds, (len(filter.Authors)+maxAuthors-1)/maxAuthors, maxAuthors)
+	}
+	if len(small) > 0 {
+		batches = append([]nostr.Filters{small}, batches...)
+	}
+	return batches
+}
+
+// subscribeBatches subscribes to every batch and merges their event streams. The
+// pool never closes its streams, so the merged one is closed once ctx is cancelled.
+func subscribeBatches(ctx context.Context, pool *nostr.RelayPool, batches []nostr.Filters) chan nostr.EventMessage {
+	merged := make(chan nostr.EventMessage)
+	var wg sync.WaitGroup
+	for _, batch := range batches {
+		_, events := pool.Sub(batch)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case message := <-events:
+					select {
+					case merged <- message:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// filterRejectionHints are words relays use in notices rejecting an oversized filter,
+// e.g. "too many authors" or "filter too large".
+var filterRejectionHints = []string{"too many", "too large", "too big", "filter", "limit"}
+
+// isFilterRejection reports whether a relay notice looks like the rejection of a
+// subscription filter.
+func isFilterRejection(notice string) bool {
+	notice = strings.ToLower(notice)
+	for _, hint := range filterRejectionHints {
+		if strings.Contains(notice, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestSubscriptionBatches(t *testing.T) {
+	authors := []string{"a", "b", "c", "d", "e"}
+	filters := nostr.Filters{
+		{Kinds: []int{51}},
+		{Kinds: []int{52}, Authors: authors},
+	}
+
+	batches := subscriptionBatches(filters, 2)
+	if len(batches) != 4 {
+		t.Fatalf("got %d batches, want 4", len(batches))
+	}
+	if len(batches[0]) != 1 || batches[0][0].Kinds[0] != 51 {
+		t.Errorf("first batch = %v, want the filter without authors", batches[0])
+	}
+	var got []string
+	for _, batch := range batches[1:] {
+		if len(batch) != 1 || len(batch[0].Authors) > 2 {
+			t.Errorf("batch %v has more than 2 authors", batch)
+		}
+		got = append(got, batch[0].Authors...)
+	}
+	if len(got) != len(authors) {
+		t.Errorf("batches cover authors %v, want %v", got, authors)
+	}
+}
+
+// The relay pipeline is rebuilt on every reconnect, so each stage must stop with the
+// pool's context instead of waiting on streams the pool never closes.
+func TestRelayPipelineStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := nostr.NewRelayPool()
+	filters := nostr.Filters{{Kinds: []int{51}}}
+
+	events := uniqueEvents(ctx, sinceCompliantEvents(ctx, filters, readableEvents(ctx, pool, subscribeBatches(ctx, pool, []nostr.Filters{filters})), true))
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("got an event from a pool without relays")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline still open after its context was cancelled")
+	}
+}
+
+func TestUniqueEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan nostr.EventMessage, 3)
+	in <- nostr.EventMessage{Relay: "wss://a", Event: nostr.Event{ID: "1"}}
+	in <- nostr.EventMessage{Relay: "wss://b", Event: nostr.Event{ID: "1"}}
+	in <- nostr.EventMessage{Relay: "wss://b", Event: nostr.Event{ID: "2"}}
+	close(in)
+
+	var ids []string
+	for event := range uniqueEvents(ctx, in) {
+		ids = append(ids, event.ID)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("got %v, want [1 2]", ids)
+	}
+}
@@ -0,0 +1,93 @@
+package bridge
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// refUpdateWindow is the minimum time between two state-event updates of the same ref.
+const refUpdateWindow = 10 * time.Second
+
+// refThrottle tracks the recent and deferred state-event updates of refs.
+type refThrottle struct {
+	sync.Mutex
+	last    map[string]time.Time // key -> time of the last update
+	pending map[string]string    // key -> commit of the deferred update
+}
+
+func newRefThrottle() *refThrottle {
+	return &refThrottle{last: make(map[string]time.Time), pending: make(map[string]string)}
+}
+
+// throttleRefUpdate reports whether a state event may move ref to commit now. If the
+// ref was updated within refUpdateWindow the update is deferred to the end of the
+// window instead, and later updates replace the deferred one. A ref flipped back and
+// forth by a stream of state events is thus written at most once per window and still
+// ends up at the last state.
+func (s *Server) throttleRefUpdate(repoPath, ref, commit string) bool {
+	refUpdates := s.refUpdates
+	key := repoPath + "\x00" + ref
+	now := time.Now()
+
+	refUpdates.Lock()
+	defer refUpdates.Unlock()
+
+	_, waiting := refUpdates.pending[key]
+	last, seen := refUpdates.last[key]
+	if !waiting && (!seen || now.Sub(last) >= refUpdateWindow) {
+		refUpdates.last[key] = now
+		refUpdates.forgetOld(now)
+		return true
+	}
+
+	if !waiting {
+		log.Printf("🐢 [Bridge] Throttling updates of %s in %s: last update %s ago, applying the latest state in %s\n", ref, repoPath, now.Sub(last).Round(time.Millisecond), (refUpdateWindow - now.Sub(last)).Round(time.Millisecond))
+		time.AfterFunc(refUpdateWindow-now.Sub(last), func() { s.applyDeferredRefUpdate(repoPath, ref, key) })
+	}
+	refUpdates.pending[key] = commit
+	return false
+}
+
+// forgetOld keeps the map from growing with every ref ever updated.
+// t must be locked.
+func (t *refThrottle) forgetOld(now time.Time) {
+	if len(t.last) < 10000 {
+		return
+	}
+	for key, last := range t.last {
+		if _, waiting := t.pending[key]; !waiting && now.Sub(last) >= refUpdateWindow {
+			delete(t.last, key)
+		}
+	}
+}
+
+func (s *Server) applyDeferredRefUpdate(repoPath, ref, key string) {
+	refUpdates := s.refUpdates
+	refUpdates.Lock()
+	commit := refUpdates.pending[key]
+	delete(refUpdates.pending, key)
+	refUpdates.last[key] = time.Now()
+	refUpdates.Unlock()
+
+	unlock, err := LockRepoShared(repoPath)
+	if err != nil {
+		log.Printf("⚠️ [Bridge] Failed to lock %s for deferred update of %s: %v\n", repoPath, ref, err)
+		return
+	}
+	defer unlock()
+
+	output, err := s.cfg.Git("--git-dir", repoPath, "update-ref", ref, commit).CombinedOutput()
+	if err != nil {
+		log.Printf("⚠️ [Bridge] Failed to apply deferred update of %s to %s: %v\n", ref, commit, err)
+		log.Printf("🔍 [Bridge] Git output: %s\n", string(output))
+		return
+	}
+	log.Printf("✅ [Bridge] Applied deferred update of %s in %s to %s\n", ref, repoPath, commit)
+
+	if s.cfg.DumbHttp {
+		if err := UpdateServerInfo(repoPath); err != nil {
+			log.Printf("⚠️ [Bridge] %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+)
+
+// TrashDirName is the directory below repositoryDir that deleted repositories are
+// moved to while deleteGracePeriod runs.
+const TrashDirName = ".deleted"
+
+// TrashRepository moves a deleted repository to <reposDir>/.deleted as
+// <owner>-<repo>-<unix time>.git instead of removing it, and returns the new path.
+// It is restored by moving it back and announcing the repository again.
+func TrashRepository(reposDir, repoPath, ownerPubKey, repoName string) (string, error) {
+	trashDir := filepath.Join(reposDir, TrashDirName)
+	if err := os.MkdirAll(trashDir, 0750); err != nil {
+		return "", fmt.Errorf("create trash directory : %w", err)
+	}
+	trashPath := filepath.Join(trashDir, fmt.Sprintf("%s-%s-%d.git", ownerPubKey, repoName, time.Now().Unix()))
+	if err := os.Rename(repoPath, trashPath); err != nil {
+		return "", fmt.Errorf("move repository to trash : %w", err)
+	}
+	return trashPath, nil
+}
+
+// runTrashPurger removes deleted repositories once their deleteGracePeriod is over,
+// checking every hour.
+func runTrashPurger(ctx context.Context, cfg Config) {
+	for {
+		purgeTrash(cfg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
+
+func purgeTrash(cfg Config) {
+	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	if err != nil {
+		log.Printf("⚠️ [Bridge] trash purge: %v\n", err)
+		return
+	}
+	trashDir := filepath.Join(reposDir, TrashDirName)
+	entries, err := os.ReadDir(trashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ [Bridge] trash purge: failed to read %s: %v\n", trashDir, err)
+		return
+	}
+
+	cutoff := time.Now().Add(-cfg.DeleteGracePeriod.Duration()).Unix()
+	for _, entry := range entries {
+		// The deletion time is the last "-" separated part of the name
+		name := strings.TrimSuffix(entry.Name(), ".git")
+		deletedAt, err := strconv.ParseInt(name[strings.LastIndex(name, "-")+1:], 10, 64)
+		if err != nil || deletedAt > cutoff {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(trashDir, entry.Name())); err != nil {
+			log.Printf("⚠️ [Bridge] trash purge: failed to remove %s: %v\n", entry.Name(), err)
+			continue
+		}
+		log.Printf("🗑️ [Bridge] Removed deleted repository %s, its grace period is over\n", entry.Name())
+	}
+}
@@ -0,0 +1,157 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Statuses of a WebhookDelivery row.
+const (
+	DeliveryPending   = "pending"   // not delivered yet, retried at NextAttemptAt
+	DeliveryDelivered = "delivered" // the hook answered 2xx
+	DeliveryFailed    = "failed"    // gave up after MaxDeliveryAttempts
+)
+
+// MaxDeliveryAttempts is how often a webhook delivery is tried before it is marked failed.
+const MaxDeliveryAttempts = 8
+
+// deliveryGrace is how long a queued delivery waits for its first attempt, which
+// git-nostr-ssh makes right away, before the bridge's retrier picks it up.
+const deliveryGrace = time.Minute
+
+// WebhookDelivery is one POST of a push to a repository hook and its outcome.
+type WebhookDelivery struct {
+	Id             int64  `json:"id"`
+	Url            string `json:"url"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	LastStatusCode int    `json:"lastStatusCode,omitempty"` // 0 if the hook never answered
+	LastError      string `json:"lastError,omitempty"`
+	CreatedAt      int64  `json:"createdAt"`
+	NextAttemptAt  int64  `json:"nextAttemptAt,omitempty"` // pending deliveries only
+	DeliveredAt    int64  `json:"deliveredAt,omitempty"`
+}
+
+// deliveryBackoff returns how long to wait after the given number of failed
+// attempts: 30s, doubling up to an hour.
+func deliveryBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > time.Hour {
+		return time.Hour
+	}
+	return backoff
+}
+
+// QueueDelivery stores a pending delivery of payload to hookURL and returns its id.
+func QueueDelivery(db *sql.DB, hookURL string, payload PostReceivePayload) (int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("marshal hook payload : %w", err)
+	}
+	now := time.Now()
+	res, err := db.Exec("INSERT INTO WebhookDelivery (OwnerPubKey,RepositoryName,Url,Payload,Status,Attempts,LastStatusCode,LastError,CreatedAt,NextAttemptAt,DeliveredAt) VALUES (?,?,?,?,?,0,0,'',?,?,0)", payload.Owner, payload.Repo, hookURL, string(body), DeliveryPending, now.Unix(), now.Add(deliveryGrace).Unix())
+	if err != nil {
+		return 0, fmt.Errorf("queue webhook delivery : %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// AttemptDelivery POSTs a pending delivery and records the outcome: delivered on a
+// 2xx answer, otherwise pending again after a backoff, or failed once
+// MaxDeliveryAttempts are used up. The returned error is the delivery's.
+func AttemptDelivery(db *sql.DB, id int64) error {
+	var hookURL, payload, status string
+	var attempts int
+	err := db.QueryRow("SELECT Url,Payload,Status,Attempts FROM WebhookDelivery WHERE Id=?", id).Scan(&hookURL, &payload, &status, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("webhook delivery %d not found", id)
+	}
+	if err != nil {
+		return fmt.Errorf("query webhook delivery : %w", err)
+	}
+	if status != DeliveryPending {
+		return nil
+	}
+
+	statusCode, deliveryErr := postHook(hookURL, []byte(payload), id)
+	attempts++
+	now := time.Now()
+	switch {
+	case deliveryErr == nil:
+		_, err = db.Exec("UPDATE WebhookDelivery SET Status=?,Attempts=?,LastStatusCode=?,LastError='',NextAttemptAt=0,DeliveredAt=? WHERE Id=?", DeliveryDelivered, attempts, statusCode, now.Unix(), id)
+	case attempts >= MaxDeliveryAttempts:
+		_, err = db.Exec("UPDATE WebhookDelivery SET Status=?,Attempts=?,LastStatusCode=?,LastError=?,NextAttemptAt=0 WHERE Id=?", DeliveryFailed, attempts, statusCode, deliveryErr.Error(), id)
+	default:
+		_, err = db.Exec("UPDATE WebhookDelivery SET Attempts=?,LastStatusCode=?,LastError=?,NextAttemptAt=? WHERE Id=?", attempts, statusCode, deliveryErr.Error(), now.Add(deliveryBackoff(attempts)).Unix(), id)
+	}
+	if err != nil {
+		return fmt.Errorf("update webhook delivery : %w", err)
+	}
+	return deliveryErr
+}
+
+// ListDeliveries returns the newest deliveries of a repository first, at most limit.
+func ListDeliveries(db *sql.DB, ownerPubKey, repoName string, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query("SELECT Id,Url,Status,Attempts,LastStatusCode,LastError,CreatedAt,NextAttemptAt,DeliveredAt FROM WebhookDelivery WHERE OwnerPubKey=? AND RepositoryName=? ORDER BY Id DESC LIMIT ?", ownerPubKey, repoName, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook deliveries : %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.Id, &d.Url, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.NextAttemptAt, &d.DeliveredAt); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery : %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// runDeliveryRetrier retries due webhook deliveries every 30 seconds.
+func runDeliveryRetrier(ctx context.Context, db *sql.DB) {
+	for {
+		retryDeliveries(db, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+func retryDeliveries(db *sql.DB, now time.Time) {
+	rows, err := db.Query("SELECT Id FROM WebhookDelivery WHERE Status=? AND NextAttemptAt<=? ORDER BY NextAttemptAt", DeliveryPending, now.Unix())
+	if err != nil {
+		log.Printf("⚠️ [Bridge] webhook retry: failed to query deliveries: %v\n", err)
+		return
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("⚠️ [Bridge] webhook retry: failed to scan delivery: %v\n", err)
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := AttemptDelivery(db, id); err != nil {
+			log.Printf("⚠️ [Bridge] webhook delivery %d failed: %v\n", id, err)
+		} else {
+			log.Printf("🪝 [Bridge] webhook delivery %d delivered\n", id)
+		}
+	}
+}
@@ -1,231 +1,19 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/nbd-wtf/go-nostr"
 	"github.com/arbadacarbaYK/gitnostr"
 	"github.com/arbadacarbaYK/gitnostr/bridge"
-	"github.com/arbadacarbaYK/gitnostr/protocol"
 )
 
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func getSshKeyPubKeys(db *sql.DB) ([]string, error) {
-
-	var sshKeyPubKeys []string
-	rows, err := db.Query("SELECT DISTINCT(TargetPubKey) FROM RepositoryPermission")
-	if err != nil {
-		return nil, err
-	}
-
-	for rows.Next() {
-		var targetPubKey string
-		err := rows.Scan(&targetPubKey)
-		if err != nil {
-			return nil, err
-		}
-
-		sshKeyPubKeys = append(sshKeyPubKeys, targetPubKey)
-	}
-
-	return sshKeyPubKeys, nil
-
-}
-
-func connectNostr(relays []string) (*nostr.RelayPool, error) {
-
-	pool := nostr.NewRelayPool()
-
-	connectedRelays := []string{}
-	for _, relay := range relays {
-		cherr := pool.Add(relay, nostr.SimplePolicy{
-			Read:  true,
-			Write: false,
-		})
-		err := <-cherr
-		if err != nil {
-			log.Printf("relay connect failed : %v\n", err)
-		} else {
-			connectedRelays = append(connectedRelays, relay)
-			log.Printf("relay connected: %s\n", relay)
-		}
-	}
-
-	if len(connectedRelays) > 0 {
-		log.Printf("connected to %d/%d relays: %v\n", len(connectedRelays), len(relays), connectedRelays)
-	}
-
-	relayConnected := false
-	pool.Relays.Range(func(key string, r *nostr.Relay) bool {
-		relayConnected = true
-		return false
-	})
-	if !relayConnected {
-		return nil, fmt.Errorf("no relays connected")
-	}
-
-	go func() {
-		for notice := range pool.Notices {
-			log.Printf("notice: %s '%s'\n", notice.Relay, notice.Message)
-		}
-	}()
-
-	return pool, nil
-}
-
-func minTime(times ...*time.Time) *time.Time {
-	var min *time.Time
-	for _, t := range times {
-		if t == nil {
-			continue
-		}
-		if min == nil || t.Before(*min) {
-			tmp := *t
-			min = &tmp
-		}
-	}
-	return min
-}
-
-func updateSince(kind int, updatedAt int64, db *sql.DB) error {
-	_, err := db.Exec("INSERT INTO Since (Kind,UpdatedAt) VALUES (?,?) ON CONFLICT DO UPDATE SET UpdatedAt=? WHERE UpdatedAt<?;", kind, updatedAt, updatedAt, updatedAt)
-	if err != nil {
-		return fmt.Errorf("insert since failed: %w", err)
-	}
-
-	return nil
-}
-
-func getSince(db *sql.DB) (map[int]*time.Time, error) {
-
-	since := make(map[int]*time.Time)
-	rows, err := db.Query("SELECT Kind,UpdatedAt FROM Since")
-	if err != nil {
-		return nil, err
-	}
-
-	for rows.Next() {
-		var kind int
-		var updatedAt int64
-		err := rows.Scan(&kind, &updatedAt)
-		if err != nil {
-			return nil, err
-		}
-
-		// CRITICAL: Subtract 1 hour to avoid missing events due to clock skew
-		// But if Since is very old (more than 24 hours), reset it to 1 hour ago to catch recent events
-		t := time.Unix(updatedAt, 0).Add(-1 * time.Hour)
-		now := time.Now()
-		if now.Sub(t) > 24*time.Hour {
-			// Since is very old - reset to 1 hour ago to catch recent events
-			t = now.Add(-1 * time.Hour)
-			log.Printf("⚠️ [Bridge] Since timestamp for kind %d is very old, resetting to 1 hour ago\n", kind)
-		}
-		since[kind] = &t
-	}
-
-	return since, nil
-}
-
-// processEvent handles an event from either relay or direct API
-func processEvent(event nostr.Event, db *sql.DB, cfg bridge.Config, sshKeyPubKeys *[]string) bool {
-	log.Printf("📥 [Bridge] Received event: kind=%d, id=%s, pubkey=%s, created_at=%d\n", event.Kind, event.ID, event.PubKey, event.CreatedAt.Unix())
-	switch event.Kind {
-	case protocol.KindRepository, protocol.KindRepositoryNIP34:
-		log.Printf("📦 [Bridge] Processing repository event: kind=%d id=%s, pubkey=%s\n", event.Kind, event.ID, event.PubKey)
-		err := handleRepositoryEvent(event, db, cfg)
-		if err != nil {
-			log.Printf("❌ [Bridge] Failed to handle repository event: %v\n", err)
-			return false
-		}
-		log.Printf("✅ [Bridge] Successfully processed repository event: id=%s\n", event.ID)
-
-		err = updateSince(event.Kind, event.CreatedAt.Unix(), db)
-		if err != nil {
-			log.Printf("❌ [Bridge] Failed to update Since: %v\n", err)
-			return false
-		}
-		return false // Don't need to reconnect
-
-	case protocol.KindSshKey:
-		err := handleSshKeyEvent(event, db, cfg)
-		if err != nil {
-			log.Println(err)
-			return false
-		}
-
-		err = updateSince(protocol.KindSshKey, event.CreatedAt.Unix(), db)
-		if err != nil {
-			log.Println(err)
-			return false
-		}
-		return false
-
-	case protocol.KindRepositoryState:
-		log.Printf("📊 [Bridge] Processing repository state event: kind=%d id=%s, pubkey=%s\n", event.Kind, event.ID, event.PubKey)
-		err := handleRepositoryStateEvent(event, db, cfg)
-		if err != nil {
-			// Check if repository doesn't exist yet - don't mark as processed so it can be reprocessed
-			if err == ErrRepositoryNotExists {
-				log.Printf("⏳ [Bridge] State event deferred (repository not created yet): id=%s\n", event.ID)
-				log.Printf("💡 [Bridge] Event will be reprocessed when repository is created\n")
-				return false // Don't reconnect, but don't update Since either
-			}
-			log.Printf("❌ [Bridge] Failed to handle repository state event: %v\n", err)
-			return false
-		}
-		log.Printf("✅ [Bridge] Successfully processed repository state event: id=%s\n", event.ID)
-
-		err = updateSince(protocol.KindRepositoryState, event.CreatedAt.Unix(), db)
-		if err != nil {
-			log.Printf("❌ [Bridge] Failed to update Since: %v\n", err)
-			return false
-		}
-		return false // Don't need to reconnect
-
-	case protocol.KindRepositoryPermission:
-		err := handleRepositorPermission(event, db, cfg)
-		if err != nil {
-			log.Println(err)
-			return false
-		}
-
-		err = updateSince(protocol.KindRepository, event.CreatedAt.Unix(), db) //Permissions are queried in the same filter as KindRepository
-		if err != nil {
-			log.Println(err)
-			return false
-		}
-
-		newSshKeyPubKeys, err := getSshKeyPubKeys(db)
-		if err != nil {
-			log.Println(err)
-			return false
-		}
-
-		if len(newSshKeyPubKeys) != len(*sshKeyPubKeys) {
-			*sshKeyPubKeys = newSshKeyPubKeys
-			return true // Need to reconnect
-		}
-		return false
-	}
-	return false
-}
-
 func main() {
 
 	if len(os.Args) > 1 && os.Args[1] == "license" {
@@ -233,231 +21,45 @@ func main() {
 		os.Exit(0)
 	}
 
-	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	db, err := bridge.OpenDb(cfg.DbFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+	dryRun := flag.Bool("dry-run", false, "log what would be done without changing the database or repositories")
+	sinceFlag := flag.String("since", "", "skip events before this point: a duration like 72h, a unix timestamp or an RFC 3339 time")
+	reconcile := flag.Bool("reconcile", false, "repair the repository directory from the database before subscribing")
+	flag.Parse()
 
-	sshDir, err := gitnostr.ResolvePath("~/.ssh")
-	if err != nil {
-		log.Fatal(err)
+	var startSince *time.Time
+	if *sinceFlag != "" {
+		t, err := bridge.ParseSince(*sinceFlag, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		startSince = &t
 	}
-	os.MkdirAll(sshDir, 0700)
 
-	err = updateAuthorizedKeys(db)
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sshKeyPubKeys, err := getSshKeyPubKeys(db)
+	server, err := bridge.New(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer server.Close()
 
-	// Channel for direct API events
-	directEvents := make(chan nostr.Event, 100)
-	seenEventIDs := make(map[string]bool)
-	var seenMutex sync.RWMutex
-
-	// Start HTTP server for direct event submission
+	server.DryRun = *dryRun
+	server.Since = startSince
+	server.Reconcile = *reconcile
 	httpPort := os.Getenv("BRIDGE_HTTP_PORT")
 	if httpPort == "" {
 		httpPort = "8080"
 	}
-	
-	http.HandleFunc("/api/event", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	server.Addr = ":" + httpPort
 
-		// Read raw body for debugging
-		bodyBytes, err := io.ReadAll(r.Body)
-		if err != nil {
-			log.Printf("❌ [Bridge API] Failed to read request body: %v\n", err)
-			http.Error(w, fmt.Sprintf("Failed to read body: %v", err), http.StatusBadRequest)
-			return
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		var event nostr.Event
-		if err := json.Unmarshal(bodyBytes, &event); err != nil {
-			log.Printf("❌ [Bridge API] Failed to decode event JSON: %v\n", err)
-			log.Printf("🔍 [Bridge API] Raw event (first 500 chars): %s\n", string(bodyBytes[:min(len(bodyBytes), 500)]))
-			http.Error(w, fmt.Sprintf("Invalid event JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-
-		// Log event details before signature check
-		log.Printf("🔍 [Bridge API] Decoded event: kind=%d, id=%s, pubkey=%s, created_at=%d, sig_len=%d\n",
-			event.Kind, event.ID, event.PubKey, event.CreatedAt.Unix(), len(event.Sig))
-
-		// CRITICAL: Verify event ID matches calculated hash first
-		// However, if there's a mismatch, it might be due to JSON serialization differences
-		// between JavaScript and Go. Since the event was already published to relays successfully,
-		// we can trust the provided ID and continue processing.
-		calculatedID := event.GetID()
-		if calculatedID != event.ID {
-			log.Printf("⚠️ [Bridge API] Event ID mismatch (likely serialization difference): calculated=%s, provided=%s\n", calculatedID, event.ID)
-			log.Printf("🔍 [Bridge API] Event details: kind=%d, pubkey=%s, created_at=%d\n",
-				event.Kind, event.PubKey, event.CreatedAt.Unix())
-			log.Printf("💡 [Bridge API] Using provided ID (event was validated by Nostr relays)\n")
-			// Continue processing - the event was already validated by relays
-			// The ID mismatch is likely due to JSON serialization differences between JS and Go
-		} else {
-			log.Printf("✅ [Bridge API] Event ID verified: %s (matches calculated hash)\n", event.ID)
-		}
-
-		// Validate event signature
-		// Note: If signature check fails but event ID is correct, we still accept it
-		// because the event was already validated by Nostr relays (which accepted it)
-		// This handles cases where JSON serialization differences cause signature check to fail
-		ok, err := event.CheckSignature()
-		if err != nil {
-			log.Printf("⚠️ [Bridge API] Event signature check error (but ID is valid): %v\n", err)
-			log.Printf("🔍 [Bridge API] Event ID verified: %s (matches calculated hash)\n", event.ID)
-			// Continue processing - event ID is correct, so event structure is valid
-			// The signature check failure is likely due to JSON serialization differences
-		} else if !ok {
-			log.Printf("⚠️ [Bridge API] Signature check failed (but ID is valid): id=%s, kind=%d\n", event.ID, event.Kind)
-			log.Printf("🔍 [Bridge API] Event ID verified: %s (matches calculated hash)\n", event.ID)
-			log.Printf("🔍 [Bridge API] Event details: pubkey=%s, sig=%s (first 32 chars), created_at=%d\n",
-				event.PubKey, event.Sig[:min(len(event.Sig), 32)], event.CreatedAt.Unix())
-			// Continue processing - event ID is correct, signature check failure is likely serialization issue
-		} else {
-			log.Printf("✅ [Bridge API] Event signature verified: id=%s\n", event.ID)
-		}
-
-		// Check if we've already seen this event (deduplication)
-		seenMutex.RLock()
-		seen := seenEventIDs[event.ID]
-		seenMutex.RUnlock()
-		if seen {
-			log.Printf("⚠️ [Bridge API] Duplicate event ignored: id=%s\n", event.ID)
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "duplicate", "message": "Event already processed"})
-			return
-		}
-
-		// Mark as seen
-		seenMutex.Lock()
-		seenEventIDs[event.ID] = true
-		// Clean up old entries (keep last 10000)
-		if len(seenEventIDs) > 10000 {
-			// Simple cleanup: clear map periodically (in production, use LRU cache)
-			seenEventIDs = make(map[string]bool)
-		}
-		seenMutex.Unlock()
-
-		// Send to processing channel
-		select {
-		case directEvents <- event:
-			log.Printf("✅ [Bridge API] Event accepted: kind=%d, id=%s\n", event.Kind, event.ID)
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "eventId": event.ID})
-		default:
-			log.Printf("⚠️ [Bridge API] Event channel full, dropping: id=%s\n", event.ID)
-			http.Error(w, "Event queue full", http.StatusServiceUnavailable)
-		}
-	})
-
-	go func() {
-		log.Printf("🌐 [Bridge] Starting HTTP server on port %s for direct event submission\n", httpPort)
-		if err := http.ListenAndServe(":"+httpPort, nil); err != nil {
-			log.Fatalf("❌ [Bridge] HTTP server failed: %v\n", err)
-		}
-	}()
-
-	for {
-		pool, err := connectNostr(cfg.Relays)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		since, err := getSince(db)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Build filter for repository events (legacy kind 51 + NIP-34 kind 30617 + state events 30618) and permissions
-		repoSince := minTime(since[protocol.KindRepository], since[protocol.KindRepositoryNIP34], since[protocol.KindRepositoryState])
-		repoFilter := nostr.Filter{
-			Kinds: []int{
-				protocol.KindRepository,
-				protocol.KindRepositoryPermission,
-				protocol.KindRepositoryNIP34,
-				protocol.KindRepositoryState, // NIP-34: State events with refs/commits
-			},
-			Since: repoSince,
-		}
-		if len(cfg.GitRepoOwners) > 0 {
-			repoFilter.Authors = cfg.GitRepoOwners
-		}
-		// If gitRepoOwners is empty, don't set Authors - this makes it watch ALL repos
-		
-		if repoSince != nil {
-			log.Printf("🔍 [Bridge] Subscribing to repository events since: %s (kinds 51, 30617, 30618)\n", repoSince.Format(time.RFC3339))
-		} else {
-			log.Printf("🔍 [Bridge] Subscribing to ALL repository events (no Since filter, kinds 51, 30617, 30618)\n")
-		}
-		if len(cfg.GitRepoOwners) > 0 {
-			log.Printf("🔍 [Bridge] Filtering by authors: %v\n", cfg.GitRepoOwners)
-		} else {
-			log.Printf("🔍 [Bridge] Watching ALL authors (decentralized mode)\n")
-		}
-		
-		_, gitNostrEvents := pool.Sub(nostr.Filters{
-			repoFilter,
-			{
-				Authors: sshKeyPubKeys,
-				Kinds:   []int{protocol.KindSshKey},
-				Since:   since[protocol.KindSshKey],
-			},
-		})
-
-		// Merge relay events and direct API events
-		// Use a buffered channel to prevent blocking
-		mergedEvents := make(chan nostr.Event, 200)
-		
-		go func() {
-		for event := range nostr.Unique(gitNostrEvents) {
-				// Mark relay events as seen
-				seenMutex.Lock()
-				seenEventIDs[event.ID] = true
-				if len(seenEventIDs) > 10000 {
-					seenEventIDs = make(map[string]bool)
-				}
-				seenMutex.Unlock()
-				mergedEvents <- event
-			}
-		}()
-		go func() {
-			for event := range directEvents {
-				mergedEvents <- event
-			}
-		}()
-
-	exit:
-		// Process merged events (deduplication already handled by seenEventIDs)
-		for event := range mergedEvents {
-			needsReconnect := processEvent(event, db, cfg, &sshKeyPubKeys)
-			if needsReconnect {
-					//There doesn't seem to be a function to cancel the subscription and resubscribe so I have to reconnect
-					pool.Relays.Range(func(key string, value *nostr.Relay) bool {
-						pool.Remove(key)
-						value.Close()
-						return true
-					})
-				// Note: Goroutines will naturally stop when channels close or loop breaks
-				// Since we're in an infinite loop, they'll be recreated on next iteration
-					break exit
-			}
-		}
+	err = server.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
 	}
-
 }
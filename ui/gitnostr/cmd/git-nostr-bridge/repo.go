@@ -1,407 +0,0 @@
-package main
-
-import (
-	"database/sql"
-	"encoding/hex"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io/fs"
-	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
-	"strings"
-
-	"github.com/arbadacarbaYK/gitnostr"
-	"github.com/arbadacarbaYK/gitnostr/bridge"
-	"github.com/arbadacarbaYK/gitnostr/protocol"
-	"github.com/nbd-wtf/go-nostr"
-	"github.com/nbd-wtf/go-nostr/nip19"
-)
-
-func handleRepositoryEvent(event nostr.Event, db *sql.DB, cfg bridge.Config) error {
-	var repo protocol.Repository
-	var repoName string
-	var cloneUrls []string
-	var sourceUrl string
-	var isDeleted bool
-	var isArchived bool
-
-	// Handle NIP-34 events (kind 30617) - data is in tags, not content
-	if event.Kind == protocol.KindRepositoryNIP34 {
-		// Extract repository name from "d" tag
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "d" {
-				repoName = tag[1]
-				break
-			}
-		}
-		if repoName == "" {
-			return fmt.Errorf("NIP-34 event missing 'd' tag with repository name")
-		}
-
-		// Extract clone URLs from "clone" tags
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "clone" {
-				cloneUrl := tag[1]
-				if cloneUrl != "" {
-					cloneUrls = append(cloneUrls, cloneUrl)
-				}
-			}
-			if len(tag) >= 2 && tag[0] == "source" {
-				sourceUrl = tag[1]
-			}
-		}
-
-		// Extract deleted/archived flags from content (if present) or tags
-		if event.Content != "" {
-			err := json.Unmarshal([]byte(event.Content), &repo)
-			if err == nil {
-				isDeleted = repo.Deleted
-				isArchived = repo.Archived
-			}
-		}
-		// Also check for deleted/archived in tags (some implementations use this)
-		// and visibility tags (gittr extension: ["public-read","true|false"],
-		// ["public-write","true|false"]). Missing tags keep the NIP-34 defaults
-		// (public read, owner-only write) so older announcements stay public.
-		publicRead := true
-		publicWrite := false
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "deleted" && tag[1] == "true" {
-				isDeleted = true
-			}
-			if len(tag) >= 2 && tag[0] == "archived" && tag[1] == "true" {
-				isArchived = true
-			}
-			if len(tag) >= 2 && tag[0] == "public-read" && tag[1] == "false" {
-				publicRead = false
-			}
-			if len(tag) >= 2 && tag[0] == "public-write" && tag[1] == "true" {
-				publicWrite = true
-			}
-		}
-
-		// Set values for NIP-34 (visibility from tags, defaults above)
-		repo.RepositoryName = repoName
-		repo.PublicRead = publicRead
-		repo.PublicWrite = publicWrite
-		repo.Deleted = isDeleted
-		repo.Archived = isArchived
-	} else {
-		// Legacy kind 51 - parse from JSON content
-		err := json.Unmarshal([]byte(event.Content), &repo)
-		if err != nil {
-			return fmt.Errorf("malformed repository: %w : %v", err, event.Content)
-		}
-		repoName = repo.RepositoryName
-	}
-
-	if !bridge.IsValidRepoName(repoName) {
-		return fmt.Errorf("invalid repository name: %v", repoName)
-	}
-
-	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
-	if err != nil {
-		return fmt.Errorf("resolve repos path : %w", err)
-	}
-	repoParentPath := filepath.Join(reposDir, event.PubKey)
-	repoPath := filepath.Join(repoParentPath, repoName+".git")
-
-	if repo.Deleted {
-		log.Printf("🗑️ [Bridge] Repository marked deleted: pubkey=%s repo=%s\n", event.PubKey, repoName)
-		_, err := db.Exec("DELETE FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
-		if err != nil {
-			return fmt.Errorf("delete repository row failed: %w", err)
-		}
-		_, err = db.Exec("DELETE FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
-		if err != nil {
-			return fmt.Errorf("delete repository permissions failed: %w", err)
-		}
-		_, _ = db.Exec("DELETE FROM RepositoryPushPolicy WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
-		_, _ = db.Exec("DELETE FROM RepositoryPushPayment WHERE OwnerPubKey=? AND RepositoryName=?;", event.PubKey, repoName)
-		if err := os.RemoveAll(repoPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
-			return fmt.Errorf("remove repository path failed: %w", err)
-		}
-		return nil
-	}
-
-	updatedAt := event.CreatedAt.Unix()
-	res, err := db.Exec("INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES (?,?,?,?,?) ON CONFLICT DO UPDATE SET PublicRead=?,PublicWrite=?,UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, repoName, repo.PublicRead, repo.PublicWrite, updatedAt, repo.PublicRead, repo.PublicWrite, updatedAt, updatedAt)
-	if err != nil {
-		return fmt.Errorf("insert repository failed: %w", err)
-	}
-
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows affected failed: %w", err)
-	}
-
-	if affected == 1 {
-		log.Printf("✅ [Bridge] Repository updated: pubkey=%s repo=%s\n", event.PubKey, repoName)
-	}
-
-	// Sync NIP-34 maintainers into RepositoryPermission (Permission=WRITE) so
-	// SSH and web-API ACLs cover gittr contributors. gittr publishes no kind-50
-	// permission events — the 30617 announcement is the source of truth, so
-	// stale rows for this repo are replaced whenever a newer event arrives.
-	if event.Kind == protocol.KindRepositoryNIP34 {
-		var maintainers []string
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && (tag[0] == "maintainers" || tag[0] == "merge_maintainers") {
-				for _, v := range tag[1:] {
-					v = strings.ToLower(strings.TrimSpace(v))
-					if len(v) == 64 {
-						if _, err := hex.DecodeString(v); err == nil {
-							maintainers = append(maintainers, v)
-						}
-					}
-				}
-			}
-		}
-		if _, err := db.Exec("DELETE FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=? AND UpdatedAt<?;", event.PubKey, repoName, updatedAt); err != nil {
-			log.Printf("⚠️ [Bridge] Failed to clear stale permissions for %s/%s: %v\n", event.PubKey, repoName, err)
-		}
-		for _, m := range maintainers {
-			if strings.EqualFold(m, event.PubKey) {
-				continue // owner has implicit ADMIN
-			}
-			if _, err := db.Exec("INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES (?,?,?,?,?) ON CONFLICT DO UPDATE SET Permission=?,UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, repoName, m, "WRITE", updatedAt, "WRITE", updatedAt, updatedAt); err != nil {
-				log.Printf("⚠️ [Bridge] Failed to sync maintainer permission %s on %s/%s: %v\n", m, event.PubKey, repoName, err)
-			}
-		}
-	}
-
-	// Optional repo-level push cost policy from NIP-34 tags.
-	// Tag format: ["push_cost_sats", "<integer>"].
-	pushCostSats := 0
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == "push_cost_sats" {
-			if parsed, parseErr := strconv.Atoi(strings.TrimSpace(tag[1])); parseErr == nil && parsed >= 0 {
-				pushCostSats = parsed
-			}
-			break
-		}
-	}
-	_, err = db.Exec(
-		"INSERT INTO RepositoryPushPolicy (OwnerPubKey,RepositoryName,PushCostSats,UpdatedAt) VALUES (?,?,?,?) ON CONFLICT DO UPDATE SET PushCostSats=?,UpdatedAt=? WHERE UpdatedAt<=?;",
-		event.PubKey, repoName, pushCostSats, updatedAt,
-		pushCostSats, updatedAt, updatedAt,
-	)
-	if err != nil {
-		return fmt.Errorf("insert push policy failed: %w", err)
-	}
-
-	err = os.MkdirAll(repoParentPath, 0750)
-	if err != nil {
-		if errors.Is(err, fs.ErrExist) {
-			//Ignore
-		} else {
-			return fmt.Errorf("repository path mkdir: %w", err)
-		}
-	}
-	// HTTPS git (git-http-backend via fcgiwrap as www-data) must traverse owner dirs.
-	// www-data is typically in supplementary group `git-nostr`; group needs rx on this directory.
-	// Older installs used 0700 here, which breaks https://git…/<pubkey>/<repo>.git (404) while SSH still works.
-	if st, err := os.Stat(repoParentPath); err == nil && st.IsDir() {
-		_ = os.Chmod(repoParentPath, 0750)
-	}
-
-	// Check if repository already exists
-	repoExists := false
-	_, err = os.Stat(repoPath)
-	if err == nil {
-		repoExists = true
-	} else if !errors.Is(err, fs.ErrNotExist) {
-		return fmt.Errorf("git repository stat: %w", err)
-	}
-
-	// If repo doesn't exist, try to clone from source URL or clone URLs
-	if !repoExists {
-		// Priority 1: Try to clone from source URL (GitHub/GitLab/Codeberg)
-		if sourceUrl != "" && (strings.Contains(sourceUrl, "github.com") || strings.Contains(sourceUrl, "gitlab.com") || strings.Contains(sourceUrl, "codeberg.org")) {
-			// Convert source URL to clone URL
-			cloneUrl := sourceUrl
-			if !strings.HasSuffix(cloneUrl, ".git") {
-				cloneUrl = cloneUrl + ".git"
-			}
-			log.Printf("🔍 [Bridge] Attempting to clone from source URL: %s\n", cloneUrl)
-			err := cloneRepository(cloneUrl, repoPath)
-			if err == nil {
-				log.Printf("✅ [Bridge] Successfully cloned repository from source URL: %s\n", cloneUrl)
-				ensureUploadPackBrowserCaps(repoPath)
-				return nil
-			}
-			log.Printf("⚠️ [Bridge] Failed to clone from source URL, will try clone URLs: %v\n", err)
-		}
-
-		// Priority 2: Try to clone from clone URLs (prefer HTTPS)
-		if len(cloneUrls) > 0 {
-			// Prefer HTTPS URLs over SSH
-			var httpsUrl string
-			for _, url := range cloneUrls {
-				if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
-					httpsUrl = url
-					break
-				}
-			}
-			// If no HTTPS found, use first clone URL
-			if httpsUrl == "" {
-				httpsUrl = cloneUrls[0]
-			}
-
-			log.Printf("🔍 [Bridge] Attempting to clone from clone URL: %s\n", httpsUrl)
-			err := cloneRepository(httpsUrl, repoPath)
-			if err == nil {
-				log.Printf("✅ [Bridge] Successfully cloned repository from clone URL: %s\n", httpsUrl)
-				ensureUploadPackBrowserCaps(repoPath)
-				return nil
-			}
-			log.Printf("⚠️ [Bridge] Failed to clone from clone URL, will create empty repo: %v\n", err)
-		}
-
-		// Fallback: Create empty bare repository
-		log.Printf("📦 [Bridge] Creating empty bare repository: %s\n", repoName+".git")
-		cmd := exec.Command("git", "init", "--bare", repoName+".git")
-		cmd.Dir = repoParentPath
-
-		err = cmd.Run()
-		if err != nil {
-			return fmt.Errorf("git init --bare failed : %w", err)
-		}
-
-		ensureUploadPackBrowserCaps(repoPath)
-
-		// CRITICAL: Set HEAD to "main" branch so git clone works properly
-		// This ensures empty repos can be cloned and pushed to immediately
-		// Without this, git clone may fail or create a repo with no default branch
-		headCmd := exec.Command("git", "--git-dir", repoPath, "symbolic-ref", "HEAD", "refs/heads/main")
-		err = headCmd.Run()
-		if err != nil {
-			// If main fails, try master (some systems default to master)
-			headCmd = exec.Command("git", "--git-dir", repoPath, "symbolic-ref", "HEAD", "refs/heads/master")
-			err = headCmd.Run()
-			if err != nil {
-				log.Printf("⚠️ [Bridge] Warning: Failed to set HEAD for empty repo %s: %v\n", repoName, err)
-				// Continue anyway - repo is created, user can set branch on first push
-			} else {
-				log.Printf("✅ [Bridge] Set HEAD to master for empty repo: %s\n", repoName)
-			}
-		} else {
-			log.Printf("✅ [Bridge] Set HEAD to main for empty repo: %s\n", repoName)
-		}
-	}
-
-	// CRITICAL: Create symlink from npub to hex pubkey for NIP-34 compatibility
-	// Clone URLs use npub format (per NIP-34 spec), but we store repos by hex pubkey
-	// This symlink allows both formats to work: hex (storage) and npub (URLs)
-	if event.PubKey != "" && len(event.PubKey) == 64 {
-		// Check if pubkey is valid hex
-		if _, err := hex.DecodeString(event.PubKey); err == nil {
-			// Encode hex pubkey to npub format
-			// go-nostr nip19 package: EncodePublicKey(publicKeyHex string, masterRelay string)
-			// masterRelay can be empty string for npub encoding
-			npub, err := nip19.EncodePublicKey(event.PubKey, "")
-			if err == nil {
-				npubParentPath := filepath.Join(reposDir, npub)
-				// Create symlink from npub to hex directory
-				// Only create if it doesn't exist or is broken
-				if _, err := os.Lstat(npubParentPath); os.IsNotExist(err) {
-					err = os.Symlink(event.PubKey, npubParentPath)
-					if err == nil {
-						log.Printf("🔗 [Bridge] Created npub symlink: %s -> %s\n", npub, event.PubKey)
-					} else {
-						log.Printf("⚠️ [Bridge] Failed to create npub symlink: %v\n", err)
-					}
-				} else {
-					// Check if existing symlink points to correct target
-					target, err := os.Readlink(npubParentPath)
-					if err == nil && target != event.PubKey {
-						// Symlink exists but points to wrong target, update it
-						os.Remove(npubParentPath)
-						err = os.Symlink(event.PubKey, npubParentPath)
-						if err == nil {
-							log.Printf("🔗 [Bridge] Updated npub symlink: %s -> %s\n", npub, event.PubKey)
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
-// Clone repository from URL to path
-// ensureUploadPackBrowserCaps advertises partial-clone filter + tip SHA wants.
-// gitworkshop's explorer requires the "filter" capability; without it info/refs
-// succeeds but tree fetch fails as "upload-pack failed".
-func ensureUploadPackBrowserCaps(repoPath string) {
-	_ = exec.Command("git", "--git-dir", repoPath, "config", "uploadpack.allowFilter", "true").Run()
-	_ = exec.Command("git", "--git-dir", repoPath, "config", "uploadpack.allowAnySHA1InWant", "true").Run()
-	_ = exec.Command("git", "--git-dir", repoPath, "config", "uploadpack.allowReachableSHA1InWant", "true").Run()
-}
-
-func cloneRepository(cloneUrl, repoPath string) error {
-	// Normalize URL: convert git:// to https://, git@ to https://
-	normalizedUrl := cloneUrl
-	if strings.HasPrefix(normalizedUrl, "git://") {
-		normalizedUrl = strings.Replace(normalizedUrl, "git://", "https://", 1)
-	} else if strings.HasPrefix(normalizedUrl, "git@") {
-		// Convert git@host:path to https://host/path
-		normalizedUrl = strings.Replace(normalizedUrl, "git@", "https://", 1)
-		normalizedUrl = strings.Replace(normalizedUrl, ":", "/", 1)
-	}
-
-	// Ensure parent directory exists
-	parentDir := filepath.Dir(repoPath)
-	err := os.MkdirAll(parentDir, 0700)
-	if err != nil {
-		return fmt.Errorf("failed to create parent directory: %w", err)
-	}
-
-	// Clone repository
-	log.Printf("🔍 [Bridge] Executing: git clone --bare %s %s\n", normalizedUrl, repoPath)
-	cmd := exec.Command("git", "clone", "--bare", normalizedUrl, repoPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("git clone failed: %w", err)
-	}
-
-	return nil
-}
-
-func handleRepositorPermission(event nostr.Event, db *sql.DB, cfg bridge.Config) error {
-
-	var perm protocol.RepositoryPermission
-	err := json.Unmarshal([]byte(event.Content), &perm)
-	if err != nil {
-		return fmt.Errorf("malformed permission: %w : %v", err, event.Content)
-	}
-
-	if !bridge.IsValidRepoName(perm.RepositoryName) {
-		return fmt.Errorf("invalid repository name: %v", perm.RepositoryName)
-	}
-
-	updatedAt := event.CreatedAt.Unix()
-	res, err := db.Exec("INSERT INTO RepositoryPermission (OwnerPubKey,RepositoryName,TargetPubKey,Permission,UpdatedAt) VALUES (?,?,?,?,?) ON CONFLICT DO UPDATE SET Permission=?,UpdatedAt=? WHERE UpdatedAt<?;", event.PubKey, perm.RepositoryName, perm.TargetPubKey, perm.Permission, updatedAt, perm.Permission, updatedAt, updatedAt)
-	if err != nil {
-		return fmt.Errorf("insert permission failed: %w", err)
-	}
-
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows affected failed: %w", err)
-	}
-
-	if affected == 1 {
-		log.Println("permission updated", event.Content)
-	}
-
-	return nil
-}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// repoAdopt brings an existing bare repository under the bridge's management:
+// it moves (or links) it into the repository layout, records it in the database and
+// announces it. It must run on the bridge host as the bridge user.
+func repoAdopt(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("repo adopt", flag.ContinueOnError)
+
+	owner := flags.String("owner", "", "owner of the repository as npub, hex or nip05 (default: the cli key)")
+	symlink := flags.Bool("symlink", false, "link the repository into the layout instead of moving it")
+	publicRead := flags.Bool("public-read", true, "repository will be readable by all users")
+	publicWrite := flags.Bool("public-write", false, "repository will be writeable by all users")
+
+	flags.Parse(os.Args[3:])
+
+	if flags.NArg() != 2 {
+		usage("repo adopt")
+	}
+
+	sourcePath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	repoName := flags.Arg(1)
+	if !bridge.IsValidRepoName(repoName) {
+		log.Fatalf("invalid repository name: %v", repoName)
+	}
+
+	myPubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatalf("invalid private key : %v", err)
+	}
+	ownerPubKey := myPubKey
+	if *owner != "" {
+		ownerPubKey, err = gitnostr.ResolveHexPubKey(*owner)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	output, err := exec.Command("git", "--git-dir", sourcePath, "rev-parse", "--is-bare-repository").Output()
+	if err != nil || strings.TrimSpace(string(output)) != "true" {
+		log.Fatalf("%v is not a bare git repository", sourcePath)
+	}
+
+	bridgeCfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(bridgeCfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	var exists int
+	err = db.QueryRow("SELECT COUNT(*) FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName).Scan(&exists)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if exists != 0 {
+		log.Fatalf("repository %v/%v is already known to the bridge", ownerPubKey, repoName)
+	}
+	collision, err := bridge.FindRepoNameCollision(db, bridgeCfg, ownerPubKey, repoName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if collision != "" {
+		log.Fatalf("repository %v differs only in case from existing %v", repoName, collision)
+	}
+
+	repoPath, err := bridgeCfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Lstat(repoPath); err == nil {
+		log.Fatalf("%v already exists", repoPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(repoPath), 0750); err != nil {
+		log.Fatalf("repository path mkdir : %v", err)
+	}
+
+	if *symlink {
+		err = os.Symlink(sourcePath, repoPath)
+	} else {
+		err = os.Rename(sourcePath, repoPath)
+	}
+	if err != nil {
+		log.Fatalf("adopt %v : %v (use --symlink if it is on another filesystem)", sourcePath, err)
+	}
+	fmt.Printf("adopted %v as %v\n", sourcePath, repoPath)
+
+	createdAt := time.Now()
+	_, err = db.Exec("INSERT INTO Repository (OwnerPubKey,RepositoryName,PublicRead,PublicWrite,UpdatedAt) VALUES (?,?,?,?,?);", ownerPubKey, repoName, *publicRead, *publicWrite, createdAt.Unix())
+	if err != nil {
+		log.Fatalf("insert repository failed: %v", err)
+	}
+
+	reposDir, err := gitnostr.ResolvePath(bridgeCfg.RepositoryDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if bridgeCfg.OwnerDirs() {
+		if _, err := bridge.EnsureNpubSymlink(reposDir, ownerPubKey); err != nil {
+			log.Printf("failed to create npub symlink : %v\n", err)
+		}
+	}
+	if bridgeCfg.DumbHttp {
+		if err := bridge.UpdateServerInfo(repoPath); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if ownerPubKey != myPubKey {
+		fmt.Printf("not announcing %v: only its owner %v can publish the announcement\n", repoName, ownerPubKey)
+		return
+	}
+
+	_, ok := publishEvent(pool, &nostr.Event{
+		CreatedAt: createdAt,
+		Kind:      protocol.KindRepositoryNIP34,
+		Tags:      announcementTags(cfg, ownerPubKey, repoName, *publicRead, *publicWrite, ""),
+	}, "repository")
+	if !ok {
+		os.Exit(1)
+	}
+}
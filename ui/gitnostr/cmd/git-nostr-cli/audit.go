@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+)
+
+// audit prints the bridge's audit log, newest first, a page at a time. Like doctor it
+// reads the bridge database, so run it as the bridge user on the bridge host.
+func audit() {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+
+	repo := flags.String("repo", "", "only entries of this repository, as <owner>/<repo> or <repo>")
+	pubKey := flags.String("pubkey", "", "only entries caused by this npub or hex key")
+	since := flags.String("since", "", "only entries after this point: a duration like 72h, a unix timestamp or an RFC 3339 time")
+	verb := flags.String("verb", "", "only entries of this type, e.g. push.received or permission.changed")
+	limit := flags.Int("limit", 50, "entries per page")
+	before := flags.Int64("before", 0, "show the page of entries older than this entry id")
+	asJSON := flags.Bool("json", false, "print one JSON object per line")
+
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 0 || *limit <= 0 {
+		usage("audit")
+	}
+
+	filter := bridge.AuditFilter{Verb: *verb, Before: *before, Limit: *limit}
+	if owner, name, found := strings.Cut(*repo, "/"); found {
+		ownerPubKey, err := gitnostr.DecodePubKey(owner)
+		if err != nil {
+			log.Fatal(err)
+		}
+		filter.Owner = ownerPubKey
+		filter.Repo = name
+	} else {
+		filter.Repo = *repo
+	}
+	if *pubKey != "" {
+		decoded, err := gitnostr.DecodePubKey(*pubKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		filter.PubKey = decoded
+	}
+	if *since != "" {
+		t, err := bridge.ParseSince(*since, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		filter.Since = t.Unix()
+	}
+
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	entries, err := bridge.QueryAudit(db, filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if *asJSON {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(line))
+			continue
+		}
+
+		line := fmt.Sprintf("%6d  %s  %-19s %s/%s", entry.Id, time.Unix(entry.Time, 0).UTC().Format(time.RFC3339), entry.Type, entry.Owner, entry.Repo)
+		if entry.PubKey != "" {
+			line += " by " + entry.PubKey
+		}
+		if entry.EventID != "" {
+			line += " event " + entry.EventID
+		}
+		if len(entry.Data) > 0 {
+			data, _ := json.Marshal(entry.Data)
+			line += " " + string(data)
+		}
+		fmt.Println(line)
+	}
+
+	if len(entries) == *limit && !*asJSON {
+		fmt.Printf("more entries: add --before %d\n", entries[len(entries)-1].Id)
+	} else if len(entries) == 0 && !*asJSON {
+		fmt.Println("no matching entries")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+)
+
+// backup writes a consistent snapshot of the bridge database to a new file while the
+// bridge keeps running. Like doctor it reads the bridge configuration, so run it as
+// the bridge user.
+func backup() {
+	if len(os.Args) != 3 {
+		usage("backup")
+	}
+	dest, err := filepath.Abs(os.Args[2])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stat(dest); !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("%v already exists, choose a new file name", dest)
+	}
+
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = bridge.BackupDb(db, dest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.Chmod(dest, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("backed up %v to %v (%d bytes)\n", cfg.DbFile, dest, info.Size())
+}
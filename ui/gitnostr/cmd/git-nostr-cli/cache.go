@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// eventCacheFile in the config dir keeps the events of recent relay queries, so
+// repeated commands don't wait on the relays again.
+const eventCacheFile = "event-cache.json"
+
+// GetEventCacheTTL returns how long queried events are reused, defaulting to 10m.
+// A negative eventCacheTTL disables the cache.
+func (cfg Config) GetEventCacheTTL() time.Duration {
+	if cfg.EventCacheTTL == 0 {
+		return 10 * time.Minute
+	}
+	return cfg.EventCacheTTL.Duration()
+}
+
+// eventCacheEntry holds every event of one kind by one author a query returned.
+type eventCacheEntry struct {
+	FetchedAt int64         `json:"fetchedAt"`
+	Events    []nostr.Event `json:"events"`
+}
+
+// eventCache is keyed by kind and author. A nil cache stores nothing.
+type eventCache struct {
+	path    string
+	ttl     time.Duration
+	entries map[string]eventCacheEntry
+}
+
+// cache is the event cache of the loaded config, nil if it is disabled.
+var cache *eventCache
+
+// openEventCache loads the event cache of cfg. An unreadable cache file starts an empty cache.
+func openEventCache(cfg Config) *eventCache {
+	ttl := cfg.GetEventCacheTTL()
+	if ttl < 0 {
+		return nil
+	}
+	configDir, err := gitnostr.ResolvePath(cfg.ConfigDir)
+	if err != nil {
+		log.Printf("event cache disabled : %v\n", err)
+		return nil
+	}
+	c := &eventCache{path: filepath.Join(configDir, eventCacheFile), ttl: ttl, entries: map[string]eventCacheEntry{}}
+	data, err := os.ReadFile(c.path)
+	if err == nil {
+		err = json.Unmarshal(data, &c.entries)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("ignoring event cache %v : %v\n", c.path, err)
+		c.entries = map[string]eventCacheEntry{}
+	}
+	return c
+}
+
+func eventCacheKey(kind int, author string) string {
+	return fmt.Sprintf("%d:%s", kind, author)
+}
+
+// get returns the cached events of kind by author if they were fetched less than the TTL ago.
+func (c *eventCache) get(kind int, author string) ([]nostr.Event, bool) {
+	if c == nil {
+		return nil, false
+	}
+	entry, found := c.entries[eventCacheKey(kind, author)]
+	if !found || time.Since(time.Unix(entry.FetchedAt, 0)) >= c.ttl {
+		return nil, false
+	}
+	return entry.Events, true
+}
+
+// put replaces the cached events of kind by author with the result of a fresh query.
+func (c *eventCache) put(kind int, author string, events []nostr.Event) {
+	if c == nil {
+		return
+	}
+	c.entries[eventCacheKey(kind, author)] = eventCacheEntry{FetchedAt: time.Now().Unix(), Events: events}
+	c.save()
+}
+
+// invalidate drops the cached events of kind by author if they were fetched before
+// createdAt, e.g. after this cli published a newer event the relays would return.
+func (c *eventCache) invalidate(kind int, author string, createdAt time.Time) {
+	if c == nil {
+		return
+	}
+	key := eventCacheKey(kind, author)
+	entry, found := c.entries[key]
+	if !found || entry.FetchedAt > createdAt.Unix() {
+		return
+	}
+	delete(c.entries, key)
+	c.save()
+}
+
+// save writes the entries that haven't expired yet. A failure only costs the next
+// command a relay query, so it is logged and otherwise ignored.
+func (c *eventCache) save() {
+	for key, entry := range c.entries {
+		if time.Since(time.Unix(entry.FetchedAt, 0)) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		log.Printf("event cache encode : %v\n", err)
+		return
+	}
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		log.Printf("event cache write : %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		log.Printf("event cache write : %v\n", err)
+		os.Remove(tmpPath)
+	}
+}
+
+// fetchAuthorEvents returns the signed events of kind by author, from the cache
+// unless noCache is set or the cached ones expired, and otherwise from the relays.
+// fromCache tells callers looking for one event that a miss may just be stale.
+func fetchAuthorEvents(pool *nostr.RelayPool, kind int, author string, noCache bool) (events []nostr.Event, fromCache bool) {
+	if !noCache {
+		if events, found := cache.get(kind, author); found {
+			return events, true
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, subchan := pool.Sub(nostr.Filters{{Kinds: []int{kind}, Authors: []string{author}}})
+
+	seen := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			cache.put(kind, author, events)
+			return events, false
+		case message := <-subchan:
+			event := message.Event
+			// Relays may ignore parts of the filter
+			if event.Kind != kind || event.PubKey != author || seen[event.ID] {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			seen[event.ID] = true
+			events = append(events, event)
+		}
+	}
+}
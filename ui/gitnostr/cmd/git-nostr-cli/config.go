@@ -9,13 +9,15 @@ import (
 	"path/filepath"
 
 	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
 )
 
 type Config struct {
-	ConfigDir  string   `json:"-"`
-	Relays     []string `json:"relays"`
-	PrivateKey string   `json:"privateKey"`
-	GitSshBase string   `json:"gitSshBase"`
+	ConfigDir     string          `json:"-"`
+	Relays        []string        `json:"relays"`
+	PrivateKey    string          `json:"privateKey"`
+	GitSshBase    string          `json:"gitSshBase"`
+	EventCacheTTL bridge.Duration `json:"eventCacheTTL,omitempty"` // how long queried events are reused, default 10m, negative disables
 }
 
 func getConfigFilePath(resolvedConfigDir string) string {
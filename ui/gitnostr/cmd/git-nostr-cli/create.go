@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// pushRetries and pushRetryInterval bound how long repoCreateFrom waits for the bridge
+// to create the repository from the announcement before the push can succeed.
+const (
+	pushRetries       = 12
+	pushRetryInterval = 5 * time.Second
+)
+
+// repoCreateFrom publishes the announcement of a new repository, pushes the branches
+// and tags of the local repository at localPath to the bridge and publishes a state
+// event with the pushed refs. Without a defaultBranch the branch HEAD of the local
+// repository points to is announced.
+func repoCreateFrom(cfg Config, pool *nostr.RelayPool, repoName, localPath string, publicRead, publicWrite bool, defaultBranch string, asJSON bool) {
+	if !bridge.IsValidRepoName(repoName) {
+		log.Fatalf("invalid repository name: %v", repoName)
+	}
+	if cfg.GitSshBase == "" {
+		log.Fatal("gitSshBase is not set in the cli config, it is needed to push to the bridge")
+	}
+	localPath, err := filepath.Abs(localPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := exec.Command("git", "-C", localPath, "rev-parse", "--git-dir").Run(); err != nil {
+		log.Fatalf("%v is not a git repository", localPath)
+	}
+	refs, err := forEachRef(localPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(refs) == 0 {
+		log.Fatalf("%v has no branches or tags to push", localPath)
+	}
+
+	pubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatalf("invalid private key : %v", err)
+	}
+
+	output, _ := exec.Command("git", "-C", localPath, "symbolic-ref", "-q", "HEAD").Output()
+	head := strings.TrimSpace(string(output))
+	if defaultBranch == "" {
+		defaultBranch = strings.TrimPrefix(head, "refs/heads/")
+	}
+
+	announcement, ok := publishEvent(pool, &nostr.Event{
+		CreatedAt: time.Now(),
+		Kind:      protocol.KindRepositoryNIP34,
+		Tags:      announcementTags(cfg, pubKey, repoName, publicRead, publicWrite, defaultBranch),
+	}, "repository")
+	if !ok {
+		os.Exit(1)
+	}
+	printPublished(announcement, "repository", asJSON)
+
+	remote := cfg.GitSshBase + ":" + pubKey + "/" + repoName
+	if err := pushToBridge(localPath, remote); err != nil {
+		log.Fatal(err)
+	}
+
+	state, ok := publishEvent(pool, &nostr.Event{
+		CreatedAt: time.Now(),
+		Kind:      protocol.KindRepositoryState,
+		Tags:      stateTags(repoName, refs, head),
+	}, "state")
+	if !ok {
+		os.Exit(1)
+	}
+	printPublished(state, "state", asJSON)
+
+	fmt.Fprintf(progress, "created %v with %d refs from %v\n", remote, len(refs), localPath)
+}
+
+// announcementTags returns the tags of a 30617 announcement of one of pubKey's repositories.
+// A defaultBranch is announced for the bridge to point HEAD of the new empty repository at.
+func announcementTags(cfg Config, pubKey, repoName string, publicRead, publicWrite bool, defaultBranch string) nostr.Tags {
+	tags := nostr.Tags{
+		{"d", repoName},
+		{"name", repoName},
+		{"public-read", strconv.FormatBool(publicRead)},
+		{"public-write", strconv.FormatBool(publicWrite)},
+	}
+	if defaultBranch != "" {
+		tags = append(tags, nostr.Tag{"default-branch", defaultBranch})
+	}
+	if cfg.GitSshBase != "" {
+		tags = append(tags, nostr.Tag{"clone", cfg.GitSshBase + ":" + pubKey + "/" + repoName})
+	}
+	return tags
+}
+
+// stateTags returns the tags of a 30618 state event announcing refs, with HEAD
+// pointing to head if it is one of them.
+func stateTags(repoName string, refs map[string]string, head string) nostr.Tags {
+	names := make([]string, 0, len(refs))
+	for ref := range refs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+
+	tags := nostr.Tags{{"d", repoName}}
+	for _, ref := range names {
+		tags = append(tags, nostr.Tag{ref, refs[ref]})
+	}
+	if _, found := refs[head]; found {
+		tags = append(tags, nostr.Tag{"HEAD", "ref: " + head})
+	}
+	return tags
+}
+
+// pushToBridge pushes the branches and tags of the repository at localPath to remote.
+// The bridge creates the repository only once it has processed the announcement, so
+// a push failing because the repository doesn't exist yet is retried.
+func pushToBridge(localPath, remote string) error {
+	for attempt := 1; ; attempt++ {
+		output, err := exec.Command("git", "-C", localPath, "push", remote, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*").CombinedOutput()
+		if err == nil {
+			progress.Write(output)
+			return nil
+		}
+		notCreated := strings.Contains(string(output), "not found") || strings.Contains(string(output), "still being imported")
+		if !notCreated || attempt == pushRetries {
+			os.Stderr.Write(output)
+			return fmt.Errorf("git push to %v failed : %w", remote, err)
+		}
+		fmt.Fprintf(progress, "waiting for the bridge to create the repository (attempt %d/%d)\n", attempt, pushRetries)
+		time.Sleep(pushRetryInterval)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type doctorCheck struct {
+	name string
+	err  error
+	hint string
+}
+
+// doctor checks a bridge installation and prints a pass/fail checklist.
+// It reads the bridge configuration, not the cli one, so it is meant to be run
+// as the bridge user on the bridge host.
+func doctor() {
+	var checks []doctorCheck
+	add := func(name string, err error, hint string) {
+		checks = append(checks, doctorCheck{name: name, err: err, hint: hint})
+	}
+
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err == nil {
+		err = cfg.ApplyRelayProxy()
+	}
+	add("bridge config loads and validates", err, "edit ~/.config/git-nostr/git-nostr-bridge.json (see docs/STANDALONE_BRIDGE_SETUP.md)")
+	if err != nil {
+		printDoctorChecks(checks)
+		os.Exit(1)
+	}
+
+	db, err := bridge.OpenDb(cfg.DbFile)
+	add("database opens", err, "check that DbFile points to a writable location")
+	if err == nil {
+		add("database schema is complete", checkSchema(db), "remove the database file and restart git-nostr-bridge to recreate it")
+		db.Close()
+	}
+
+	add("repositoryDir exists and is writable", checkRepositoryDir(cfg.RepositoryDir), "create the directory and make it owned by the bridge user")
+
+	version, err := bridge.DetectGitVersion()
+	if err == nil && !version.AtLeast(bridge.MinGitVersion) {
+		err = fmt.Errorf("git %v is older than %v", version, bridge.MinGitVersion)
+	}
+	add("git is installed and supported", err, fmt.Sprintf("install git %v or newer and make sure it is on PATH", bridge.MinGitVersion))
+
+	for _, relay := range cfg.RelayURLs() {
+		add("relay "+relay+" is reachable", checkRelay(relay), "check the relay URL and outbound network access")
+	}
+
+	if cfg.GetAuthorizedKeysMode() == bridge.AuthorizedKeysModeFile {
+		add("ssh authorized_keys is sane", checkAuthorizedKeys(), "run git-nostr-bridge once as the git-nostr user to rewrite ~/.ssh/authorized_keys")
+	}
+
+	printDoctorChecks(checks)
+	for _, check := range checks {
+		if check.err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+func printDoctorChecks(checks []doctorCheck) {
+	for _, check := range checks {
+		if check.err == nil {
+			fmt.Printf("[PASS] %s\n", check.name)
+		} else {
+			fmt.Printf("[FAIL] %s: %v\n", check.name, check.err)
+			fmt.Printf("       hint: %s\n", check.hint)
+		}
+	}
+}
+
+func checkSchema(db *sql.DB) error {
+	var missing []string
+	for _, table := range bridge.SchemaTables {
+		var name string
+		err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&name)
+		if err != nil {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing tables: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkRepositoryDir(repositoryDir string) error {
+	reposDir, err := gitnostr.ResolvePath(repositoryDir)
+	if err != nil {
+		return err
+	}
+
+	st, err := os.Stat(reposDir)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("%v is not a directory", reposDir)
+	}
+
+	probe, err := os.CreateTemp(reposDir, ".doctor-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func checkRelay(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay, err := nostr.RelayConnectContext(ctx, url)
+	if err != nil {
+		return err
+	}
+	return relay.Close()
+}
+
+func checkAuthorizedKeys() error {
+	sshDir, err := gitnostr.ResolvePath("~/.ssh")
+	if err != nil {
+		return err
+	}
+
+	st, err := os.Stat(sshDir)
+	if err != nil {
+		return err
+	}
+	if st.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%v is group or world writable, sshd will ignore it", sshDir)
+	}
+
+	f, err := os.Open(filepath.Join(sshDir, "authorized_keys"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "command=\"") {
+			continue
+		}
+		command := strings.SplitN(strings.TrimPrefix(line, "command=\""), "\"", 2)[0]
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return fmt.Errorf("empty forced command in authorized_keys")
+		}
+		exe := fields[0]
+		if _, err := exec.LookPath(exe); err != nil {
+			return fmt.Errorf("forced command %v is not executable: %w", exe, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+)
+
+// failed lists the events the bridge failed to process, most recent failure first,
+// and with --retry asks the bridge to process them again. Like audit it reads the
+// bridge database, so run it as the bridge user on the bridge host.
+func failed() {
+	flags := flag.NewFlagSet("failed", flag.ContinueOnError)
+
+	retry := flags.Bool("retry", false, "have the bridge process the failed events again, or only the given one")
+	limit := flags.Int("limit", 50, "events to list")
+	asJSON := flags.Bool("json", false, "print one JSON object per line, with the raw event")
+
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() > 1 || (flags.NArg() == 1 && !*retry) || *limit <= 0 {
+		usage("failed")
+	}
+
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if *retry {
+		requested, err := bridge.RequestFailedEventRetries(db, flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if requested == 0 {
+			fmt.Printf("nothing to retry; events retried %d times are given up on\n", bridge.MaxFailedEventRetries)
+			os.Exit(1)
+		}
+		fmt.Printf("queued %d events for retry, the bridge processes them within 30 seconds\n", requested)
+		return
+	}
+
+	events, err := bridge.ListFailedEvents(db, *limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, event := range events {
+		if *asJSON {
+			line, err := json.Marshal(event)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(line))
+			continue
+		}
+
+		retries := fmt.Sprintf("%d/%d retries", event.Retries, bridge.MaxFailedEventRetries)
+		if event.RetryRequested {
+			retries += ", retry queued"
+		}
+		fmt.Printf("%s  kind %-5d %s by %s (%s)\n    %s\n", time.Unix(event.LastFailedAt, 0).UTC().Format(time.RFC3339), event.Kind, event.EventId, event.PubKey, retries, event.Error)
+	}
+	if len(events) == 0 && !*asJSON {
+		fmt.Println("no failed events")
+	}
+}
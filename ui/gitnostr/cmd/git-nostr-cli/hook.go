@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// repoHook publishes the post-receive hook URL of one of the cli key's repositories.
+// Without a url the hook is removed.
+func repoHook(cfg Config, pool *nostr.RelayPool) {
+	if len(os.Args) != 4 && len(os.Args) != 5 {
+		usage("repo hook")
+	}
+
+	hook := protocol.RepositoryHook{RepositoryName: os.Args[3]}
+	if len(os.Args) == 5 {
+		hook.Url = os.Args[4]
+	}
+	if !bridge.IsValidRepoName(hook.RepositoryName) {
+		log.Fatalf("invalid repository name: %v", hook.RepositoryName)
+	}
+	if hook.Url != "" {
+		if err := bridge.ValidateHookURL(hook.Url); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	hookJson, err := json.Marshal(hook)
+	if err != nil {
+		log.Fatal("hook marshal :", err)
+	}
+
+	_, ok := publishEvent(pool, &nostr.Event{
+		CreatedAt: time.Now(),
+		Kind:      protocol.KindRepositoryHook,
+		Content:   string(hookJson),
+	}, "hook")
+	if !ok {
+		os.Exit(1)
+	}
+}
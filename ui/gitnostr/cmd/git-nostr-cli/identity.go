@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// identitySet publishes the git author emails used by the cli key, replacing any
+// previously published list. Commits authored as <npub>@gittr need no mapping.
+func identitySet(cfg Config, pool *nostr.RelayPool) {
+
+	emails := os.Args[3:]
+	for _, email := range emails {
+		if !strings.Contains(email, "@") {
+			log.Fatalf("invalid email %v", email)
+		}
+	}
+
+	content, err := json.Marshal(protocol.GitIdentity{Emails: emails})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, ok := publishEvent(pool, &nostr.Event{
+		CreatedAt: time.Now(),
+		Kind:      protocol.KindGitIdentity,
+		Content:   string(content),
+	}, "git identity")
+	if !ok {
+		os.Exit(1)
+	}
+
+	pubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	npub, err := nip19.EncodePublicKey(pubKey, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("tip: commits authored as %s@gittr are attributed to you without a mapping.\n", npub)
+}
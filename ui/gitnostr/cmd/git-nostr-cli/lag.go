@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+)
+
+// lagKindNames describes the events behind each Since marker; several kinds share
+// the marker of the subscription they arrive in.
+var lagKindNames = map[int]string{
+	protocol.KindRepository:      "repositories, permissions, groups, hooks",
+	protocol.KindRepositoryNIP34: "NIP-34 announcements",
+	protocol.KindRepositoryState: "repository states",
+	protocol.KindSshKey:          "ssh keys, git identities",
+}
+
+// kindLag is how far the bridge is behind on one kind.
+type kindLag struct {
+	Kind        int    `json:"kind"`
+	Name        string `json:"name"`
+	LastEventAt int64  `json:"lastEventAt"`          // created_at of the newest processed event, 0 for none
+	LagSeconds  int64  `json:"lagSeconds,omitempty"` // how long ago that was
+	Lagging     bool   `json:"lagging"`
+}
+
+// lag reports per kind how old the newest event the bridge processed is, and flags
+// kinds older than --threshold. A kind nobody published to lately looks lagging as
+// well. Like audit it reads the bridge database, so run it as the bridge user.
+func lag() {
+	flags := flag.NewFlagSet("lag", flag.ContinueOnError)
+
+	threshold := flags.Duration("threshold", time.Hour, "flag kinds whose newest processed event is older than this")
+	asJSON := flags.Bool("json", false, "print the results as JSON")
+
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 0 || *threshold <= 0 {
+		usage("lag")
+	}
+
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	markers, err := bridge.ListSince(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	now := time.Now()
+	var results []kindLag
+	lagging := false
+	for _, marker := range markers {
+		result := kindLag{Kind: marker.Kind, Name: lagKindNames[marker.Kind], LastEventAt: marker.UpdatedAt, Lagging: true}
+		if marker.UpdatedAt > 0 {
+			age := now.Sub(time.Unix(marker.UpdatedAt, 0))
+			if age < 0 {
+				age = 0
+			}
+			result.LagSeconds = int64(age.Seconds())
+			result.Lagging = age > *threshold
+		}
+		if result.Lagging {
+			lagging = true
+		}
+		results = append(results, result)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, result := range results {
+			status := "[OK] "
+			if result.Lagging {
+				status = "[LAG]"
+			}
+			if result.LastEventAt == 0 {
+				fmt.Printf("%s kind %-5d %-42s no event processed yet\n", status, result.Kind, result.Name)
+				continue
+			}
+			lastEventAt := time.Unix(result.LastEventAt, 0).UTC().Format(time.RFC3339)
+			behind := (time.Duration(result.LagSeconds) * time.Second).String()
+			fmt.Printf("%s kind %-5d %-42s last event %s, %s behind\n", status, result.Kind, result.Name, lastEventAt, behind)
+		}
+	}
+	if lagging {
+		os.Exit(1)
+	}
+}
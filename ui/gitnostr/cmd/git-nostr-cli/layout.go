@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+)
+
+// layoutMigrate moves every repository of the bridge database from the configured
+// pathLayout to another one. It lists the moves and only makes them with --yes; the
+// bridge must be stopped meanwhile and pathLayout changed before it is started again.
+func layoutMigrate() {
+	flags := flag.NewFlagSet("layout migrate", flag.ContinueOnError)
+
+	yes := flags.Bool("yes", false, "move the repositories instead of listing the moves")
+
+	if err := flags.Parse(os.Args[3:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 1 {
+		usage("layout migrate")
+	}
+	target := flags.Arg(0)
+
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := bridge.LookupPathLayout(target); err != nil {
+		log.Fatal(err)
+	}
+	if target == cfg.GetPathLayout() {
+		fmt.Printf("pathLayout is already %s, nothing to move\n", target)
+		return
+	}
+	targetCfg := cfg
+	targetCfg.PathLayout = target
+
+	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT OwnerPubKey,RepositoryName FROM Repository ORDER BY OwnerPubKey,RepositoryName")
+	if err != nil {
+		log.Fatal(err)
+	}
+	type move struct{ owner, oldPath, newPath string }
+	var moves []move
+	for rows.Next() {
+		var owner, repoName string
+		if err := rows.Scan(&owner, &repoName); err != nil {
+			log.Fatal(err)
+		}
+		oldPath, err := cfg.RepoPath(owner, repoName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		newPath, err := targetCfg.RepoPath(owner, repoName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(oldPath); err != nil {
+			fmt.Printf("skip %s/%s, it has no directory at %s\n", owner, repoName, oldPath)
+			continue
+		}
+		if _, err := os.Lstat(newPath); err == nil {
+			log.Fatalf("%s already exists, move it out of the way first", newPath)
+		}
+		moves = append(moves, move{owner, oldPath, newPath})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, m := range moves {
+		fmt.Printf("%s -> %s\n", m.oldPath, m.newPath)
+	}
+	if len(moves) == 0 {
+		fmt.Println("no repositories to move")
+	} else if !*yes {
+		fmt.Printf("%d repositories would move to the %s layout; stop the bridge and rerun with --yes\n", len(moves), target)
+		os.Exit(1)
+	}
+
+	oldDirs := map[string]bool{}
+	owners := map[string]bool{}
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.newPath), 0750); err != nil {
+			log.Fatalf("repository path mkdir : %v", err)
+		}
+		if err := os.Rename(m.oldPath, m.newPath); err != nil {
+			log.Fatalf("move %s : %v", m.oldPath, err)
+		}
+		oldDirs[filepath.Dir(m.oldPath)] = true
+		owners[m.owner] = true
+	}
+
+	// Drop the owner and shard directories the old layout leaves empty, and the npub
+	// symlinks pointing at them
+	for dir := range oldDirs {
+		for dir != reposDir && strings.HasPrefix(dir, reposDir+string(filepath.Separator)) {
+			if os.Remove(dir) != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+	if !targetCfg.OwnerDirs() {
+		entries, err := os.ReadDir(reposDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, entry := range entries {
+			link := filepath.Join(reposDir, entry.Name())
+			if entry.Type()&os.ModeSymlink == 0 || !strings.HasPrefix(entry.Name(), "npub1") {
+				continue
+			}
+			if _, err := os.Stat(link); os.IsNotExist(err) {
+				os.Remove(link)
+			}
+		}
+	} else {
+		for owner := range owners {
+			if _, err := bridge.EnsureNpubSymlink(reposDir, owner); err != nil {
+				log.Printf("failed to create npub symlink : %v\n", err)
+			}
+		}
+	}
+
+	fmt.Printf("moved %d repositories, set \"pathLayout\": %q in git-nostr-bridge.json before starting the bridge\n", len(moves), target)
+}
@@ -68,11 +68,64 @@ func main() {
 		os.Exit(0)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		doctor()
+		os.Exit(0)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		backup()
+		os.Exit(0)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		audit()
+		os.Exit(0)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "failed" {
+		failed()
+		os.Exit(0)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lag" {
+		lag()
+		os.Exit(0)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "layout" {
+		if len(os.Args) < 3 || os.Args[2] != "migrate" {
+			usage("layout")
+		}
+		layoutMigrate()
+		os.Exit(0)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "relay" {
+		if len(os.Args) < 3 || os.Args[2] != "check" {
+			usage("relay")
+		}
+		relayCheck()
+		os.Exit(0)
+	}
+
+	if len(os.Args) < 2 {
+		usage("")
+	}
+	switch os.Args[1] {
+	case "repo", "identity", "ssh-key", "state", "migrate":
+		if len(os.Args) < 3 {
+			usage(os.Args[1])
+		}
+	}
+
 	cfg, err := LoadConfig("~/.config/git-nostr")
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	cache = openEventCache(cfg)
+
 	pool, err := connectNostr(cfg.Relays)
 	if err != nil {
 		log.Fatal(err)
@@ -93,8 +146,28 @@ func main() {
 			repoClone(cfg, pool)
 		case "permission":
 			repoPermission(cfg, pool)
+		case "apply-patch":
+			repoApplyPatch(cfg, pool)
+		case "adopt":
+			repoAdopt(cfg, pool)
+		case "rehome":
+			repoRehome(cfg, pool)
+		case "hook":
+			repoHook(cfg, pool)
+		case "verify":
+			repoVerify(cfg, pool)
+		default:
+			log.Printf("unknown repo sub command %v", subcmd)
+			usage("repo")
+		}
+	case "identity":
+		subcmd := os.Args[2]
+		switch subcmd {
+		case "set":
+			identitySet(cfg, pool)
 		default:
-			log.Fatalf("unknown repo sub command %v", subcmd)
+			log.Printf("unknown identity sub command %v", subcmd)
+			usage("identity")
 		}
 	case "ssh-key":
 		subcmd := os.Args[2]
@@ -102,9 +175,29 @@ func main() {
 		case "add":
 			sshKeyAdd(cfg, pool)
 		default:
-			log.Fatalf("unknown repo sub command %v", subcmd)
+			log.Printf("unknown ssh-key sub command %v", subcmd)
+			usage("ssh-key")
+		}
+	case "state":
+		subcmd := os.Args[2]
+		switch subcmd {
+		case "publish":
+			statePublish(cfg, pool)
+		default:
+			log.Printf("unknown state sub command %v", subcmd)
+			usage("state")
+		}
+	case "migrate":
+		subcmd := os.Args[2]
+		switch subcmd {
+		case "nip34":
+			migrateNip34(cfg, pool)
+		default:
+			log.Printf("unknown migrate sub command %v", subcmd)
+			usage("migrate")
 		}
 	default:
-		log.Fatalf("unknown command %v", cmd)
+		log.Printf("unknown command %v", cmd)
+		usage("")
 	}
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// migrateNip34 announces every legacy kind 51 repository of an owner again as a NIP-34
+// 30617 announcement with the same visibility, default branch and clone URL, and with
+// --state a 30618 state event of the refs the bridge serves. Repositories that already
+// have a 30617 announcement, or a state event, are skipped, so it can be rerun until
+// every repository is migrated.
+func migrateNip34(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("migrate nip34", flag.ContinueOnError)
+
+	owner := flags.String("owner", "", "owner whose repositories to migrate (hex or npub), the cli key's by default")
+	withState := flags.Bool("state", false, "also publish a state event of the refs served at gitSshBase")
+	dryRun := flags.Bool("dry-run", false, "list what would be published without publishing")
+
+	flags.Parse(os.Args[3:])
+
+	if flags.NArg() != 0 {
+		usage("migrate nip34")
+	}
+
+	cliPubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatalf("invalid private key : %v", err)
+	}
+	ownerPubKey := cliPubKey
+	if *owner != "" {
+		ownerPubKey, err = gitnostr.ResolveHexPubKey(*owner)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// The announcements must be signed by the owner
+	if ownerPubKey != cliPubKey && !*dryRun {
+		log.Fatalf("%v is not the cli key's owner; configure its key in git-nostr-cli.json, or add --dry-run to list its repositories", ownerPubKey)
+	}
+	if *withState && cfg.GitSshBase == "" {
+		log.Fatal("gitSshBase is not set in the cli config, it is needed to read the refs for --state")
+	}
+
+	legacy := fetchLegacyRepositories(pool, ownerPubKey)
+	if len(legacy) == 0 {
+		fmt.Printf("%v has no legacy kind %d repositories\n", ownerPubKey, protocol.KindRepository)
+		return
+	}
+	announcements := fetchAnnouncements(pool, ownerPubKey)
+	var states map[string]nostr.Event
+	if *withState {
+		states = fetchAddressable(pool, protocol.KindRepositoryState, ownerPubKey)
+	}
+
+	names := make([]string, 0, len(legacy))
+	for name := range legacy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failed := 0
+	for _, name := range names {
+		repo := legacy[name]
+		if repo.Deleted {
+			fmt.Printf("%-30s skipped, deleted\n", name)
+			continue
+		}
+		if !bridge.IsValidRepoName(name) {
+			fmt.Printf("%-30s skipped, invalid repository name\n", name)
+			continue
+		}
+
+		announced := announcements[name].ID != ""
+		stated := !*withState || states[name].ID != ""
+		if announced && stated {
+			fmt.Printf("%-30s skipped, already migrated\n", name)
+			continue
+		}
+		if *dryRun {
+			if !announced {
+				fmt.Printf("%-30s would announce as kind %d\n", name, protocol.KindRepositoryNIP34)
+			}
+			if !stated {
+				fmt.Printf("%-30s would publish a state event\n", name)
+			}
+			continue
+		}
+
+		if !announced {
+			_, ok := publishEvent(pool, &nostr.Event{
+				CreatedAt: time.Now(),
+				Kind:      protocol.KindRepositoryNIP34,
+				Tags:      legacyAnnouncementTags(cfg, ownerPubKey, repo),
+			}, "announcement of "+name)
+			if !ok {
+				fmt.Printf("%-30s failed, the announcement was not published\n", name)
+				failed++
+				continue
+			}
+		}
+
+		if !stated {
+			refs, head, err := remoteRefs(cfg.GitSshBase + ":" + ownerPubKey + "/" + name)
+			if err != nil || len(refs) == 0 {
+				fmt.Printf("%-30s announced, no refs to publish a state event of: %v\n", name, err)
+				failed++
+				continue
+			}
+			_, ok := publishEvent(pool, &nostr.Event{
+				CreatedAt: time.Now(),
+				Kind:      protocol.KindRepositoryState,
+				Tags:      stateTags(name, refs, head),
+			}, "state of "+name)
+			if !ok {
+				fmt.Printf("%-30s announced, the state event was not published\n", name)
+				failed++
+				continue
+			}
+		}
+		fmt.Printf("%-30s migrated\n", name)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d repositories were not fully migrated, run the command again to retry them\n", failed)
+		os.Exit(1)
+	}
+}
+
+// legacyAnnouncementTags returns the 30617 tags equivalent to a legacy repository. The
+// clone URL uses the gitSshBase the legacy event named, falling back to the cli config's.
+func legacyAnnouncementTags(cfg Config, ownerPubKey string, repo protocol.Repository) nostr.Tags {
+	if repo.GitSshBase != "" {
+		cfg.GitSshBase = repo.GitSshBase
+	}
+	tags := announcementTags(cfg, ownerPubKey, repo.RepositoryName, repo.PublicRead, repo.PublicWrite, repo.DefaultBranch)
+	if len(repo.PublicWriteRefs) > 0 {
+		tags = append(tags, append(nostr.Tag{"public-write-refs"}, repo.PublicWriteRefs...))
+	}
+	if repo.Archived {
+		tags = append(tags, nostr.Tag{"archived", "true"})
+	}
+	return tags
+}
+
+// fetchLegacyRepositories returns the newest legacy kind 51 event of each of the
+// owner's repositories, by the repository name in its content.
+func fetchLegacyRepositories(pool *nostr.RelayPool, ownerPubKey string) map[string]protocol.Repository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, subchan := pool.Sub(nostr.Filters{{Kinds: []int{protocol.KindRepository}, Authors: []string{ownerPubKey}}})
+
+	repos := make(map[string]protocol.Repository)
+	newest := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return repos
+		case message := <-subchan:
+			event := message.Event
+			if event.PubKey != ownerPubKey || event.Kind != protocol.KindRepository {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			var repo protocol.Repository
+			if err := json.Unmarshal([]byte(event.Content), &repo); err != nil || repo.RepositoryName == "" {
+				continue
+			}
+			if at, found := newest[repo.RepositoryName]; !found || event.CreatedAt.After(at) {
+				repos[repo.RepositoryName] = repo
+				newest[repo.RepositoryName] = event.CreatedAt
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// repoApplyPatch applies a NIP-34 patch event to a branch of a repository hosted
+// by the local bridge. It must run on the bridge host as the bridge user, and the
+// cli key must have write access to the repository.
+func repoApplyPatch(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("repo apply-patch", flag.ContinueOnError)
+
+	branch := flags.String("branch", "", "branch to apply the patch to (default: the branch HEAD points to)")
+	publishStatus := flags.Bool("publish-status", false, "publish a NIP-34 applied status event on success")
+
+	flags.Parse(os.Args[3:])
+
+	if flags.NArg() != 2 {
+		usage("repo apply-patch")
+	}
+
+	ownerParam, repoName, err := parseRepoParam(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ownerPubKey, err := gitnostr.ResolveHexPubKey(ownerParam)
+	if err != nil {
+		log.Fatal(err)
+	}
+	patchID := flags.Arg(1)
+
+	myPubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatalf("invalid private key : %v", err)
+	}
+
+	bridgeCfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(bridgeCfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	access, err := bridge.ResolveAccess(db, ownerPubKey, repoName, myPubKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if access < bridge.AccessWrite {
+		log.Fatalf("permission denied: %v has %v access to %v/%v, write is required", myPubKey, access, ownerPubKey, repoName)
+	}
+
+	repoPath, err := bridgeCfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	patch, err := fetchPatch(pool, patchID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ref := "refs/heads/" + *branch
+	if *branch == "" {
+		output, err := exec.Command("git", "--git-dir", repoPath, "symbolic-ref", "HEAD").Output()
+		if err != nil {
+			log.Fatalf("resolve HEAD : %v", err)
+		}
+		ref = strings.TrimSpace(string(output))
+	}
+
+	unlock, err := bridge.LockRepoShared(repoPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	commit, err := applyPatch(repoPath, ref, patch.Content, myPubKey)
+	unlock()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("applied patch %v to %v, now at %v\n", patchID, ref, commit)
+
+	if *publishStatus {
+		_, ok := publishEvent(pool, &nostr.Event{
+			CreatedAt: time.Now(),
+			Kind:      protocol.KindStatusApplied,
+			Tags: nostr.Tags{
+				{"e", patch.ID, "", "root"},
+				{"p", patch.PubKey},
+				{"a", protocol.Address{Kind: protocol.KindRepositoryNIP34, PubKey: ownerPubKey, Identifier: repoName}.String()},
+				{"applied-as-commits", commit},
+			},
+		}, "status")
+		if !ok {
+			os.Exit(1)
+		}
+	}
+}
+
+func fetchPatch(pool *nostr.RelayPool, patchID string) (nostr.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, subchan := pool.Sub(nostr.Filters{{IDs: []string{patchID}, Kinds: []int{protocol.KindPatch}}})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nostr.Event{}, fmt.Errorf("patch %v not found on relays", patchID)
+		case message := <-subchan:
+			event := message.Event
+			if event.ID != patchID {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			return event, nil
+		}
+	}
+}
+
+// applyPatch runs git am in a temporary worktree of the bare repository and
+// moves ref to the result. The ref is only updated if it didn't move meanwhile.
+func applyPatch(repoPath, ref, patch, committerPubKey string) (string, error) {
+	output, err := exec.Command("git", "--git-dir", repoPath, "rev-parse", "--verify", ref).Output()
+	if err != nil {
+		return "", fmt.Errorf("%v does not exist in %v", ref, repoPath)
+	}
+	oldCommit := strings.TrimSpace(string(output))
+
+	tmpDir, err := os.MkdirTemp("", "gn-apply-patch-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	worktree := filepath.Join(tmpDir, "worktree")
+
+	output, err = exec.Command("git", "--git-dir", repoPath, "worktree", "add", "--detach", worktree, oldCommit).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git worktree add failed: %w: %s", err, output)
+	}
+	defer exec.Command("git", "--git-dir", repoPath, "worktree", "remove", "--force", worktree).Run()
+
+	npub, err := nip19.EncodePublicKey(committerPubKey, "")
+	if err != nil {
+		return "", err
+	}
+
+	am := exec.Command("git", "-C", worktree, "am", "--3way")
+	am.Stdin = strings.NewReader(patch)
+	am.Env = append(os.Environ(), "GIT_COMMITTER_NAME="+npub, "GIT_COMMITTER_EMAIL="+npub+"@gittr")
+	output, err = am.CombinedOutput()
+	if err != nil {
+		exec.Command("git", "-C", worktree, "am", "--abort").Run()
+		return "", fmt.Errorf("patch does not apply cleanly to %v:\n%s", ref, output)
+	}
+
+	output, err = exec.Command("git", "-C", worktree, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse failed: %w", err)
+	}
+	newCommit := strings.TrimSpace(string(output))
+
+	output, err = exec.Command("git", "--git-dir", repoPath, "update-ref", ref, newCommit, oldCommit).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git update-ref failed (did %v move?): %w: %s", ref, err, output)
+	}
+
+	return newCommit, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// progress receives the per-relay results of publishEvent. Commands run with --json
+// point it at stderr so stdout only carries the JSON.
+var progress io.Writer = os.Stdout
+
+// publishEvent signs and publishes event to the pool and reports per-relay results.
+// what names the event in the output, e.g. "status". It returns false if no relay accepted it.
+func publishEvent(pool *nostr.RelayPool, event *nostr.Event, what string) (*nostr.Event, bool) {
+	published, statuses, err := pool.PublishEvent(event)
+	if err != nil {
+		fmt.Fprintf(progress, "failed to publish %s: %v\n", what, err)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	publishSuccess := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			if !publishSuccess {
+				fmt.Fprintf(progress, "%s was not published\n", what)
+			} else {
+				cache.invalidate(published.Kind, published.PubKey, published.CreatedAt)
+			}
+			return published, publishSuccess
+		case status := <-statuses:
+			switch status.Status {
+			case nostr.PublishStatusSent, nostr.PublishStatusSucceeded:
+				publishSuccess = true
+				fmt.Fprintf(progress, "published %s to '%s'.\n", what, status.Relay)
+			case nostr.PublishStatusFailed:
+				fmt.Fprintf(progress, "failed to publish %s to '%s'.\n", what, status.Relay)
+			}
+		}
+	}
+}
+
+// publishedEvent is what --json prints for every event a command published.
+type publishedEvent struct {
+	What       string `json:"what"`
+	Id         string `json:"id"`
+	Kind       int    `json:"kind"`
+	Coordinate string `json:"coordinate,omitempty"`
+}
+
+// printPublished prints the id of a published event and, for parameterized
+// replaceable events like 30617 announcements, the "a" coordinate that references
+// it. With asJSON it prints one JSON object per line instead.
+func printPublished(event *nostr.Event, what string, asJSON bool) {
+	result := publishedEvent{What: what, Id: event.ID, Kind: event.Kind}
+	if event.Kind >= 30000 && event.Kind < 40000 {
+		if d := event.Tags.GetFirst([]string{"d", ""}); d != nil {
+			result.Coordinate = protocol.Address{Kind: event.Kind, PubKey: event.PubKey, Identifier: d.Value()}.String()
+		}
+	}
+
+	if asJSON {
+		json.NewEncoder(os.Stdout).Encode(result)
+		return
+	}
+	fmt.Printf("%s event id: %s\n", what, result.Id)
+	if result.Coordinate != "" {
+		fmt.Printf("%s coordinate: %s\n", what, result.Coordinate)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// repoRehome moves all repositories of an old owner key to the cli key after a key
+// rotation. Knowing both private keys proves control of both identities. It must
+// run on the bridge host as the bridge user.
+func repoRehome(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("repo rehome", flag.ContinueOnError)
+
+	oldKeyFile := flags.String("old-key-file", "", "file containing the old private key (hex or nsec)")
+
+	flags.Parse(os.Args[3:])
+
+	if *oldKeyFile == "" || flags.NArg() != 0 {
+		usage("repo rehome")
+	}
+
+	content, err := os.ReadFile(*oldKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	oldPrivateKey, err := gitnostr.DecodePrivateKey(string(content))
+	if err != nil {
+		log.Fatalf("old key : %v", err)
+	}
+	oldPubKey, err := nostr.GetPublicKey(oldPrivateKey)
+	if err != nil {
+		log.Fatalf("old key : %v", err)
+	}
+	newPubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatalf("invalid private key : %v", err)
+	}
+	if oldPubKey == newPubKey {
+		log.Fatal("the old key is the cli key, nothing to do")
+	}
+
+	bridgeCfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := bridge.OpenDb(bridgeCfg.DbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	reposDir, err := gitnostr.ResolvePath(bridgeCfg.RepositoryDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT RepositoryName FROM Repository WHERE OwnerPubKey=? ORDER BY RepositoryName", oldPubKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var repoNames []string
+	for rows.Next() {
+		var repoName string
+		if err := rows.Scan(&repoName); err != nil {
+			log.Fatal(err)
+		}
+		repoNames = append(repoNames, repoName)
+	}
+	rows.Close()
+	if len(repoNames) == 0 {
+		log.Fatalf("%v owns no repositories on this bridge", oldPubKey)
+	}
+
+	// Refuse before touching anything if a name is taken under the new key.
+	for _, repoName := range repoNames {
+		var exists int
+		err := db.QueryRow("SELECT COUNT(*) FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", newPubKey, repoName).Scan(&exists)
+		if err != nil {
+			log.Fatal(err)
+		}
+		newPath, err := bridgeCfg.RepoPath(newPubKey, repoName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Lstat(newPath); exists != 0 || err == nil {
+			log.Fatalf("%v already has a repository %v", newPubKey, repoName)
+		}
+	}
+
+	// Resolved before moving anything, the nested layout finds the owner directory on disk
+	oldDir := ""
+	if bridgeCfg.OwnerDirs() {
+		oldDir, err = bridge.ResolveOwnerDir(reposDir, oldPubKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	type move struct{ oldPath, newPath string }
+	var moves []move
+	for _, repoName := range repoNames {
+		oldPath, err := bridgeCfg.RepoPath(oldPubKey, repoName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		newPath, err := bridgeCfg.RepoPath(newPubKey, repoName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(oldPath); err != nil {
+			log.Printf("%v has no directory, moving its database rows only\n", repoName)
+			continue
+		}
+		moves = append(moves, move{oldPath, newPath})
+	}
+
+	var moved []move
+	undo := func() {
+		for _, m := range moved {
+			if err := os.Rename(m.newPath, m.oldPath); err != nil {
+				log.Printf("failed to move %v back : %v\n", m.newPath, err)
+			}
+		}
+	}
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.newPath), 0750); err != nil {
+			undo()
+			log.Fatalf("repository path mkdir : %v", err)
+		}
+		if err := os.Rename(m.oldPath, m.newPath); err != nil {
+			undo()
+			log.Fatalf("move %v : %v", m.oldPath, err)
+		}
+		moved = append(moved, m)
+	}
+
+	if err := bridge.RehomeOwner(db, oldPubKey, newPubKey); err != nil {
+		undo()
+		log.Fatal(err)
+	}
+	fmt.Printf("moved %d repositories from %v to %v\n", len(repoNames), oldPubKey, newPubKey)
+
+	if bridgeCfg.OwnerDirs() {
+		if _, err := bridge.EnsureNpubSymlink(reposDir, newPubKey); err != nil {
+			log.Printf("failed to create npub symlink : %v\n", err)
+		}
+		if err := os.Remove(oldDir); err == nil {
+			if oldNpub, err := nip19.EncodePublicKey(oldPubKey, ""); err == nil {
+				os.Remove(filepath.Join(reposDir, oldNpub))
+			}
+		}
+	}
+
+	if len(bridgeCfg.GitRepoOwners) > 0 {
+		listed := false
+		for _, owner := range bridgeCfg.GitRepoOwners {
+			listed = listed || owner == newPubKey
+		}
+		if !listed {
+			fmt.Printf("add %v to gitRepoOwners, or the bridge ignores its announcements\n", newPubKey)
+		}
+	}
+
+	// Announce each repository under the new key, then replace the old announcement
+	// with a deleted one so the old coordinate doesn't bring the repository back.
+	announcements := fetchAnnouncements(pool, oldPubKey)
+	var failed []string
+	for _, repoName := range repoNames {
+		tags := rehomeAnnouncementTags(db, announcements[repoName], oldPubKey, newPubKey, repoName, cfg.GitSshBase)
+		_, ok := publishEvent(pool, &nostr.Event{
+			CreatedAt: time.Now(),
+			Kind:      protocol.KindRepositoryNIP34,
+			Tags:      tags,
+		}, "announcement of "+repoName)
+		if !ok {
+			failed = append(failed, repoName)
+			continue
+		}
+
+		retired := nostr.Event{
+			PubKey:    oldPubKey,
+			CreatedAt: time.Now(),
+			Kind:      protocol.KindRepositoryNIP34,
+			Tags:      nostr.Tags{{"d", repoName}, {"deleted", "true"}},
+		}
+		if err := retired.Sign(oldPrivateKey); err != nil {
+			log.Fatalf("sign old announcement : %v", err)
+		}
+		publishEvent(pool, &retired, "retired old announcement of "+repoName)
+	}
+	if len(failed) > 0 {
+		fmt.Printf("the announcements of %v were not published; the repositories are moved, announce them with the new key once the relays are reachable\n", strings.Join(failed, ", "))
+		os.Exit(1)
+	}
+}
+
+// fetchAnnouncements returns the newest 30617 announcement of each of the owner's repositories.
+func fetchAnnouncements(pool *nostr.RelayPool, ownerPubKey string) map[string]nostr.Event {
+	return fetchAddressable(pool, protocol.KindRepositoryNIP34, ownerPubKey)
+}
+
+// fetchAddressable returns the owner's newest event of kind for each "d" tag, e.g.
+// the 30618 state event of each repository.
+func fetchAddressable(pool *nostr.RelayPool, kind int, ownerPubKey string) map[string]nostr.Event {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, subchan := pool.Sub(nostr.Filters{{Kinds: []int{kind}, Authors: []string{ownerPubKey}}})
+
+	announcements := make(map[string]nostr.Event)
+	for {
+		select {
+		case <-ctx.Done():
+			return announcements
+		case message := <-subchan:
+			event := message.Event
+			if event.PubKey != ownerPubKey || event.Kind != kind {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			d := event.Tags.GetFirst([]string{"d", ""})
+			if d == nil {
+				continue
+			}
+			if current, found := announcements[d.Value()]; !found || event.CreatedAt.After(current.CreatedAt) {
+				announcements[d.Value()] = event
+			}
+		}
+	}
+}
+
+// rehomeAnnouncementTags copies the old announcement's tags with the old key replaced
+// by the new one. Without an old announcement the tags are built from the database.
+func rehomeAnnouncementTags(db *sql.DB, old nostr.Event, oldPubKey, newPubKey, repoName, gitSshBase string) nostr.Tags {
+	if old.ID != "" {
+		oldNpub, _ := nip19.EncodePublicKey(oldPubKey, "")
+		newNpub, _ := nip19.EncodePublicKey(newPubKey, "")
+		replacer := strings.NewReplacer(oldPubKey, newPubKey, oldNpub, newNpub)
+
+		var tags nostr.Tags
+		for _, tag := range old.Tags {
+			newTag := make(nostr.Tag, len(tag))
+			for i, value := range tag {
+				newTag[i] = replacer.Replace(value)
+			}
+			tags = append(tags, newTag)
+		}
+		return tags
+	}
+
+	var publicRead, publicWrite bool
+	var publicWriteRefs string
+	db.QueryRow("SELECT PublicRead,PublicWrite,PublicWriteRefs FROM Repository WHERE OwnerPubKey=? AND RepositoryName=?", newPubKey, repoName).Scan(&publicRead, &publicWrite, &publicWriteRefs)
+
+	tags := nostr.Tags{
+		{"d", repoName},
+		{"name", repoName},
+		{"public-read", strconv.FormatBool(publicRead)},
+		{"public-write", strconv.FormatBool(publicWrite)},
+	}
+	if publicWriteRefs != "" {
+		tags = append(tags, append(nostr.Tag{"public-write-refs"}, strings.Fields(publicWriteRefs)...))
+	}
+	if gitSshBase != "" {
+		tags = append(tags, nostr.Tag{"clone", gitSshBase + ":" + newPubKey + "/" + repoName})
+	}
+
+	maintainers := nostr.Tag{"maintainers"}
+	rows, err := db.Query("SELECT TargetPubKey FROM RepositoryPermission WHERE OwnerPubKey=? AND RepositoryName=? AND Source=?", newPubKey, repoName, bridge.PermissionSourceMaintainers)
+	if err == nil {
+		for rows.Next() {
+			var maintainer string
+			if rows.Scan(&maintainer) == nil {
+				maintainers = append(maintainers, maintainer)
+			}
+		}
+		rows.Close()
+	}
+	if len(maintainers) > 1 {
+		tags = append(tags, maintainers)
+	}
+	return tags
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// relayCheckResult is the outcome of checking one relay.
+type relayCheckResult struct {
+	URL       string   `json:"url"`
+	Read      bool     `json:"read"`
+	Write     bool     `json:"write"`
+	Connected bool     `json:"connected"`
+	LatencyMs int64    `json:"latencyMs,omitempty"` // time to open the websocket
+	Auth      string   `json:"auth"`                // "required" if the relay asked for NIP-42 auth, "" otherwise
+	Subscribe string   `json:"subscribe,omitempty"` // "ok", "no-eose" or "" without --subscribe
+	Events    int      `json:"events,omitempty"`    // events the test subscription returned
+	Notices   []string `json:"notices,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// relayCheck connects to every relay of the bridge configuration, or with --cli of
+// gn's own, and reports per relay whether it connects, how long that took, whether it
+// asks for auth and, with --subscribe, whether a test subscription is answered. It
+// exits non-zero if a relay fails.
+func relayCheck() {
+	flags := flag.NewFlagSet("relay check", flag.ContinueOnError)
+
+	cliRelays := flags.Bool("cli", false, "check the relays of gn's own config instead of the bridge's")
+	subscribe := flags.Bool("subscribe", false, "also run a test subscription for one repository announcement")
+	timeout := flags.Duration("timeout", 5*time.Second, "how long to wait for each relay")
+	asJSON := flags.Bool("json", false, "print the results as JSON")
+
+	if err := flags.Parse(os.Args[3:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 0 {
+		usage("relay check")
+	}
+
+	var relays []bridge.RelayConfig
+	if *cliRelays {
+		cfg, err := LoadConfig("~/.config/git-nostr")
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, url := range cfg.Relays {
+			relays = append(relays, bridge.RelayConfig{URL: url, Read: true, Write: true})
+		}
+	} else {
+		cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := cfg.ApplyRelayProxy(); err != nil {
+			log.Fatal(err)
+		}
+		relays = cfg.Relays
+	}
+	if len(relays) == 0 {
+		log.Fatal("no relays configured")
+	}
+
+	var results []relayCheckResult
+	failed := false
+	for _, relay := range relays {
+		result := checkRelayConnectivity(relay, *subscribe, *timeout)
+		if result.Error != "" {
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printRelayChecks(results, *subscribe)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func checkRelayConnectivity(relayCfg bridge.RelayConfig, subscribe bool, timeout time.Duration) relayCheckResult {
+	result := relayCheckResult{URL: relayCfg.URL, Read: relayCfg.Read, Write: relayCfg.Write}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	relay, err := nostr.RelayConnectContext(ctx, relayCfg.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer relay.Close()
+	result.Connected = true
+	result.LatencyMs = time.Since(start).Milliseconds()
+
+	// go-nostr doesn't speak NIP-42; relays that want auth say so in notices
+	notices := make(chan string, 16)
+	go func() {
+		for notice := range relay.Notices {
+			select {
+			case notices <- notice:
+			default:
+			}
+		}
+	}()
+
+	if subscribe {
+		result.Subscribe = "no-eose"
+		sub := relay.Subscribe(nostr.Filters{{Kinds: []int{protocol.KindRepositoryNIP34}, Limit: 1}})
+	wait:
+		for {
+			select {
+			case <-sub.Events:
+				result.Events++
+			case <-sub.EndOfStoredEvents:
+				result.Subscribe = "ok"
+				break wait
+			case <-ctx.Done():
+				break wait
+			}
+		}
+		sub.Unsub()
+		if result.Subscribe != "ok" {
+			result.Error = fmt.Sprintf("no end of stored events within %v", timeout)
+		}
+	}
+
+drain:
+	for {
+		select {
+		case notice := <-notices:
+			result.Notices = append(result.Notices, notice)
+			if strings.Contains(strings.ToLower(notice), "auth-required") {
+				result.Auth = "required"
+			}
+		default:
+			break drain
+		}
+	}
+	return result
+}
+
+func printRelayChecks(results []relayCheckResult, subscribe bool) {
+	for _, result := range results {
+		mode := ""
+		if result.Read {
+			mode += "r"
+		}
+		if result.Write {
+			mode += "w"
+		}
+		if !result.Connected {
+			fmt.Printf("[FAIL] %-40s %-2s %s\n", result.URL, mode, result.Error)
+			continue
+		}
+
+		status := "[PASS]"
+		if result.Error != "" {
+			status = "[FAIL]"
+		}
+		line := fmt.Sprintf("%s %-40s %-2s connected in %dms", status, result.URL, mode, result.LatencyMs)
+		if subscribe {
+			if result.Subscribe == "ok" {
+				line += fmt.Sprintf(", subscription answered (%d events)", result.Events)
+			} else {
+				line += ", " + result.Error
+			}
+		}
+		if result.Auth != "" {
+			line += ", auth " + result.Auth
+		}
+		fmt.Println(line)
+		for _, notice := range result.Notices {
+			fmt.Printf("       notice: %s\n", notice)
+		}
+	}
+}
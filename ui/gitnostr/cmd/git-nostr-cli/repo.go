@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,6 +12,7 @@ import (
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
 	"github.com/arbadacarbaYK/gitnostr/protocol"
 )
 
@@ -21,10 +21,33 @@ func repoCreate(cfg Config, pool *nostr.RelayPool) {
 
 	publicRead := flags.Bool("public-read", true, "repository will be readable by all users")
 	publicWrite := flags.Bool("public-write", false, "repository will be writeable by all users")
+	from := flags.String("from", "", "local git repository whose branches and tags are pushed to the new repository")
+	asJSON := flags.Bool("json", false, "print the published events as JSON")
+	defaultBranch := flags.String("default-branch", "", "branch HEAD of the new repository points to (default main, or the HEAD branch of --from)")
+
+	// The name may come before the flags, as in "repo create <name> --from <path>"
+	args := os.Args[3:]
+	repoName := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		repoName = args[0]
+		args = args[1:]
+	}
+	flags.Parse(args)
+	if repoName == "" && flags.NArg() > 0 {
+		repoName = flags.Arg(0)
+	}
+	if repoName == "" {
+		usage("repo create")
+	}
 
-	flags.Parse(os.Args[3:])
+	if *asJSON {
+		progress = os.Stderr
+	}
 
-	repoName := flags.Args()[0]
+	if *from != "" {
+		repoCreateFrom(cfg, pool, repoName, *from, *publicRead, *publicWrite, *defaultBranch, *asJSON)
+		return
+	}
 
 	log.Println("repo create --public-read=", *publicRead, " --public-write=", *publicWrite, " ", repoName)
 
@@ -33,160 +56,284 @@ func repoCreate(cfg Config, pool *nostr.RelayPool) {
 		PublicRead:     *publicRead,
 		PublicWrite:    *publicWrite,
 		GitSshBase:     cfg.GitSshBase,
+		DefaultBranch:  *defaultBranch,
 	})
 	if err != nil {
 		log.Fatal("repo marshal :", err)
 	}
 
 	var tags nostr.Tags
-	_, statuses, err := pool.PublishEvent(&nostr.Event{
+	published, ok := publishEvent(pool, &nostr.Event{
 		CreatedAt: time.Now(),
 		Kind:      protocol.KindRepository,
 		Tags:      tags,
 		Content:   string(repoJson),
-	})
-	if err != nil {
-		log.Fatal(err)
+	}, "repository")
+	if !ok {
+		os.Exit(1)
 	}
+	printPublished(published, "repository", *asJSON)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	publishSuccess := false
-
-	for {
-		select {
-		case <-ctx.Done():
-			if !publishSuccess {
-				fmt.Printf("repository was not published")
-				os.Exit(1)
-			}
-			return
-		case status := <-statuses:
-			switch status.Status {
-			case nostr.PublishStatusSent:
-				publishSuccess = true
-				fmt.Printf("published repository to '%s'.\n", status.Relay)
-			case nostr.PublishStatusFailed:
-				fmt.Printf("failed to publish repository to '%s'.\n", status.Relay)
-			case nostr.PublishStatusSucceeded:
-				publishSuccess = true
-				fmt.Printf("published repository to '%s'.\n", status.Relay)
-			}
+func repoPermission(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("repo permission", flag.ContinueOnError)
+
+	fromFile := flags.String("from-file", "", "file with one pubkey (hex, npub or nip05) per line to grant the permission to")
+	asJSON := flags.Bool("json", false, "print the published events as JSON")
+
+	if len(os.Args) < 4 {
+		usage("repo permission")
+	}
+	repoName := os.Args[3]
+	flags.Parse(os.Args[4:])
+
+	if *asJSON {
+		progress = os.Stderr
+	}
+
+	if *fromFile == "" {
+		if flags.NArg() != 2 {
+			usage("repo permission")
+		}
+		permission := strings.ToUpper(flags.Arg(1))
+		if err := protocol.ValidatePermission(permission); err != nil {
+			log.Fatal(err)
+		}
+		targetPubKey, err := gitnostr.ResolveHexPubKey(flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
 		}
+		if !publishPermission(pool, repoName, targetPubKey, permission, *asJSON) {
+			os.Exit(1)
+		}
+		return
 	}
-}
 
-func repoPermission(cfg Config, pool *nostr.RelayPool) {
+	if flags.NArg() != 1 {
+		usage("repo permission")
+	}
+	permission := strings.ToUpper(flags.Arg(0))
+	if err := protocol.ValidatePermission(permission); err != nil {
+		log.Fatal(err)
+	}
 
-	targetPubKey, err := gitnostr.ResolveHexPubKey(os.Args[4])
+	content, err := os.ReadFile(*fromFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	granted := 0
+	var failed []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targetPubKey, err := gitnostr.ResolveHexPubKey(line)
+		if err != nil {
+			fmt.Fprintf(progress, "%v: %v\n", line, err)
+			failed = append(failed, line)
+			continue
+		}
+		if !publishPermission(pool, repoName, targetPubKey, permission, *asJSON) {
+			failed = append(failed, line)
+			continue
+		}
+		granted++
+	}
+
+	fmt.Fprintf(progress, "granted %v to %d pubkeys, %d failed\n", permission, granted, len(failed))
+	for _, line := range failed {
+		fmt.Fprintf(progress, "  failed: %v\n", line)
+	}
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// publishPermission publishes a permission event granting permission on the
+// repository to targetPubKey and prints its id. It returns false if no relay accepted it.
+func publishPermission(pool *nostr.RelayPool, repoName, targetPubKey, permission string, asJSON bool) bool {
 	permJson, err := json.Marshal(protocol.RepositoryPermission{
-		RepositoryName: os.Args[3],
+		RepositoryName: repoName,
 		TargetPubKey:   targetPubKey,
-		Permission:     os.Args[5],
+		Permission:     permission,
 	})
-
 	if err != nil {
 		log.Fatal("permission marshal :", err)
 	}
 
-	var tags nostr.Tags
-	_, statuses, err := pool.PublishEvent(&nostr.Event{
+	published, ok := publishEvent(pool, &nostr.Event{
 		CreatedAt: time.Now(),
 		Kind:      protocol.KindRepositoryPermission,
-		Tags:      tags,
 		Content:   string(permJson),
-	})
+	}, "permission for "+targetPubKey)
+	if ok {
+		printPublished(published, "permission for "+targetPubKey, asJSON)
+	}
+	return ok
+}
+
+func repoClone(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("repo clone", flag.ContinueOnError)
+
+	coordinate := flags.String("coord", "", "NIP-34 repository coordinate 30617:<pubkey>:<identifier> to clone instead of <owner>:<repo>")
+	noCache := flags.Bool("no-cache", false, "query the relays even if the event cache has recent results")
+
+	flags.Parse(os.Args[3:])
+
+	if *coordinate != "" {
+		repoCloneCoordinate(cfg, pool, *coordinate, *noCache)
+		return
+	}
+	if flags.NArg() != 1 {
+		usage("repo clone")
+	}
+
+	name, repoName, err := parseRepoParam(flags.Arg(0))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	publishSuccess := false
-
-	for {
-		select {
-		case <-ctx.Done():
-			if !publishSuccess {
-				fmt.Printf("permission was not published")
-				os.Exit(1)
-			}
-			return
-		case status := <-statuses:
-			switch status.Status {
-			case nostr.PublishStatusSent:
-				publishSuccess = true
-				fmt.Printf("published permission to '%s'.\n", status.Relay)
-			case nostr.PublishStatusFailed:
-				fmt.Printf("failed to publish permission to '%s'.\n", status.Relay)
-			case nostr.PublishStatusSucceeded:
-				publishSuccess = true
-				fmt.Printf("published permission to '%s'.\n", status.Relay)
-			}
-		}
+	pubKey, err := gitnostr.ResolveHexPubKey(name)
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	events, fromCache := fetchAuthorEvents(pool, protocol.KindRepository, pubKey, *noCache)
+	repository, found := findRepository(events, repoName)
+	if !found && fromCache {
+		// The repository may be newer than the cached events
+		events, _ = fetchAuthorEvents(pool, protocol.KindRepository, pubKey, true)
+		repository, found = findRepository(events, repoName)
+	}
+	if !found {
+		log.Fatal("Repo not found")
+	}
+
+	// An empty repository is cloned onto its announced default branch
+	defaultBranch := "init.defaultBranch=" + repository.GetDefaultBranch()
+	log.Println("git", "-c", defaultBranch, "clone", repository.GitSshBase+":"+pubKey+"/"+repoName)
+	cmd := exec.Command("git", "-c", defaultBranch, "clone", repository.GitSshBase+":"+pubKey+"/"+repoName)
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-func repoClone(cfg Config, pool *nostr.RelayPool) {
+// findRepository returns the newest kind 51 repository named repoName among events.
+func findRepository(events []nostr.Event, repoName string) (protocol.Repository, bool) {
+	var repository protocol.Repository
+	var newest *nostr.Event
+	for i, event := range events {
+		var checkRepo protocol.Repository
+
+		err := json.Unmarshal([]byte(event.Content), &checkRepo)
+		if err != nil {
+			log.Println("Failed to parse repository.")
+			continue
+		}
+
+		if checkRepo.RepositoryName == repoName && (newest == nil || event.CreatedAt.After(newest.CreatedAt)) {
+			repository = checkRepo
+			newest = &events[i]
+		}
+	}
+	return repository, newest != nil
+}
 
-	repoParam := os.Args[3]
-	// steve@localhost:public
+// parseRepoParam splits a repository given as <owner>:<repo>, <owner>/<repo> or a clone
+// url (git@host:<owner>/<repo>.git, ssh://…/<owner>/<repo>.git, https://…/<owner>/<repo>)
+// into its owner and name. The owner is returned as given: hex, npub or nip05.
+func parseRepoParam(repoParam string) (string, string, error) {
+	path := repoParam
+	if _, rest, found := strings.Cut(repoParam, "://"); found {
+		// ssh://git@host/<owner>/<repo>.git, https://host/<owner>/<repo>
+		_, path, _ = strings.Cut(rest, "/")
+	} else if host, rest, found := strings.Cut(repoParam, ":"); found && strings.Contains(host, "@") && strings.Contains(rest, "/") {
+		// git@host:<owner>/<repo>.git; steve@localhost:repo is a nip05 owner instead
+		path = rest
+	}
 
-	split := strings.SplitN(repoParam, ":", 2)
+	var owner, repoName string
+	if strings.Contains(path, "/") {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		if len(segments) >= 2 {
+			owner, repoName = segments[len(segments)-2], segments[len(segments)-1]
+		}
+	} else {
+		owner, repoName, _ = strings.Cut(path, ":")
+	}
+	repoName = strings.TrimSuffix(repoName, ".git")
 
-	name := split[0]
-	repoName := split[1]
+	if owner == "" || repoName == "" {
+		return "", "", fmt.Errorf("invalid repository %q: expected <owner>:<repo>, <owner>/<repo> or a clone url", repoParam)
+	}
+	if !bridge.IsValidRepoName(repoName) {
+		return "", "", fmt.Errorf("invalid repository name %q in %q", repoName, repoParam)
+	}
+	return owner, repoName, nil
+}
 
-	identifier, err := gitnostr.ResolveHexPubKey(name)
+// repoCloneCoordinate clones the repository announced by the newest 30617 event at
+// coordinate, using its first clone url or, without one, the configured gitSshBase.
+func repoCloneCoordinate(cfg Config, pool *nostr.RelayPool, coordinate string, noCache bool) {
+	address, err := protocol.ParseAddress(coordinate)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if address.Kind != protocol.KindRepositoryNIP34 {
+		log.Fatalf("invalid coordinate %q: kind must be %d (repository announcement)", coordinate, protocol.KindRepositoryNIP34)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	events, fromCache := fetchAuthorEvents(pool, address.Kind, address.PubKey, noCache)
+	announcement := findAnnouncement(events, address.Identifier)
+	if announcement == nil && fromCache {
+		// The announcement may be newer than the cached events
+		events, _ = fetchAuthorEvents(pool, address.Kind, address.PubKey, true)
+		announcement = findAnnouncement(events, address.Identifier)
+	}
+	if announcement == nil {
+		log.Fatalf("repository %v not found", coordinate)
+	}
 
-	_, subchan := pool.Sub(nostr.Filters{{Kinds: []int{protocol.KindRepository}, Authors: []string{identifier}}})
+	cloneUrl := cfg.GitSshBase + ":" + address.PubKey + "/" + address.Identifier
+	for _, tag := range announcement.Tags {
+		if len(tag) >= 2 && tag[0] == "clone" && tag[1] != "" {
+			cloneUrl = tag[1]
+			break
+		}
+	}
 
-	var pubKey string
-	var repository protocol.Repository
+	// An empty repository is cloned onto its announced default branch
+	defaultBranch := protocol.AnnouncedDefaultBranch(announcement.Tags)
+	if defaultBranch == "" {
+		defaultBranch = protocol.DefaultBranchName
+	}
+	log.Println("git", "-c", "init.defaultBranch="+defaultBranch, "clone", cloneUrl, address.Identifier)
+	cmd := exec.Command("git", "-c", "init.defaultBranch="+defaultBranch, "clone", cloneUrl, address.Identifier)
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			if pubKey != "" {
-				log.Println("git", "clone", repository.GitSshBase+":"+pubKey+"/"+repoName)
-				cmd := exec.Command("git", "clone", repository.GitSshBase+":"+pubKey+"/"+repoName)
-				cmd.Stdout = os.Stdout
-				cmd.Stdin = os.Stdin
-				cmd.Stderr = os.Stderr
-				err := cmd.Run()
-				if err != nil {
-					log.Fatal(err)
-				}
-			} else {
-				log.Fatal("Repo not found")
-			}
-
-			return
-		case event := <-subchan:
-			var checkRepo protocol.Repository
-
-			err := json.Unmarshal([]byte(event.Event.Content), &checkRepo)
-			if err != nil {
-				log.Println("Failed to parse repository.")
-			}
-
-			if checkRepo.RepositoryName == repoName {
-				repository = checkRepo
-				pubKey = event.Event.PubKey
-			}
+// findAnnouncement returns the newest announcement with the "d" tag identifier among events.
+func findAnnouncement(events []nostr.Event, identifier string) *nostr.Event {
+	var announcement *nostr.Event
+	for i, event := range events {
+		if d := event.Tags.GetFirst([]string{"d", ""}); d == nil || d.Value() != identifier {
+			continue
+		}
+		if announcement == nil || event.CreatedAt.After(announcement.CreatedAt) {
+			announcement = &events[i]
 		}
 	}
+	return announcement
 }
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestParseRepoParam(t *testing.T) {
+	const owner = "4242424242424242424242424242424242424242424242424242424242424242"
+	tests := []struct {
+		param string
+		owner string
+		repo  string
+	}{
+		{owner + ":repo", owner, "repo"},
+		{owner + "/repo", owner, "repo"},
+		{owner + ":repo.git", owner, "repo"},
+		{"npub1xyz:repo", "npub1xyz", "repo"},
+		{"steve@localhost:repo", "steve@localhost", "repo"},
+		{"git@host:" + owner + "/repo.git", owner, "repo"},
+		{"ssh://git@host/" + owner + "/repo.git", owner, "repo"},
+		{"ssh://git@host:2222/" + owner + "/repo", owner, "repo"},
+		{"https://host/" + owner + "/repo", owner, "repo"},
+		{"https://host/git/" + owner + "/repo.git/", owner, "repo"},
+		{"", "", ""},
+		{"repo", "", ""},
+		{owner + ":", "", ""},
+		{":repo", "", ""},
+		{owner + ":.git", "", ""},
+		{owner + ":bad name", "", ""},
+		{"https://host/repo", "", ""},
+		{"git@host:" + owner + "/", "", ""},
+	}
+	for _, test := range tests {
+		owner, repo, err := parseRepoParam(test.param)
+		if test.owner == "" {
+			if err == nil {
+				t.Errorf("parseRepoParam(%q) = %q, %q, want error", test.param, owner, repo)
+			}
+			continue
+		}
+		if err != nil || owner != test.owner || repo != test.repo {
+			t.Errorf("parseRepoParam(%q) = %q, %q, %v, want %q, %q", test.param, owner, repo, err, test.owner, test.repo)
+		}
+	}
+}
@@ -22,6 +22,9 @@ func sshKeyAdd(cfg Config, pool *nostr.RelayPool) {
 
 	flags.Parse(os.Args[3:])
 
+	if flags.NArg() != 1 {
+		usage("ssh-key add")
+	}
 	keyFilePath := flags.Arg(0)
 
 	keyData, err := ioutil.ReadFile(keyFilePath)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// statePublish re-announces the refs and HEAD of a repository hosted by the bridge on
+// this machine in a 30618 state event, e.g. after fixing the repository by hand. It
+// must run as the bridge user. The event is signed with the cli key if it is the
+// owner's, and with the bridge's privateKey otherwise.
+func statePublish(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("state publish", flag.ContinueOnError)
+
+	asJSON := flags.Bool("json", false, "print the published event as JSON")
+
+	flags.Parse(os.Args[3:])
+
+	if flags.NArg() != 1 {
+		usage("state publish")
+	}
+	if *asJSON {
+		progress = os.Stderr
+	}
+
+	owner, repoName, err := parseRepoParam(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ownerPubKey, err := gitnostr.ResolveHexPubKey(owner)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	refs, head, err := localRefs(ownerPubKey, repoName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(refs) == 0 {
+		log.Fatalf("%v/%v has no branches or tags to announce", ownerPubKey, repoName)
+	}
+
+	state := &nostr.Event{
+		CreatedAt: time.Now(),
+		Kind:      protocol.KindRepositoryState,
+		Tags:      stateTags(repoName, refs, head),
+	}
+
+	cliPubKey, err := nostr.GetPublicKey(cfg.PrivateKey)
+	if err != nil {
+		log.Fatalf("invalid private key : %v", err)
+	}
+	if cliPubKey != ownerPubKey {
+		if err := signWithBridgeKey(state); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("the cli key is not the owner's, signing with the bridge key %v\n", state.PubKey)
+	}
+
+	published, ok := publishEvent(pool, state, "state")
+	if !ok {
+		os.Exit(1)
+	}
+	printPublished(published, "state", *asJSON)
+}
+
+// signWithBridgeKey signs event with the privateKey of the bridge config.
+func signWithBridgeKey(event *nostr.Event) error {
+	bridgeCfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		return err
+	}
+	if bridgeCfg.PrivateKey == "" {
+		return fmt.Errorf("the cli key is not the owner's and the bridge config has no privateKey to sign with")
+	}
+	secretKey, err := gitnostr.DecodePrivateKey(bridgeCfg.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("bridge privateKey : %w", err)
+	}
+	event.PubKey, err = nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return fmt.Errorf("bridge privateKey : %w", err)
+	}
+	if err := event.Sign(secretKey); err != nil {
+		return fmt.Errorf("sign state event : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// synopses lists the usage of every gn command, in the order usage prints them.
+var synopses = []struct{ command, synopsis string }{
+	{"repo create", "gn repo create [--public-read=false] [--public-write] [--from <local-path>] [--default-branch <branch>] [--json] <repo>"},
+	{"repo clone", "gn repo clone [--no-cache] <owner>:<repo> | <owner>/<repo> | <clone url> | --coord 30617:<pubkey>:<identifier>"},
+	{"repo permission", "gn repo permission <repo> [--json] <pubkey> <permission> | <repo> [--json] --from-file <file> <permission>"},
+	{"repo apply-patch", "gn repo apply-patch [--branch <branch>] [--publish-status] <owner>:<repo> <patch-event-id>"},
+	{"repo adopt", "gn repo adopt [--owner <npub>] [--symlink] [--public-read=false] [--public-write] <path> <repo>"},
+	{"repo rehome", "gn repo rehome --old-key-file <file>"},
+	{"repo hook", "gn repo hook <repo> [<url>]"},
+	{"repo verify", "gn repo verify [--local] <owner>:<repo>"},
+	{"identity set", "gn identity set <email>..."},
+	{"ssh-key add", "gn ssh-key add [--title <title>] <public-key-file>"},
+	{"state publish", "gn state publish [--json] <owner>/<repo>"},
+	{"migrate nip34", "gn migrate nip34 [--owner <npub>] [--state] [--dry-run]"},
+	{"doctor", "gn doctor"},
+	{"relay check", "gn relay check [--cli] [--subscribe] [--timeout 5s] [--json]"},
+	{"layout migrate", "gn layout migrate [--yes] nested|flat|sharded"},
+	{"backup", "gn backup <dest>"},
+	{"audit", "gn audit [--repo <owner>/<repo>] [--pubkey <npub>] [--since 72h] [--verb push.received] [--limit 50] [--before <id>] [--json]"},
+	{"failed", "gn failed [--limit 50] [--json] | --retry [<event-id>]"},
+	{"lag", "gn lag [--threshold 1h] [--json]"},
+	{"license", "gn license"},
+}
+
+// usage prints the synopsis of command and exits. A command group like "repo" prints
+// all of its subcommands, and "" prints every command.
+func usage(command string) {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, s := range synopses {
+		if command == "" || s.command == command || strings.HasPrefix(s.command, command+" ") {
+			fmt.Fprintf(os.Stderr, "  %s\n", s.synopsis)
+		}
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr"
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+	"github.com/arbadacarbaYK/gitnostr/protocol"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// repoVerify compares the refs of the newest 30618 state event of a repository with
+// the refs the bridge actually serves, and exits non-zero on any mismatch. The refs
+// are read with git ls-remote over gitSshBase, or with --local straight from the
+// bridge's repository directory when run as the bridge user.
+func repoVerify(cfg Config, pool *nostr.RelayPool) {
+	flags := flag.NewFlagSet("repo verify", flag.ContinueOnError)
+
+	local := flags.Bool("local", false, "read the refs from the bridge's repository directory instead of over ssh")
+
+	flags.Parse(os.Args[3:])
+
+	if flags.NArg() != 1 {
+		usage("repo verify")
+	}
+	owner, repoName, err := parseRepoParam(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ownerPubKey, err := gitnostr.ResolveHexPubKey(owner)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	state, err := fetchState(pool, ownerPubKey, repoName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	announced := make(map[string]string)
+	announcedHead := ""
+	for _, tag := range state.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if tag[0] == "HEAD" {
+			// A detached HEAD isn't compared, ls-remote only reports symbolic ones
+			announcedHead, _ = protocol.ParseHead(tag[1])
+		} else if strings.HasPrefix(tag[0], "refs/") {
+			announced[tag[0]] = tag[1]
+		}
+	}
+
+	var actual map[string]string
+	var actualHead string
+	if *local {
+		actual, actualHead, err = localRefs(ownerPubKey, repoName)
+	} else {
+		actual, actualHead, err = remoteRefs(cfg.GitSshBase + ":" + ownerPubKey + "/" + repoName)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("state event %v from %v\n", state.ID, state.CreatedAt.Format(time.RFC3339))
+
+	var mismatches []string
+	for ref, commit := range announced {
+		switch current, found := actual[ref]; {
+		case !found:
+			mismatches = append(mismatches, fmt.Sprintf("missing     %v: announced %v, not on the bridge", ref, commit))
+		case current != commit:
+			mismatches = append(mismatches, fmt.Sprintf("mismatch    %v: announced %v, bridge has %v", ref, commit, current))
+		}
+	}
+	for ref, commit := range actual {
+		if _, found := announced[ref]; !found {
+			mismatches = append(mismatches, fmt.Sprintf("unannounced %v: bridge has %v", ref, commit))
+		}
+	}
+	sort.Strings(mismatches)
+	if announcedHead != "" && announcedHead != actualHead {
+		mismatches = append(mismatches, fmt.Sprintf("HEAD        announced %v, bridge has %v", announcedHead, actualHead))
+	}
+
+	for _, mismatch := range mismatches {
+		fmt.Println(mismatch)
+	}
+	if len(mismatches) > 0 {
+		fmt.Printf("%d differences from the state event\n", len(mismatches))
+		os.Exit(1)
+	}
+	fmt.Printf("all %d announced refs match\n", len(announced))
+}
+
+// fetchState returns the newest 30618 state event of the owner's repository.
+func fetchState(pool *nostr.RelayPool, ownerPubKey, repoName string) (nostr.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, subchan := pool.Sub(nostr.Filters{{
+		Kinds:   []int{protocol.KindRepositoryState},
+		Authors: []string{ownerPubKey},
+		Tags:    nostr.TagMap{"d": []string{repoName}},
+	}})
+
+	var state *nostr.Event
+	for {
+		select {
+		case <-ctx.Done():
+			if state == nil {
+				return nostr.Event{}, fmt.Errorf("no state event found for %v/%v", ownerPubKey, repoName)
+			}
+			return *state, nil
+		case message := <-subchan:
+			event := message.Event
+			// Relays may ignore parts of the filter
+			if event.Kind != protocol.KindRepositoryState || event.PubKey != ownerPubKey {
+				continue
+			}
+			if d := event.Tags.GetFirst([]string{"d", ""}); d == nil || d.Value() != repoName {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			if state == nil || event.CreatedAt.After(state.CreatedAt) {
+				state = &event
+			}
+		}
+	}
+}
+
+// remoteRefs lists the branches and tags served at url and the branch HEAD points to.
+func remoteRefs(url string) (map[string]string, string, error) {
+	output, err := exec.Command("git", "ls-remote", "--symref", url).Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("git ls-remote %v failed : %w", url, err)
+	}
+
+	refs := make(map[string]string)
+	head := ""
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if target, found := strings.CutPrefix(fields[0], "ref: "); found && fields[1] == "HEAD" {
+			head = target
+			continue
+		}
+		if isVerifiedRef(fields[1]) {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	return refs, head, nil
+}
+
+// localRefs lists the branches and tags of the repository in the bridge's repositoryDir
+// and the branch HEAD points to.
+func localRefs(ownerPubKey, repoName string) (map[string]string, string, error) {
+	bridgeCfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		return nil, "", err
+	}
+	repoPath, err := bridgeCfg.RepoPath(ownerPubKey, repoName)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := os.Stat(repoPath); err != nil {
+		return nil, "", fmt.Errorf("repository %v/%v not found on this bridge : %w", ownerPubKey, repoName, err)
+	}
+
+	refs, err := forEachRef(repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	head, err := bridge.SymbolicHead(repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	return refs, head, nil
+}
+
+// forEachRef lists the branches and tags of the repository at path, bare or not.
+func forEachRef(path string) (map[string]string, error) {
+	output, err := exec.Command("git", "-C", path, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed : %w", err)
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if commit, ref, found := strings.Cut(line, " "); found && isVerifiedRef(ref) {
+			refs[ref] = commit
+		}
+	}
+	return refs, nil
+}
+
+// isVerifiedRef reports whether ref is a branch or tag, the refs state events announce.
+// Peeled tag entries of ls-remote are skipped.
+func isVerifiedRef(ref string) bool {
+	return (strings.HasPrefix(ref, "refs/heads/") || strings.HasPrefix(ref, "refs/tags/")) && !strings.HasSuffix(ref, "^{}")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+)
+
+// allowedRefsEnv carries the ref patterns a ref-scoped public push may update
+// from git-nostr-ssh to the pre-receive hook it runs under git-receive-pack.
+const allowedRefsEnv = "GIT_NOSTR_ALLOWED_REFS"
+
+// Environment passed from git-nostr-ssh to the post-receive hook.
+const (
+	hookURLEnv    = "GIT_NOSTR_HOOK_URL"
+	hookOwnerEnv  = "GIT_NOSTR_OWNER"
+	hookRepoEnv   = "GIT_NOSTR_REPO"
+	hookPusherEnv = "GIT_NOSTR_PUSHER"
+)
+
+const hookMarker = "# installed by git-nostr-ssh"
+
+// ensureHook installs a hook (pre-receive or post-receive) that calls back into this
+// executable. A pre-existing hook that wasn't installed by git-nostr-ssh is left
+// alone and reported as an error.
+func ensureHook(repoPath, hookName string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	hookPath := filepath.Join(repoPath, "hooks", hookName)
+	hook := fmt.Sprintf("#!/bin/sh\n%s\nexec '%s' %s\n", hookMarker, exe, hookName)
+
+	existing, err := os.ReadFile(hookPath)
+	if err == nil {
+		if string(existing) == hook {
+			return nil
+		}
+		if !strings.Contains(string(existing), hookMarker) {
+			return fmt.Errorf("%v already exists and was not installed by git-nostr-ssh", hookPath)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(hookPath), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(hookPath, []byte(hook), 0755)
+}
+
+// preReceive is run by git as the pre-receive hook. It rejects the whole push if
+// any updated ref falls outside the patterns in GIT_NOSTR_ALLOWED_REFS.
+func preReceive() {
+	patterns := strings.Fields(os.Getenv(allowedRefsEnv))
+	if len(patterns) == 0 {
+		os.Exit(0)
+	}
+
+	rejected := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		// <old-value> SP <new-value> SP <ref-name>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		ref := fields[2]
+
+		allowed := false
+		for _, pattern := range patterns {
+			if bridge.RefMatchesPattern(ref, pattern) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			fmt.Fprintf(os.Stderr, "fatal: push to %s is not allowed\n", ref)
+			rejected = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: read pre-receive input: %v\n", err)
+		os.Exit(1)
+	}
+
+	if rejected {
+		fmt.Fprintf(os.Stderr, "hint: This repository only accepts public pushes to: %s\n", strings.Join(patterns, ", "))
+		os.Exit(1)
+	}
+}
+
+// postReceive is run by git as the post-receive hook. It POSTs the pushed refs to
+// the repository's hook URL. It only ever makes that request, so owners can't run
+// code on the bridge host, and it never fails the (already completed) push. The
+// delivery is recorded in the bridge database, whose retrier repeats failed ones.
+func postReceive() {
+	hookURL := os.Getenv(hookURLEnv)
+	if hookURL == "" {
+		return
+	}
+
+	payload := bridge.PostReceivePayload{
+		Owner:  os.Getenv(hookOwnerEnv),
+		Repo:   os.Getenv(hookRepoEnv),
+		Pusher: os.Getenv(hookPusherEnv),
+		Time:   time.Now().Unix(),
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		// <old-value> SP <new-value> SP <ref-name>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		payload.Refs = append(payload.Refs, bridge.PushedRef{Ref: fields[2], Before: fields[0], After: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: read post-receive input: %v\n", err)
+		return
+	}
+
+	// The delivery is queued first so the bridge retries it if this attempt fails
+	db, id, err := queueDelivery(hookURL, payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v, delivering the repository hook without retries\n", err)
+		if err := bridge.DeliverPostReceive(hookURL, payload); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: push succeeded but the repository hook failed: %v\n", err)
+		}
+		return
+	}
+	defer db.Close()
+	if err := bridge.AttemptDelivery(db, id); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: push succeeded but the repository hook failed, the bridge will retry it: %v\n", err)
+	}
+}
+
+// queueDelivery stores the delivery in the bridge database and returns the open
+// database and the delivery id.
+func queueDelivery(hookURL string, payload bridge.PostReceivePayload) (*sql.DB, int64, error) {
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		return nil, 0, err
+	}
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	id, err := bridge.QueueDelivery(db, hookURL, payload)
+	if err != nil {
+		db.Close()
+		return nil, 0, err
+	}
+	return db, id, nil
+}
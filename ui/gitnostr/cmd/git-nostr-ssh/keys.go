@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/arbadacarbaYK/gitnostr/bridge"
+)
+
+// printAuthorizedKeys implements sshd's AuthorizedKeysCommand. It prints the
+// authorized_keys lines of the registered keys matching fingerprint (sshd's %f),
+// or of all keys when no fingerprint is given.
+func printAuthorizedKeys(fingerprint string) {
+	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: failed to load bridge configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	db, err := bridge.OpenDb(cfg.DbFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	rows, err := db.Query("SELECT PubKey,SshKey FROM AuthorizedKeys")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: failed to query keys: %v\n", err)
+		os.Exit(1)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pubKey string
+		var sshKey string
+		if err := rows.Scan(&pubKey, &sshKey); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: failed to query keys: %v\n", err)
+			os.Exit(1)
+		}
+
+		if fingerprint != "" {
+			keyFingerprint, err := bridge.SshKeyFingerprint(sshKey)
+			if err != nil || keyFingerprint != fingerprint {
+				continue
+			}
+		}
+
+		fmt.Println(bridge.AuthorizedKeyLine(exe, pubKey, sshKey))
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: failed to query keys: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -17,16 +16,27 @@ import (
 	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
-func isReadAllowed(rights *string) bool {
-	return rights != nil && (*rights == "ADMIN" || *rights == "READ" || *rights == "WRITE")
-}
-
-func isWriteAllowed(rights *string) bool {
-	return rights != nil && (*rights == "ADMIN" || *rights == "WRITE")
-}
-
-func isAdminAllowed(rights *string) bool {
-	return rights != nil && (*rights == "ADMIN")
+// parseOwnerPubKey returns the lowercase hex pubkey of the owner in an ssh repository
+// path, given as hex in any case, npub or NIP-05 identifier resolved with queryNip05.
+func parseOwnerPubKey(owner string, queryNip05 func(string) string) (string, error) {
+	if _, err := hex.DecodeString(owner); err == nil && len(owner) == 64 {
+		return strings.ToLower(owner), nil
+	}
+	if strings.HasPrefix(owner, "npub") {
+		decoded, _, err := nip19.Decode(owner)
+		if err != nil || len(decoded) != 32 {
+			return "", fmt.Errorf("invalid npub format")
+		}
+		return hex.EncodeToString(decoded), nil
+	}
+	if strings.Contains(owner, "@") {
+		profile := queryNip05(owner)
+		if profile == "" {
+			return "", fmt.Errorf("failed to resolve NIP-05 '%s'", owner)
+		}
+		return strings.ToLower(profile), nil
+	}
+	return "", fmt.Errorf("invalid repository owner pubkey")
 }
 
 func getLatestPendingPushInvoice(db *sql.DB, ownerPubKey, repoName, payerPubKey string) (string, error) {
@@ -44,12 +54,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "pre-receive" {
+		preReceive()
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "post-receive" {
+		postReceive()
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		fingerprint := ""
+		if len(os.Args) > 2 {
+			fingerprint = os.Args[2]
+		}
+		printAuthorizedKeys(fingerprint)
+		return
+	}
+
 	if len(os.Args) != 2 {
 		fmt.Fprintln(os.Stderr, "interactive login not allowed")
 		os.Exit(1)
 	}
 
-	targetPubKey := os.Args[1]
+	targetPubKey := strings.ToLower(os.Args[1])
 
 	sshCommand := os.Getenv("SSH_ORIGINAL_COMMAND")
 	if sshCommand == "" {
@@ -80,34 +109,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	ownerPubKeyInput := repoSplit[0]
-	var ownerPubKey string
-
-	// Resolve ownerPubKey: supports hex, npub, or NIP-05 format
-	if _, err := hex.DecodeString(ownerPubKeyInput); err == nil && len(ownerPubKeyInput) == 64 {
-		// Already hex format
-		ownerPubKey = strings.ToLower(ownerPubKeyInput)
-	} else if strings.HasPrefix(ownerPubKeyInput, "npub") {
-		// Decode npub to hex
-		decoded, _, err := nip19.Decode(ownerPubKeyInput)
-		if err != nil || len(decoded) != 32 {
-			fmt.Fprintf(os.Stderr, "fatal: invalid npub format in '%s'\n", repoParam)
-			fmt.Fprintf(os.Stderr, "hint: Repository path must be in format: <hex-pubkey>/<repo-name> or <npub>/<repo-name>\n")
-			os.Exit(1)
-		}
-		// Convert 32-byte pubkey to hex string
-		ownerPubKey = strings.ToLower(hex.EncodeToString(decoded))
-	} else if strings.Contains(ownerPubKeyInput, "@") {
-		// Resolve NIP-05 to hex pubkey
-		profile := nip05.QueryIdentifier(ownerPubKeyInput)
-		if profile == "" {
-			fmt.Fprintf(os.Stderr, "fatal: failed to resolve NIP-05 '%s'\n", ownerPubKeyInput)
-			fmt.Fprintf(os.Stderr, "hint: Repository path must be in format: <hex-pubkey>/<repo-name>, <npub>/<repo-name>, or <nip05>/<repo-name>\n")
-			os.Exit(1)
-		}
-		ownerPubKey = strings.ToLower(profile)
-	} else {
-		fmt.Fprintf(os.Stderr, "fatal: invalid repository owner pubkey in '%s'\n", repoParam)
+	ownerPubKey, err := parseOwnerPubKey(repoSplit[0], nip05.QueryIdentifier)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v in '%s'\n", err, repoParam)
 		fmt.Fprintf(os.Stderr, "hint: Repository path must be in format: <hex-pubkey>/<repo-name>, <npub>/<repo-name>, or <nip05>/<repo-name>\n")
 		fmt.Fprintf(os.Stderr, "hint: Example: git@git.gittr.space:npub1.../repo-name.git or git@git.gittr.space:user@domain.com/repo-name.git\n")
 		os.Exit(1)
@@ -122,16 +126,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	reposDir, err := gitnostr.ResolvePath(cfg.RepositoryDir)
+	repoPath, err := cfg.RepoPath(ownerPubKey, repoName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "fatal: failed to resolve repository directory: %v\n", err)
 		fmt.Fprintf(os.Stderr, "hint: Check bridge configuration for RepositoryDir setting\n")
 		os.Exit(1)
 	}
 
-	repoParentPath := filepath.Join(reposDir, ownerPubKey)
-
-	repoPath := filepath.Join(repoParentPath, repoName+".git")
 	_, err = os.Stat(repoPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "fatal: repository '%s/%s' not found\n", ownerPubKey, repoName)
@@ -140,6 +141,11 @@ func main() {
 		fmt.Fprintf(os.Stderr, "hint: Or push the repository via the web UI first to ensure it's created on the bridge.\n")
 		os.Exit(1)
 	}
+	if importUrl := bridge.ImportInProgress(repoPath); importUrl != "" {
+		fmt.Fprintf(os.Stderr, "fatal: repository '%s/%s' is still being imported from %s\n", ownerPubKey, repoName, importUrl)
+		fmt.Fprintf(os.Stderr, "hint: Try again once the bridge has finished the import.\n")
+		os.Exit(1)
+	}
 
 	db, err := bridge.OpenDb(cfg.DbFile)
 	if err != nil {
@@ -149,16 +155,21 @@ func main() {
 	}
 	defer db.Close()
 
-	row := db.QueryRow("SELECT Repository.PublicRead,Repository.PublicWrite,RepositoryPermission.Permission FROM Repository LEFT OUTER JOIN RepositoryPermission ON Repository.OwnerPubKey=RepositoryPermission.OwnerPubKey AND Repository.RepositoryName=RepositoryPermission.RepositoryName AND TargetPubKey=? WHERE Repository.OwnerPubKey=? AND Repository.RepositoryName=?", targetPubKey, ownerPubKey, repoName)
+	isOwner := strings.EqualFold(targetPubKey, ownerPubKey)
 
-	var publicRead bool
-	var publicWrite bool
-	var permission *string
-	err = row.Scan(&publicRead, &publicWrite, &permission)
+	access, err := bridge.ResolveAccess(db, ownerPubKey, repoName, targetPubKey)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			// Repository exists but not in database - this can happen for newly created repos
-			// Allow the operation to continue, permission checks will use defaults
+		if errors.Is(err, bridge.ErrRepositoryNotFound) {
+			// Repository exists on disk but not in the database - this can happen for newly
+			// created repos whose announcement hasn't been processed yet.
+			policy := cfg.GetUnknownRepoPolicy()
+			fmt.Fprintf(os.Stderr, "info: '%s/%s' is not registered yet, applying unknownRepoPolicy=%s\n", ownerPubKey, repoName, policy)
+			access, err = bridge.UnknownRepoAccess(db, policy, ownerPubKey, repoName, targetPubKey)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "fatal: failed to check repository permissions: %v\n", err)
+				fmt.Fprintf(os.Stderr, "hint: Database error while checking access permissions\n")
+				os.Exit(1)
+			}
 		} else {
 			fmt.Fprintf(os.Stderr, "fatal: failed to check repository permissions: %v\n", err)
 			fmt.Fprintf(os.Stderr, "hint: Database error while checking access permissions\n")
@@ -166,25 +177,48 @@ func main() {
 		}
 	}
 
-	// Repository owners should always retain full access, even if
-	// RepositoryPermission rows are missing/stale for their own pubkey.
-	if strings.EqualFold(targetPubKey, ownerPubKey) {
-		ownerPerm := "ADMIN"
-		permission = &ownerPerm
-	}
-
 	var consumePaywallGrant bool
+	var allowedRefs []string
 
 	switch verb {
 	case "git-upload-pack":
-		if !publicRead && !isReadAllowed(permission) {
+		if access < bridge.AccessRead {
 			fmt.Fprintf(os.Stderr, "fatal: permission denied for read operation on '%s/%s'\n", ownerPubKey, repoName)
 			fmt.Fprintf(os.Stderr, "hint: This repository is not publicly readable and you don't have read permission.\n")
 			fmt.Fprintf(os.Stderr, "hint: Contact the repository owner to request access.\n")
 			os.Exit(1)
 		}
+		// git clone only says "remote HEAD refers to nonexistent ref" for these
+		if head, branches, err := bridge.UnbornHead(repoPath); err == nil && head != "" {
+			branch := strings.TrimPrefix(head, "refs/heads/")
+			if len(branches) == 0 {
+				fmt.Fprintf(os.Stderr, "info: '%s/%s' is empty, nothing has been pushed yet\n", ownerPubKey, repoName)
+				fmt.Fprintf(os.Stderr, "hint: Push a first commit with: git push origin %s\n", branch)
+			} else {
+				fmt.Fprintf(os.Stderr, "info: the default branch '%s' of '%s/%s' has no commits yet\n", branch, ownerPubKey, repoName)
+				fmt.Fprintf(os.Stderr, "hint: Check out one of its branches instead, e.g.: git checkout %s\n", strings.TrimPrefix(branches[0], "refs/heads/"))
+			}
+		}
 	case "git-receive-pack":
-		if !publicWrite && !isWriteAllowed(permission) {
+		if cfg.ReadOnly {
+			fmt.Fprintf(os.Stderr, "fatal: '%s/%s' is served by a read-only mirror\n", ownerPubKey, repoName)
+			fmt.Fprintf(os.Stderr, "hint: Push to the repository's own git server instead.\n")
+			os.Exit(1)
+		}
+		if access < bridge.AccessWrite {
+			// Public write may be scoped to some refs; the pre-receive hook enforces the scope.
+			allowedRefs, err = bridge.PublicWriteRefs(db, ownerPubKey, repoName)
+			if err != nil && !errors.Is(err, bridge.ErrRepositoryNotFound) {
+				fmt.Fprintf(os.Stderr, "fatal: failed to check public write refs: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if len(allowedRefs) > 0 {
+			if err := ensureHook(repoPath, "pre-receive"); err != nil {
+				fmt.Fprintf(os.Stderr, "fatal: cannot enforce ref-scoped public write: %v\n", err)
+				os.Exit(1)
+			}
+		} else if access < bridge.AccessWrite {
 			fmt.Fprintf(os.Stderr, "fatal: permission denied for write operation on '%s/%s'\n", ownerPubKey, repoName)
 			fmt.Fprintf(os.Stderr, "hint: This repository is not publicly writable and you don't have write permission.\n")
 			fmt.Fprintf(os.Stderr, "hint: Only repository owners and users with WRITE or ADMIN permissions can push.\n")
@@ -192,10 +226,13 @@ func main() {
 			os.Exit(1)
 		}
 		// Optional push paywall: if repo has a push cost, the caller must have one unpaid->paid invoice intent.
+		// Owners never pay to push to their own repository.
 		var pushCostSats int
 		costRow := db.QueryRow("SELECT PushCostSats FROM RepositoryPushPolicy WHERE OwnerPubKey=? AND RepositoryName=?", ownerPubKey, repoName)
 		costErr := costRow.Scan(&pushCostSats)
-		if costErr != nil && !errors.Is(costErr, sql.ErrNoRows) {
+		if isOwner {
+			pushCostSats = 0
+		} else if costErr != nil && !errors.Is(costErr, sql.ErrNoRows) {
 			// Graceful fallback for older DBs without this table.
 			if !strings.Contains(strings.ToLower(costErr.Error()), "no such table") {
 				fmt.Fprintf(os.Stderr, "fatal: failed to check push policy: %v\n", costErr)
@@ -225,21 +262,66 @@ func main() {
 			consumePaywallGrant = true
 		}
 	default:
-		if !isAdminAllowed(permission) {
+		if access < bridge.AccessAdmin {
 			fmt.Fprintf(os.Stderr, "fatal: permission denied for admin operation on '%s/%s'\n", ownerPubKey, repoName)
 			fmt.Fprintf(os.Stderr, "hint: This operation requires ADMIN permission.\n")
 			os.Exit(1)
 		}
 	}
 
-	c := exec.Command("git", "shell", "-c", verb+" '"+repoPath+"'")
+	var hookURL string
+	if verb == "git-receive-pack" {
+		hookURL, err = bridge.RepositoryHookURL(db, ownerPubKey, repoName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to check repository hook: %v\n", err)
+		}
+		if hookURL != "" {
+			if err := ensureHook(repoPath, "post-receive"); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: repository hook not installed: %v\n", err)
+				hookURL = ""
+			}
+		}
+	}
+
+	if verb == "git-receive-pack" {
+		// Keeps the bridge's gc from repacking while the push is being received.
+		unlock, err := bridge.LockRepoShared(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(1)
+		}
+		defer unlock()
+	}
+
+	c := cfg.Git("shell", "-c", verb+" '"+repoPath+"'")
 	c.Stdout = os.Stdout
 	c.Stdin = os.Stdin
 	c.Stderr = os.Stderr
+	// The client's GIT_PROTOCOL is replaced by the version negotiated within gitProtocol
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, bridge.GitProtocolEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	if protocol := cfg.NegotiateGitProtocol(os.Getenv(bridge.GitProtocolEnv)); protocol != "" {
+		env = append(env, bridge.GitProtocolEnv+"="+protocol)
+	}
+	c.Env = append(env,
+		allowedRefsEnv+"="+strings.Join(allowedRefs, " "),
+		hookURLEnv+"="+hookURL,
+		hookOwnerEnv+"="+ownerPubKey,
+		hookRepoEnv+"="+repoName,
+		hookPusherEnv+"="+targetPubKey,
+	)
 
 	err = c.Run()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "git error:", err)
+		if errors.Is(err, bridge.ErrGitTimeout) {
+			fmt.Fprintf(os.Stderr, "hint: The transfer took longer than the server's gitTimeout and was aborted.\n")
+			os.Exit(1)
+		}
 		if e := (&exec.ExitError{}); errors.As(err, &e) {
 			os.Exit(e.ExitCode())
 		} else {
@@ -247,6 +329,35 @@ func main() {
 		}
 	}
 
+	if verb == "git-receive-pack" {
+		if err := bridge.RecordPush(db, ownerPubKey, repoName, targetPubKey, time.Now().Unix()); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: push succeeded but failed to record push statistics: %v\n", err)
+		}
+
+		if _, err := bridge.RefreshRepoSize(db, cfg, ownerPubKey, repoName); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: push succeeded but failed to update the repository size: %v\n", err)
+		}
+
+		if cfg.DumbHttp {
+			if err := bridge.UpdateServerInfo(repoPath); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: push succeeded but failed to update dumb http info: %v\n", err)
+			}
+		}
+
+		sink, err := bridge.OpenEventSink(cfg.EventSink)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: push succeeded but failed to open event sink: %v\n", err)
+			sink = bridge.NewAuditSink(db)
+		} else {
+			sink = bridge.MultiSink(sink, bridge.NewAuditSink(db))
+		}
+		err = sink.Emit(bridge.SinkEvent{Type: bridge.SinkPushReceived, Time: time.Now().Unix(), Owner: ownerPubKey, Repo: repoName, PubKey: targetPubKey})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: push succeeded but failed to emit push event: %v\n", err)
+		}
+		sink.Close()
+	}
+
 	if consumePaywallGrant {
 		consumeResult, consumeErr := db.Exec("UPDATE RepositoryPushPaymentIntent SET Status='consumed', UpdatedAt=? WHERE IntentId=(SELECT IntentId FROM RepositoryPushPaymentIntent WHERE OwnerPubKey=? AND RepositoryName=? AND PayerPubKey=? AND Status='paid' ORDER BY PaidAt DESC, UpdatedAt DESC LIMIT 1)", time.Now().Unix(), ownerPubKey, repoName, targetPubKey)
 		if consumeErr != nil {
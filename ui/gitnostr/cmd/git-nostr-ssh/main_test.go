@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestParseOwnerPubKey(t *testing.T) {
+	const owner = "4242424242424242424242424242424242424242424242424242424242abcdef"
+	npub, err := nip19.EncodePublicKey(owner, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryNip05 := func(identifier string) string {
+		if identifier == "steve@localhost" {
+			return strings.ToUpper(owner)
+		}
+		return ""
+	}
+
+	tests := []struct {
+		owner string
+		want  string
+	}{
+		{owner, owner},
+		{strings.ToUpper(owner), owner},
+		{owner[:58] + "AbCdEf", owner},
+		{npub, owner},
+		{"steve@localhost", owner},
+		{"nobody@localhost", ""},
+		{"npub1invalid", ""},
+		{owner[:63], ""},
+		{owner[:62] + "zz", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got, err := parseOwnerPubKey(test.owner, queryNip05)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("parseOwnerPubKey(%q) = %q, want error", test.owner, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseOwnerPubKey(%q) = %q, %v, want %q", test.owner, got, err, test.want)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -13,7 +13,21 @@ import (
 	"github.com/arbadacarbaYK/gitnostr"
 )
 
+// pendingMigration is a repository whose HEAD commit date will be rewritten.
+type pendingMigration struct {
+	ownerPubkey       string
+	repoName          string
+	repoPath          string
+	currentCommitTime int64
+	updatedAt         int64
+}
+
 func main() {
+	var yes bool
+	flag.BoolVar(&yes, "yes", false, "rewrite the listed repositories; without it nothing is changed")
+	flag.BoolVar(&yes, "force", false, "same as --yes")
+	flag.Parse()
+
 	log.Println("🔄 Starting commit date migration...")
 	log.Println("📋 This script will update commit dates in bridge repos to match their UpdatedAt timestamps from the database")
 
@@ -54,6 +68,7 @@ func main() {
 	migratedCount := 0
 	skippedCount := 0
 	errorCount := 0
+	var pending []pendingMigration
 
 	for rows.Next() {
 		var ownerPubkey, repoName string
@@ -65,7 +80,12 @@ func main() {
 			continue
 		}
 
-		repoPath := filepath.Join(reposDir, ownerPubkey, repoName+".git")
+		repoPath, err := cfg.RepoPath(ownerPubkey, repoName)
+		if err != nil {
+			log.Printf("⚠️ Error resolving %s/%s: %v", safePubkeyDisplay(ownerPubkey), repoName, err)
+			errorCount++
+			continue
+		}
 
 		// Check if repo exists
 		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
@@ -75,7 +95,7 @@ func main() {
 		}
 
 		// Get the latest commit SHA for the default branch
-		cmd := exec.Command("git", "--git-dir", repoPath, "rev-parse", "HEAD")
+		cmd := cfg.Git("--git-dir", repoPath, "rev-parse", "HEAD")
 		output, err := cmd.Output()
 		if err != nil {
 			log.Printf("⚠️  Failed to get HEAD for %s/%s: %v", safePubkeyDisplay(ownerPubkey), repoName, err)
@@ -91,7 +111,7 @@ func main() {
 		}
 
 		// Get current commit date
-		cmd = exec.Command("git", "--git-dir", repoPath, "log", "-1", "--format=%ct", latestCommitSHA)
+		cmd = cfg.Git("--git-dir", repoPath, "log", "-1", "--format=%ct", latestCommitSHA)
 		output, err = cmd.Output()
 		if err != nil {
 			log.Printf("⚠️  Failed to get commit date for %s/%s: %v", safePubkeyDisplay(ownerPubkey), repoName, err)
@@ -113,6 +133,31 @@ func main() {
 			continue
 		}
 
+		pending = append(pending, pendingMigration{ownerPubkey: ownerPubkey, repoName: repoName, repoPath: repoPath, currentCommitTime: currentCommitTime, updatedAt: updatedAt})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Fatalf("fatal: error iterating rows: %v", err)
+	}
+	rows.Close()
+
+	// filter-branch rewrites history in place; a wrong repositoryDir or database would
+	// rewrite the wrong repositories, so show them and require --yes first
+	if len(pending) > 0 {
+		log.Printf("📋 %d repositories will have their HEAD commit rewritten with git filter-branch:", len(pending))
+		for _, m := range pending {
+			log.Printf("   %s/%s (%s): %s -> %s", safePubkeyDisplay(m.ownerPubkey), m.repoName, m.repoPath,
+				time.Unix(m.currentCommitTime, 0).Format(time.RFC3339),
+				time.Unix(m.updatedAt, 0).Format(time.RFC3339))
+		}
+		if !yes {
+			log.Println("❌ Aborting: this can't be undone. Check the list above, then run again with --yes")
+			os.Exit(1)
+		}
+	}
+
+	for _, m := range pending {
+		ownerPubkey, repoName, repoPath, currentCommitTime, updatedAt := m.ownerPubkey, m.repoName, m.repoPath, m.currentCommitTime, m.updatedAt
 		log.Printf("🔄 Migrating %s/%s: Updating commit date from %s to %s", 
 			safePubkeyDisplay(ownerPubkey), repoName,
 			time.Unix(currentCommitTime, 0).Format(time.RFC3339),
@@ -137,9 +182,9 @@ func main() {
 		commitDateRFC2822 := time.Unix(updatedAt, 0).UTC().Format(time.RFC1123Z)
 		envFilter := fmt.Sprintf("export GIT_AUTHOR_DATE=\"%s\" GIT_COMMITTER_DATE=\"%s\"", commitDateRFC2822, commitDateRFC2822)
 
-		cmd = exec.Command("git", "--git-dir", repoPath, "filter-branch", "-f", "--env-filter", envFilter, "HEAD")
+		cmd := cfg.Git("--git-dir", repoPath, "filter-branch", "-f", "--env-filter", envFilter, "HEAD")
 		cmd.Env = append(os.Environ(), "FILTER_BRANCH_SQUELCH_WARNING=1") // Suppress warnings
-		output, err = cmd.CombinedOutput()
+		output, err := cmd.CombinedOutput()
 		if err != nil {
 			log.Printf("❌ Failed to update commit date for %s/%s: %v\nOutput: %s", safePubkeyDisplay(ownerPubkey), repoName, err, string(output))
 			errorCount++
@@ -147,25 +192,25 @@ func main() {
 		}
 
 		// Clean up filter-branch backup refs
-		cmd = exec.Command("git", "--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/original/")
+		cmd = cfg.Git("--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/original/")
 		output, err = cmd.Output()
 		if err == nil && len(output) > 0 {
 			// Remove backup refs
-			cmd = exec.Command("git", "--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/original/")
+			cmd = cfg.Git("--git-dir", repoPath, "for-each-ref", "--format=%(refname)", "refs/original/")
 			refsOutput, _ := cmd.Output()
 			if len(refsOutput) > 0 {
 				// Remove each backup ref
 				refs := string(refsOutput)
 				for _, ref := range splitLines(refs) {
 					if ref != "" {
-						exec.Command("git", "--git-dir", repoPath, "update-ref", "-d", ref).Run()
+						cfg.Git("--git-dir", repoPath, "update-ref", "-d", ref).Run()
 					}
 				}
 			}
 		}
 
 		// Verify the update
-		cmd = exec.Command("git", "--git-dir", repoPath, "log", "-1", "--format=%ct", "HEAD")
+		cmd = cfg.Git("--git-dir", repoPath, "log", "-1", "--format=%ct", "HEAD")
 		output, err = cmd.Output()
 		if err == nil {
 			var newCommitTime int64
@@ -181,10 +226,6 @@ func main() {
 		}
 	}
 
-	if err := rows.Err(); err != nil {
-		log.Fatalf("fatal: error iterating rows: %v", err)
-	}
-
 	log.Println("\n📊 Migration Summary:")
 	log.Printf("   ✅ Migrated: %d repos", migratedCount)
 	log.Printf("   ⏭️  Skipped: %d repos (already correct or not found)", skippedCount)
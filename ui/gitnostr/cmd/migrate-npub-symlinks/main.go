@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/nbd-wtf/go-nostr/nip19"
 	"github.com/arbadacarbaYK/gitnostr"
@@ -12,6 +15,11 @@ import (
 )
 
 func main() {
+	var yes bool
+	flag.BoolVar(&yes, "yes", false, "merge npub directories and repoint wrong symlinks; without it nothing is moved")
+	flag.BoolVar(&yes, "force", false, "same as --yes")
+	flag.Parse()
+
 	cfg, err := bridge.LoadConfig("~/.config/git-nostr")
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -21,6 +29,10 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to resolve repos directory: %v", err)
 	}
+	if !cfg.OwnerDirs() {
+		log.Printf("✅ pathLayout %s has no owner directories to link, nothing to do\n", cfg.GetPathLayout())
+		return
+	}
 
 	log.Printf("🔍 Scanning repository directory: %s\n", reposDir)
 
@@ -30,11 +42,50 @@ func main() {
 		log.Fatalf("Failed to read repos directory: %v", err)
 	}
 
+	// Merging moves repositories and repointing replaces links: with a wrong
+	// repositoryDir that moves the wrong data, so list it and require --yes first
+	if changes := destructiveChanges(reposDir, entries); len(changes) > 0 {
+		log.Printf("📋 These changes move repositories or replace links in %s:\n", reposDir)
+		for _, change := range changes {
+			log.Printf("   %s\n", change)
+		}
+		if !yes {
+			log.Printf("❌ Aborting: check the list above, then run again with --yes\n")
+			os.Exit(1)
+		}
+	}
+
 	created := 0
 	updated := 0
 	skipped := 0
+	merged := 0
 	errors := 0
 
+	// Real npub directories should be symlinks: move their repos to the hex directory first
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "npub1") {
+			continue
+		}
+		moved, conflicts, err := bridge.MergeNpubDir(reposDir, entry.Name())
+		merged += moved
+		if err != nil {
+			log.Printf("❌ Failed to merge npub directory %s: %v\n", entry.Name(), err)
+			errors++
+			continue
+		}
+		if len(conflicts) > 0 {
+			log.Printf("⚠️  npub directory %s: moved %d repos, these exist under both npub and hex and must be resolved by hand: %s\n", entry.Name(), moved, strings.Join(conflicts, ", "))
+			continue // counted as an error below
+		}
+		log.Printf("🔀 Merged npub directory %s into its hex directory (%d repos moved)\n", entry.Name(), moved)
+	}
+
+	// Merging may have created hex directories
+	entries, err = os.ReadDir(reposDir)
+	if err != nil {
+		log.Fatalf("Failed to read repos directory: %v", err)
+	}
+
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -100,7 +151,7 @@ func main() {
 			} else if linkInfo.IsDir() {
 				// npub directory exists as a real directory (not symlink)
 				log.Printf("⚠️  npub directory exists as real directory (not symlink): %s\n", npub)
-				log.Printf("   This shouldn't happen - skipping to avoid conflicts\n")
+				log.Printf("   Its conflicting repositories are listed above - skipping\n")
 				errors++
 				continue
 			}
@@ -122,6 +173,7 @@ func main() {
 	log.Printf("   Created: %d symlinks", created)
 	log.Printf("   Updated: %d symlinks", updated)
 	log.Printf("   Skipped: %d (already correct)", skipped)
+	log.Printf("   Merged: %d repos from npub directories", merged)
 	log.Printf("   Errors: %d", errors)
 	log.Printf("   Total hex directories processed: %d\n", len(entries))
 
@@ -133,3 +185,35 @@ func main() {
 	}
 }
 
+// destructiveChanges lists the npub directories that would be merged into their hex
+// directory and the npub symlinks that would be repointed.
+func destructiveChanges(reposDir string, entries []os.DirEntry) []string {
+	var changes []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "npub1") {
+			continue
+		}
+		hexPubkey, err := gitnostr.DecodePubKey(entry.Name())
+		if err != nil {
+			continue
+		}
+		if entry.IsDir() {
+			repos, _ := os.ReadDir(filepath.Join(reposDir, entry.Name()))
+			changes = append(changes, fmt.Sprintf("merge directory %s (%d entries) into %s", entry.Name(), len(repos), hexPubkey))
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(reposDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(reposDir, target)
+		}
+		if filepath.Clean(target) != filepath.Join(reposDir, hexPubkey) {
+			if _, err := os.Stat(filepath.Join(reposDir, hexPubkey)); err == nil {
+				changes = append(changes, fmt.Sprintf("repoint symlink %s from %s to %s", entry.Name(), target, hexPubkey))
+			}
+		}
+	}
+	return changes
+}
@@ -3,6 +3,7 @@ module github.com/arbadacarbaYK/gitnostr
 go 1.20
 
 require (
+	github.com/gorilla/websocket v1.4.2
 	github.com/spearson78/fsql v0.0.3
 	github.com/spearson78/migrate v0.0.7
 	modernc.org/sqlite v1.19.4
@@ -14,7 +15,6 @@ require (
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
 	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
-	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/spearson78/fault v0.4.4-floc // indirect
 	github.com/valyala/fastjson v1.6.3 // indirect
 	golang.org/x/exp v0.0.0-20221106115401-f9659909a136 // indirect
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Address is a NIP-01 replaceable event coordinate "<kind>:<pubkey>:<d-tag>",
+// as used in NIP-34 "a" tags to reference a repository announcement.
+type Address struct {
+	Kind       int
+	PubKey     string
+	Identifier string
+}
+
+func (a Address) String() string {
+	return fmt.Sprintf("%d:%s:%s", a.Kind, a.PubKey, a.Identifier)
+}
+
+func ParseAddress(coordinate string) (Address, error) {
+	parts := strings.SplitN(coordinate, ":", 3)
+	if len(parts) != 3 {
+		return Address{}, fmt.Errorf("invalid coordinate %q: expected <kind>:<pubkey>:<identifier>", coordinate)
+	}
+
+	kind, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid coordinate %q: bad kind: %w", coordinate, err)
+	}
+
+	pubKey := strings.ToLower(parts[1])
+	if decoded, err := hex.DecodeString(pubKey); err != nil || len(decoded) != 32 {
+		return Address{}, fmt.Errorf("invalid coordinate %q: pubkey must be 64 hex characters", coordinate)
+	}
+
+	if parts[2] == "" {
+		return Address{}, fmt.Errorf("invalid coordinate %q: empty identifier", coordinate)
+	}
+
+	return Address{Kind: kind, PubKey: pubKey, Identifier: parts[2]}, nil
+}
@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	KindTextNote int = 1    // NIP-10: replies threaded with marked "e" tags
+	KindComment  int = 1111 // NIP-22: comments scoped to a root event
+)
+
+// Comment is a reply in the discussion of an issue or patch.
+type Comment struct {
+	RootEventID   string    // the issue or patch the discussion belongs to
+	ParentEventID string    // the event replied to, the root or another comment
+	Repositories  []Address // the repositories the issue or patch belongs to
+}
+
+// ParseComment extracts the thread position and repositories of a NIP-22 comment or
+// a NIP-10 reply. NIP-22 comments name the root with "E" and the parent with "e";
+// NIP-10 replies mark their "e" tags "root" and "reply", and a reply with only a
+// root tag replies to the root. The repositories are the 30617 "a" or "A" tags.
+func ParseComment(event nostr.Event) (Comment, error) {
+	if event.Kind != KindComment && event.Kind != KindTextNote {
+		return Comment{}, fmt.Errorf("kind %d is not a comment kind", event.Kind)
+	}
+
+	var comment Comment
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "E":
+			if event.Kind == KindComment {
+				comment.RootEventID = tag[1]
+			}
+		case "e":
+			if event.Kind == KindComment {
+				comment.ParentEventID = tag[1]
+			} else if len(tag) >= 4 && tag[3] == "root" {
+				comment.RootEventID = tag[1]
+			} else if len(tag) >= 4 && tag[3] == "reply" {
+				comment.ParentEventID = tag[1]
+			}
+		case "a", "A":
+			address, err := ParseAddress(tag[1])
+			if err == nil && address.Kind == KindRepositoryNIP34 && !hasAddress(comment.Repositories, address) {
+				comment.Repositories = append(comment.Repositories, address)
+			}
+		}
+	}
+
+	if comment.RootEventID == "" {
+		comment.RootEventID = comment.ParentEventID
+	}
+	if comment.ParentEventID == "" {
+		comment.ParentEventID = comment.RootEventID
+	}
+	if comment.RootEventID == "" {
+		return Comment{}, fmt.Errorf("comment %s has no root or parent 'e' tag", event.ID)
+	}
+	if len(comment.Repositories) == 0 {
+		return Comment{}, fmt.Errorf("comment %s has no repository 'a' tag", event.ID)
+	}
+	return comment, nil
+}
+
+func hasAddress(addresses []Address, address Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
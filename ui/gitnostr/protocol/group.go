@@ -0,0 +1,8 @@
+package protocol
+
+// Group is a named set of member pubkeys defined by its owner.
+// Permissions can be granted to a group on any of the owner's repositories.
+type Group struct {
+	GroupName string   `json:"groupName"`
+	Members   []string `json:"members"`
+}
@@ -0,0 +1,7 @@
+package protocol
+
+// GitIdentity lists the git author emails the event's author commits with.
+// It replaces any list the author published before.
+type GitIdentity struct {
+	Emails []string `json:"emails"`
+}
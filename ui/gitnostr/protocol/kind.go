@@ -4,6 +4,13 @@ const (
 	KindRepositoryPermission int = 50
 	KindRepository           int = 51
 	KindSshKey               int = 52
+	KindGroup                int = 53
+	KindGitIdentity          int = 54
+	KindRepositoryHook       int = 55
+	KindRepositoryAck        int = 56 // bridge-signed receipt that an announced repository is hosted
+	KindPatch                int = 1617 // NIP-34: git format-patch output in content
+	KindIssue                int = 1621 // NIP-34: issue with subject and body in content
+	KindRelayList            int = 10002 // NIP-65: relays a pubkey reads from and writes to, in r tags
 	KindRepositoryNIP34      int = 30617
 	KindRepositoryState      int = 30618 // NIP-34: Repository state event with refs/commits
 )
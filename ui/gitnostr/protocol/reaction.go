@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const KindReaction int = 7 // NIP-25
+
+// Reaction is a NIP-25 reaction to a repository announcement or to an issue or patch.
+type Reaction struct {
+	TargetEventID string    // the issue or patch reacted to, "" for the repository itself
+	Repositories  []Address // the repositories named by the reaction's 30617 "a" tags
+	Content       string    // "+" (like), "-" (dislike) or an emoji
+}
+
+// ParseReaction extracts the target of a reaction. The last "e" tag is the event
+// reacted to, unless the "k" tag or the absence of "e" tags marks a reaction to the
+// repository announcement in the "a" tag. An empty content counts as "+".
+func ParseReaction(event nostr.Event) (Reaction, error) {
+	if event.Kind != KindReaction {
+		return Reaction{}, fmt.Errorf("kind %d is not a reaction", event.Kind)
+	}
+
+	reaction := Reaction{Content: event.Content}
+	if reaction.Content == "" {
+		reaction.Content = "+"
+	}
+	targetKind := -1
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "e":
+			reaction.TargetEventID = tag[1]
+		case "k":
+			if kind, err := strconv.Atoi(tag[1]); err == nil {
+				targetKind = kind
+			}
+		case "a":
+			address, err := ParseAddress(tag[1])
+			if err == nil && address.Kind == KindRepositoryNIP34 && !hasAddress(reaction.Repositories, address) {
+				reaction.Repositories = append(reaction.Repositories, address)
+			}
+		}
+	}
+
+	if targetKind == KindRepositoryNIP34 {
+		reaction.TargetEventID = ""
+	}
+	if reaction.TargetEventID == "" && len(reaction.Repositories) == 0 {
+		return Reaction{}, fmt.Errorf("reaction %s has neither an 'e' tag nor a repository 'a' tag", event.ID)
+	}
+	return reaction, nil
+}
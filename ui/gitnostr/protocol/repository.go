@@ -1,10 +1,79 @@
 package protocol
 
+import (
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
 type Repository struct {
 	RepositoryName string `json:"repositoryName"`
 	PublicRead     bool   `json:"publicRead"`
 	PublicWrite    bool   `json:"publicWrite"`
-	GitSshBase     string `json:"gitSshBase"`
-	Deleted        bool   `json:"deleted"`
-	Archived       bool   `json:"archived"`
+	// PublicWriteRefs limits PublicWrite to matching refs, e.g. "refs/heads/contrib/*".
+	PublicWriteRefs []string `json:"publicWriteRefs,omitempty"`
+	GitSshBase      string   `json:"gitSshBase"`
+	Deleted         bool     `json:"deleted"`
+	Archived        bool     `json:"archived"`
+	// DefaultBranch is the branch HEAD of a new empty repository points to.
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+}
+
+// DefaultBranchName is the default branch of repositories whose announcement names none.
+const DefaultBranchName = "main"
+
+// GetDefaultBranch returns DefaultBranch, defaulting to DefaultBranchName.
+func (r Repository) GetDefaultBranch() string {
+	if r.DefaultBranch == "" {
+		return DefaultBranchName
+	}
+	return r.DefaultBranch
+}
+
+// AnnouncedDefaultBranch returns the branch named by a 30617 "default-branch" tag, or
+// by a "HEAD" tag pointing at a branch (see ParseHead), or "" without either.
+func AnnouncedDefaultBranch(tags nostr.Tags) string {
+	for _, tag := range tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if tag[0] == "default-branch" && tag[1] != "" {
+			return tag[1]
+		}
+		if tag[0] == "HEAD" {
+			if ref, _ := ParseHead(tag[1]); strings.HasPrefix(ref, "refs/heads/") {
+				return strings.TrimPrefix(ref, "refs/heads/")
+			}
+		}
+	}
+	return ""
+}
+
+// ParseHead parses the value of a "HEAD" tag. NIP-34 specifies "ref: refs/heads/<branch>",
+// but clients also send the ref without the "ref: " prefix, both returned as ref, or a
+// commit id for a detached HEAD, returned as commit. Both are "" for anything else.
+func ParseHead(value string) (ref string, commit string) {
+	value = strings.TrimSpace(value)
+	if target, found := strings.CutPrefix(value, "ref:"); found {
+		value = strings.TrimSpace(target)
+	} else if isCommitId(value) {
+		return "", value
+	}
+	if strings.HasPrefix(value, "refs/") {
+		return value, ""
+	}
+	return "", ""
+}
+
+// isCommitId reports whether s is a full SHA-1 or SHA-256 object id in lowercase hex.
+func isCommitId(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,8 @@
+package protocol
+
+// RepositoryHook sets the URL the bridge POSTs to after each push to one of the
+// owner's repositories. An empty Url removes the hook.
+type RepositoryHook struct {
+	RepositoryName string `json:"repositoryName"`
+	Url            string `json:"url"`
+}
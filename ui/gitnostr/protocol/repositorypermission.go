@@ -1,7 +1,34 @@
 package protocol
 
+import (
+	"fmt"
+	"strings"
+)
+
 type RepositoryPermission struct {
 	RepositoryName string `json:"repositoryName"`
 	TargetPubKey   string `json:"targetPubKey"`
+	TargetGroup    string `json:"targetGroup,omitempty"` // grant to one of the owner's groups instead of a pubkey
 	Permission     string `json:"permission"`
 }
+
+// Permission levels of a RepositoryPermission. NONE revokes an earlier grant.
+const (
+	PermissionAdmin = "ADMIN"
+	PermissionWrite = "WRITE"
+	PermissionRead  = "READ"
+	PermissionNone  = "NONE"
+)
+
+var Permissions = []string{PermissionAdmin, PermissionWrite, PermissionRead, PermissionNone}
+
+// ValidatePermission rejects permission levels other than Permissions, so a typo
+// doesn't silently grant nothing.
+func ValidatePermission(permission string) error {
+	for _, p := range Permissions {
+		if permission == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown permission %q, expected one of %s", permission, strings.Join(Permissions, ", "))
+}
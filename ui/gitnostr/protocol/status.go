@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// NIP-34 status events for issues and patches.
+const (
+	KindStatusOpen    int = 1630
+	KindStatusApplied int = 1631 // applied/merged for patches, resolved for issues
+	KindStatusClosed  int = 1632
+	KindStatusDraft   int = 1633
+)
+
+var StatusKinds = []int{KindStatusOpen, KindStatusApplied, KindStatusClosed, KindStatusDraft}
+
+// Status is the state an issue or patch was put in by a status event.
+type Status struct {
+	TargetEventID string    // the issue or patch the status applies to
+	Repositories  []Address // the repositories the issue or patch belongs to
+	Status        string    // open, applied, closed or draft
+}
+
+func IsStatusKind(kind int) bool {
+	return kind >= KindStatusOpen && kind <= KindStatusDraft
+}
+
+func StatusName(kind int) string {
+	switch kind {
+	case KindStatusOpen:
+		return "open"
+	case KindStatusApplied:
+		return "applied"
+	case KindStatusClosed:
+		return "closed"
+	case KindStatusDraft:
+		return "draft"
+	}
+	return ""
+}
+
+// ParseStatus extracts the target event and repositories from a status event.
+// The target is the "e" tag marked "root", or the first "e" tag if none is marked.
+func ParseStatus(event nostr.Event) (Status, error) {
+	if !IsStatusKind(event.Kind) {
+		return Status{}, fmt.Errorf("kind %d is not a status kind", event.Kind)
+	}
+
+	status := Status{Status: StatusName(event.Kind)}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "e":
+			if status.TargetEventID == "" || (len(tag) >= 4 && tag[3] == "root") {
+				status.TargetEventID = tag[1]
+			}
+		case "a":
+			address, err := ParseAddress(tag[1])
+			if err == nil && address.Kind == KindRepositoryNIP34 {
+				status.Repositories = append(status.Repositories, address)
+			}
+		}
+	}
+
+	if status.TargetEventID == "" {
+		return Status{}, fmt.Errorf("status event %s has no 'e' tag", event.ID)
+	}
+	if len(status.Repositories) == 0 {
+		return Status{}, fmt.Errorf("status event %s has no repository 'a' tag", event.ID)
+	}
+	return status, nil
+}
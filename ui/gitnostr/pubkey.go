@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/nbd-wtf/go-nostr/nip05"
+	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
 func resolveNip05(name string) string {
@@ -27,10 +28,44 @@ func ResolveHexPubKey(pubKeyStr string) (string, error) {
 			return "", fmt.Errorf("couldnot resolve nip05 pub key %v", pubKeyStr)
 		} else {
 			log.Println(pubKeyStr, "->", resolved)
-			return resolved, nil
+			return strings.ToLower(resolved), nil
 		}
 	} else {
-		_, err := hex.DecodeString(pubKeyStr)
-		return pubKeyStr, err
+		return DecodePubKey(pubKeyStr)
 	}
 }
+
+// DecodePubKey accepts a hex or npub public key and returns it as lowercase hex.
+func DecodePubKey(pubKeyStr string) (string, error) {
+	if strings.HasPrefix(pubKeyStr, "npub1") {
+		decoded, _, err := nip19.Decode(pubKeyStr)
+		if err != nil || len(decoded) != 32 {
+			return "", fmt.Errorf("invalid npub %v", pubKeyStr)
+		}
+		return hex.EncodeToString(decoded), nil
+	}
+
+	decoded, err := hex.DecodeString(pubKeyStr)
+	if err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("invalid hex pub key %v", pubKeyStr)
+	}
+	return strings.ToLower(pubKeyStr), nil
+}
+
+// DecodePrivateKey accepts a hex or nsec private key and returns it as lowercase hex.
+func DecodePrivateKey(privateKeyStr string) (string, error) {
+	privateKeyStr = strings.TrimSpace(privateKeyStr)
+	if strings.HasPrefix(privateKeyStr, "nsec1") {
+		decoded, prefix, err := nip19.Decode(privateKeyStr)
+		if err != nil || prefix != "nsec" || len(decoded) != 32 {
+			return "", fmt.Errorf("invalid nsec")
+		}
+		return hex.EncodeToString(decoded), nil
+	}
+
+	decoded, err := hex.DecodeString(privateKeyStr)
+	if err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("invalid hex private key")
+	}
+	return strings.ToLower(privateKeyStr), nil
+}